@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/bench"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/RedHatInsights/frontend-asset-proxy/pkg/proxy"
+)
+
+// headerFlags collects repeated -H "Name: value" flags.
+type headerFlags http.Header
+
+func (h headerFlags) String() string { return "" }
+
+func (h headerFlags) Set(v string) error {
+	name, value, ok := strings.Cut(v, ":")
+	if !ok {
+		return fmt.Errorf("header %q is not Name: value", v)
+	}
+	http.Header(h).Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	return nil
+}
+
+// runBench replays the requests of an access log or path list against a running proxy,
+// or against a handler built in-process from the environment like the proxy binary.
+func runBench(cfg config.FrontendAssetProxyConfig, log *logger.Root, args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: frontend-asset-proxy bench [flags] <access log or path list, - for stdin>")
+		fmt.Fprintln(flags.Output(), "Replays GET and HEAD requests at a fixed rate and reports latency percentiles and error rates.")
+		flags.PrintDefaults()
+	}
+	target := flags.String("target", "", "base URL of a running proxy; empty serves the proxy in-process from the environment's configuration")
+	rps := flags.Float64("rps", 50, "requests started per second")
+	duration := flags.Duration("duration", 30*time.Second, "how long to run; 0 runs until -n requests or interrupted")
+	requests := flags.Int("n", 0, "stop after this many requests; 0 runs for -duration")
+	concurrency := flags.Int("concurrency", 100, "requests in flight at most; requests due above it are dropped")
+	timeout := flags.Duration("timeout", 10*time.Second, "per-request timeout, counted as an error")
+	jsonOutput := flags.Bool("json", false, "print the results as JSON")
+	header := headerFlags{}
+	flags.Var(header, "H", `header added to every request, e.g. -H "Accept: text/html"; repeatable`)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected one request file")
+	}
+
+	var in io.Reader = os.Stdin
+	if name := flags.Arg(0); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	reqs, skipped, err := bench.ParseRequests(in)
+	if err != nil {
+		return err
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "skipped %d lines without a GET or HEAD request\n", skipped)
+	}
+
+	if *target == "" {
+		handler, err := proxy.NewHandler(cfg, nil, log)
+		if err != nil {
+			return err
+		}
+		defer handler.Close()
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return err
+		}
+		srv := &http.Server{Handler: handler, ReadHeaderTimeout: cfg.ReadHeaderTimeout}
+		go srv.Serve(ln)
+		defer srv.Close()
+		*target = "http://" + ln.Addr().String()
+	}
+
+	client := &http.Client{
+		Timeout: *timeout,
+		Transport: &http.Transport{
+			MaxIdleConns:        *concurrency,
+			MaxIdleConnsPerHost: *concurrency,
+			// Compression would hide the cost of serving compressed responses
+			DisableCompression: true,
+		},
+		// Redirects are reported as such rather than followed
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "replaying %d requests against %s at %.1f/s\n", len(reqs), *target, *rps)
+	res, err := bench.Run(ctx, client, reqs, bench.Options{
+		Target:      *target,
+		RPS:         *rps,
+		Duration:    *duration,
+		Requests:    *requests,
+		Concurrency: *concurrency,
+		Header:      http.Header(header),
+	})
+	if err != nil {
+		return err
+	}
+	if *jsonOutput {
+		return bench.WriteJSON(os.Stdout, res)
+	}
+	bench.WriteText(os.Stdout, res)
+	return nil
+}
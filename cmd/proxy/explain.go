@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+	"github.com/RedHatInsights/frontend-asset-proxy/pkg/proxy"
+)
+
+// explain prints how the proxy configured from the environment would serve a path: the
+// route rule it matches, the bucket and key it reads, the cache policy and the SPA
+// fallback, without contacting object storage.
+func explain(cfg config.FrontendAssetProxyConfig, args []string) error {
+	flags := flag.NewFlagSet("explain", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: frontend-asset-proxy explain [flags] <url path>")
+		fmt.Fprintln(flags.Output(), "Shows how a request path resolves through the route table configured in the environment.")
+		flags.PrintDefaults()
+	}
+	host := flags.String("host", "", "Host header of the request, for host-specific route rules")
+	method := flags.String("method", http.MethodGet, "request method")
+	jsonOutput := flags.Bool("json", false, "print the explanation as JSON")
+	header := headerFlags{}
+	flags.Var(header, "H", `request header, e.g. -H "x-rh-identity: ..."; repeatable`)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected one url path")
+	}
+	target := flags.Arg(0)
+	if !strings.HasPrefix(target, "/") {
+		target = "/" + target
+	}
+
+	r, err := http.NewRequest(strings.ToUpper(*method), target, nil)
+	if err != nil {
+		return err
+	}
+	r.Host = *host
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	e, err := proxy.Explain(cfg, r)
+	if err != nil {
+		return err
+	}
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(e)
+	}
+	writeExplanation(os.Stdout, e)
+	return nil
+}
+
+func writeExplanation(w io.Writer, e proxy.Explanation) {
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "%-13s %s\n", name+":", value)
+		}
+	}
+	field("path", e.Path)
+	field("host", e.Host)
+	field("outcome", e.Outcome)
+	field("endpoint", e.Endpoint)
+	field("location", e.Location)
+	if rule := e.Rule; rule != nil {
+		desc := fmt.Sprintf("prefix %s -> %s", rule.Prefix, rule.BucketPath)
+		if rule.Name != "" {
+			desc += ", name " + rule.Name
+		}
+		if rule.Host != "" {
+			desc += ", host " + rule.Host
+		}
+		if rule.StripPrefix {
+			desc += ", stripPrefix"
+		}
+		if rule.Key != "" {
+			desc += ", key " + rule.Key
+		}
+		field("rule", desc)
+	}
+	field("release", e.Release)
+	field("object", e.Object)
+	field("bucket", e.Bucket)
+	field("key", e.Key)
+	field("canary", e.Canary)
+	field("preview", e.Preview)
+	for i, p := range e.CachePolicy {
+		name := ""
+		if i == 0 {
+			name = "cache:"
+		}
+		fmt.Fprintf(w, "%-13s %s\n", name, p)
+	}
+	field("spa fallback", e.SPAFallback)
+	for _, note := range e.Notes {
+		fmt.Fprintf(w, "note:         %s\n", note)
+	}
+}
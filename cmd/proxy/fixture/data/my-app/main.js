@@ -0,0 +1 @@
+document.getElementById("root").textContent = "my-app is served by the frontend asset proxy";
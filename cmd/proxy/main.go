@@ -2,94 +2,149 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
+	"slices"
 	"syscall"
 
 	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/cwlogs"
 	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/metrics"
 	"github.com/RedHatInsights/frontend-asset-proxy/internal/s3"
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-	"github.com/sirupsen/logrus"
+	"github.com/RedHatInsights/frontend-asset-proxy/pkg/proxy"
 )
 
+// listener opens the server's listener: the unix socket at SERVER_SOCKET when set, for
+// sidecar topologies behind Envoy, otherwise TCP on SERVER_PORT.
+func listener(cfg config.FrontendAssetProxyConfig) (net.Listener, error) {
+	if cfg.ServerSocket == "" {
+		return net.Listen("tcp", ":"+cfg.ServerPort)
+	}
+	// A socket left behind by an unclean exit would make Listen fail
+	if err := os.Remove(cfg.ServerSocket); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return net.Listen("unix", cfg.ServerSocket)
+}
+
 func main() {
 	cfg := config.FromEnv()
-	listen := cfg.ServerPort
-	upstream := cfg.UpstreamURL
-	prefix := cfg.BucketPathPrefix
-	level := cfg.LogLevel
-	structuredLogger := logger.NewLogger(level, logrus.New())
-	log := structuredLogger.Logger
-
-	r := chi.NewRouter()
-	r.Use(middleware.RequestID)
-	r.Use(middleware.RequestLogger(structuredLogger))
-	r.Use(middleware.Recoverer)
-	r.Use(middleware.URLFormat)
-
-	s3Client := s3.NewS3ClientFromConfig(cfg, log)
-
-	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("OK"))
-	})
-
-	// /manifests/* -> /{prefix}{original}
-	r.Get("/manifests/*", func(w http.ResponseWriter, r *http.Request) {
-		full := s3.JoinPath(prefix, r.URL.Path)
-		s3.ProxyS3(w, r, s3Client, cfg, full, log)
-	})
-
-	// /apps/* -> /{prefix}/data/{rest}
-	r.Get("/apps/*", func(w http.ResponseWriter, r *http.Request) {
-		trimmed := strings.TrimPrefix(r.URL.Path, "/apps")
-		full := s3.JoinPath(prefix, "/data"+trimmed)
-		s3.ProxyS3(w, r, s3Client, cfg, full, log)
-	})
-
-	// handle HEAD requests
-	r.MethodFunc(http.MethodHead, "/*", func(w http.ResponseWriter, r *http.Request) {
-		full := s3.JoinPath(prefix, "/data"+r.URL.Path)
-		s3.ProxyS3(w, r, s3Client, cfg, full, log)
+	log, err := logger.New(cfg.LogBackend, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logging: %v\n", err)
+		os.Exit(1)
+	}
+	var logSinks []io.WriteCloser
+	if cfg.CloudWatchLogGroup != "" {
+		awsCfg, err := s3.LoadAWSConfig(cfg, log)
+		if err != nil {
+			log.Fatalf("cloudwatch logs: %v", err)
+		}
+		cw, err := cwlogs.New(context.Background(), awsCfg, cfg.CloudWatchLogGroup, cfg.CloudWatchLogStream, cfg.CloudWatchFlushInterval)
+		if err != nil {
+			log.Fatalf("cloudwatch logs: %v", err)
+		}
+		logSinks = append(logSinks, cw)
+	}
+	logOutput, closeLogs, err := logger.NewOutput(logger.OutputOptions{
+		File: logger.FileOptions{
+			Path:       cfg.LogFile,
+			MaxSizeMB:  cfg.LogFileMaxSizeMB,
+			MaxAgeDays: cfg.LogFileMaxAgeDays,
+			MaxBackups: cfg.LogFileMaxBackups,
+			Compress:   cfg.LogFileCompress,
+		},
+		Syslog:       logger.SyslogOptions{Address: cfg.SyslogAddress, Facility: cfg.SyslogFacility, Tag: cfg.SyslogTag},
+		Sinks:        logSinks,
+		RedactParams: slices.Concat(logger.DefaultRedactedParams, cfg.LogRedactParams),
 	})
+	if err != nil {
+		log.Fatalf("log output: %v", err)
+	}
+	defer closeLogs()
+	log.SetOutput(logOutput)
 
-	// fallback: prepend {prefix}/data
-	r.MethodFunc(http.MethodGet, "/*", func(w http.ResponseWriter, r *http.Request) {
-		full := s3.JoinPath(prefix, "/data"+r.URL.Path)
-		s3.ProxyS3(w, r, s3Client, cfg, full, log)
-	})
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "seed":
+			if err := seed(cfg, log, os.Args[2:]); err != nil {
+				log.Fatalf("seed: %v", err)
+			}
+			return
+		case "serve-static":
+			stop, err := staticUpstream(&cfg, log, os.Args[2:])
+			if errors.Is(err, flag.ErrHelp) {
+				return
+			}
+			if err != nil {
+				log.Fatalf("serve-static: %v", err)
+			}
+			defer stop()
+		case "bench":
+			if err := runBench(cfg, log, os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+				log.Fatalf("bench: %v", err)
+			}
+			return
+		case "explain":
+			if err := explain(cfg, os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+				log.Fatalf("explain: %v", err)
+			}
+			return
+		default:
+			log.Fatalf("unknown command %q, expected seed, serve-static, bench or explain", os.Args[1])
+		}
+	}
+	upstream := cfg.UpstreamURL
+	prefix := cfg.BucketPathPrefix
 
-	// Return 405 for unsupported methods on matched routes
-	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Allow", "GET, HEAD")
-		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
-	})
+	handler, err := proxy.NewHandler(cfg, nil, log)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer handler.Close()
 
 	srv := &http.Server{
-		Addr:              ":" + listen,
-		Handler:           r,
+		Handler:           handler,
 		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
 		ReadTimeout:       cfg.ReadTimeout,
 		WriteTimeout:      cfg.WriteTimeout,
 		IdleTimeout:       cfg.IdleTimeout,
+		ConnState:         metrics.ConnState,
 	}
 
 	certFile := cfg.TLSCertFile
 	keyFile := cfg.TLSKeyFile
-	log.Printf("proxy listening on :%s (tls=%v) -> %s (prefix=%s)", listen, certFile != "" && keyFile != "", upstream, prefix)
+	ln, err := listener(cfg)
+	if err != nil {
+		log.Fatalf("listen: %v", err)
+	}
+	log.Infof("proxy listening on %s (tls=%v) -> %s (prefix=%s)", ln.Addr(), certFile != "" && keyFile != "", upstream, prefix)
+	var metricsSrv *http.Server
+	if cfg.MetricsPort != "" {
+		metricsSrv = metrics.NewServer(":"+cfg.MetricsPort, cfg.ExpvarEnabled)
+		go func() {
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("metrics server error: %v", err)
+			}
+		}()
+		log.Infof("metrics listening on %s", metricsSrv.Addr)
+	}
 	interrupts := make(chan os.Signal, 1)
 	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
 		var err error
 		if certFile != "" && keyFile != "" {
-			err = srv.ListenAndServeTLS(certFile, keyFile)
+			err = srv.ServeTLS(ln, certFile, keyFile)
 		} else {
-			err = srv.ListenAndServe()
+			err = srv.Serve(ln)
 		}
 		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("server error: %v", err)
@@ -100,6 +155,9 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Printf("server shutdown error: %v", err)
+		log.Infof("server shutdown error: %v", err)
+	}
+	if metricsSrv != nil {
+		metricsSrv.Shutdown(ctx)
 	}
 }
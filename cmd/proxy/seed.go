@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/dirstore"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/s3"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// fixture is a sample app laid out like the bucket under BUCKET_PATH_PREFIX: the SPA
+// entrypoint, an app under data/, a manifest and the chrome navigation.
+//
+//go:embed fixture
+var fixture embed.FS
+
+// seed uploads a local directory, or the sample fixture when none is given, to the
+// bucket and prefix of BUCKET_PATH_PREFIX, so a fresh MinIO serves a working app.
+func seed(cfg config.FrontendAssetProxyConfig, log logger.Logger, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: frontend-asset-proxy seed [-to path] [dir]")
+		fmt.Fprintln(flags.Output(), "Uploads dir, or a sample app when omitted, under BUCKET_PATH_PREFIX.")
+		flags.PrintDefaults()
+	}
+	to := flags.String("to", "", "path under BUCKET_PATH_PREFIX to upload to, e.g. data/my-app")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	var files fs.FS
+	switch flags.NArg() {
+	case 0:
+		files, _ = fs.Sub(fixture, "fixture")
+	case 1:
+		files = os.DirFS(flags.Arg(0))
+	default:
+		flags.Usage()
+		return errors.New("at most one directory can be seeded")
+	}
+
+	bucket, prefix, _ := strings.Cut(strings.Trim(s3.JoinPath(cfg.BucketPathPrefix, *to), "/"), "/")
+	if bucket == "" {
+		return errors.New("BUCKET_PATH_PREFIX names no bucket")
+	}
+	ctx := context.Background()
+	client := s3.NewS3ClientFromConfig(cfg, log)
+	if err := ensureBucket(ctx, client, bucket, cfg.Region); err != nil {
+		return err
+	}
+	uploaded := 0
+	err := fs.WalkDir(files, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := files.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		key := path.Join(prefix, name)
+		if _, err := client.PutObject(ctx, &awss3.PutObjectInput{
+			Bucket:        aws.String(bucket),
+			Key:           aws.String(key),
+			Body:          f,
+			ContentLength: aws.Int64(info.Size()),
+			ContentType:   aws.String(dirstore.ContentType(name)),
+		}); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		log.Infof("seeded /%s/%s", bucket, key)
+		uploaded++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("seeded %d objects into /%s\n", uploaded, path.Join(bucket, prefix))
+	return nil
+}
+
+// ensureBucket creates bucket when it does not exist yet, as on a fresh MinIO.
+func ensureBucket(ctx context.Context, client *awss3.Client, bucket, region string) error {
+	_, err := client.HeadBucket(ctx, &awss3.HeadBucketInput{Bucket: aws.String(bucket)})
+	var notFound *types.NotFound
+	if !errors.As(err, &notFound) {
+		return err
+	}
+	in := &awss3.CreateBucketInput{Bucket: aws.String(bucket)}
+	// us-east-1 is the default location and must not be named
+	if region != "" && region != "us-east-1" {
+		in.CreateBucketConfiguration = &types.CreateBucketConfiguration{LocationConstraint: types.BucketLocationConstraint(region)}
+	}
+	if _, err := client.CreateBucket(ctx, in); err != nil {
+		return fmt.Errorf("create bucket %s: %w", bucket, err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/dirstore"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/s3"
+)
+
+// staticUpstream starts an object store on loopback answering from the directory given
+// to `serve-static`, and points cfg at it, so the proxy serves the directory through
+// the same routes, S3 client and middleware as a bucket. It returns a func stopping the
+// store.
+func staticUpstream(cfg *config.FrontendAssetProxyConfig, log logger.Logger, args []string) (func(), error) {
+	flags := flag.NewFlagSet("serve-static", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: frontend-asset-proxy serve-static [-at path] <dir>")
+		fmt.Fprintln(flags.Output(), "Serves dir as the bucket contents under BUCKET_PATH_PREFIX, with every other setting read from the environment.")
+		flags.PrintDefaults()
+	}
+	at := flags.String("at", "", "path under BUCKET_PATH_PREFIX the directory is served as, e.g. data/my-app")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return nil, errors.New("expected one directory")
+	}
+	dir := flags.Arg(0)
+	if info, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	bucketPath := s3.JoinPath(cfg.BucketPathPrefix, *at)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	store := &http.Server{Handler: dirstore.New(os.DirFS(dir), bucketPath), ReadHeaderTimeout: cfg.ReadHeaderTimeout}
+	go func() {
+		if err := store.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Errorf("serve-static: %v", err)
+		}
+	}()
+	cfg.UpstreamURL = "http://" + ln.Addr().String()
+	// The local store takes unsigned requests, and has nothing to record
+	cfg.AccessKeyID, cfg.SecretAccessKey = "", ""
+	cfg.S3RecordMode = ""
+	log.Infof("serving %s as %s", dir, bucketPath)
+	return func() { store.Close() }, nil
+}
@@ -0,0 +1,230 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/clientip"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/hotkeys"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/problem"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/release"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/signedcookie"
+	"github.com/go-chi/chi/v5"
+)
+
+// defaultGrantTTL is how long access grants last when the request does not say.
+const defaultGrantTTL = 24 * time.Hour
+
+// Auth protects the admin API. Requests must come from AllowedCIDRs, when set, and carry
+// "Authorization: Bearer <Token>" or the basic auth Username and Password, whichever
+// are configured.
+type Auth struct {
+	Token        string
+	Username     string
+	Password     string
+	AllowedCIDRs []netip.Prefix
+	Clients      clientip.Resolver
+}
+
+// Enabled reports whether credentials are configured; the admin API is never open.
+func (a Auth) Enabled() bool {
+	return a.Token != "" || (a.Username != "" && a.Password != "")
+}
+
+// NewRouter builds the admin API. Every endpoint requires the credentials of auth.
+// warmup, when non-nil, reloads the cache warmup list and returns the number of objects cached.
+// sampling, when non-nil, exposes the access log sampling rules for runtime changes.
+// hot, when non-nil, reports the most requested keys.
+// grants, when non-nil, issues access links to restricted prefixes.
+// purge, when non-nil, drops request paths and apps from the caches and returns the number
+// of objects dropped from the proxy's cache.
+func NewRouter(auth Auth, releases *release.Registry, warmup func(ctx context.Context) (int, error), purge func(ctx context.Context, paths, apps []string) (int, error), sampling *logger.Sampling, hot *hotkeys.Tracker, grants *signedcookie.Grants, log logger.Logger) http.Handler {
+	r := chi.NewRouter()
+	r.Use(requireAuth(auth))
+
+	r.Get("/releases", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, releases.Snapshot())
+	})
+
+	// POST /admin/releases/{app} {"live":"green"} flips the app's live release
+	r.Post("/releases/{app}", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Live string `json:"live"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil || body.Live == "" {
+			problem.Error(w, r, http.StatusBadRequest, "")
+			return
+		}
+		app := chi.URLParam(r, "app")
+		st, err := releases.Switch(r.Context(), app, body.Live)
+		if errors.Is(err, release.ErrUnknownApp) || errors.Is(err, release.ErrUnknownRelease) {
+			problem.Error(w, r, http.StatusNotFound, "")
+			return
+		}
+		if err != nil {
+			log.WithFields(logger.Fields{"process": "admin", "app": app}).Errorf("release switch: %v", err)
+			problem.Error(w, r, http.StatusBadGateway, "")
+			return
+		}
+		log.WithFields(logger.Fields{"process": "admin", "app": app, "live": st.Live, "previous": st.Previous}).Warnf("release switched")
+		writeJSON(w, http.StatusOK, st)
+	})
+
+	// POST /admin/cache/warmup re-runs the cache warmup, e.g. after a deploy
+	if warmup != nil {
+		r.Post("/cache/warmup", func(w http.ResponseWriter, r *http.Request) {
+			warmed, err := warmup(r.Context())
+			if err != nil {
+				log.WithFields(logger.Fields{"process": "admin"}).Errorf("cache warmup: %v", err)
+				problem.Error(w, r, http.StatusBadGateway, "")
+				return
+			}
+			log.WithFields(logger.Fields{"process": "admin", "warmed": warmed}).Infof("cache warmed")
+			writeJSON(w, http.StatusOK, map[string]int{"warmed": warmed})
+		})
+	}
+
+	// POST /admin/cache/purge {"paths":["/apps/chrome/index.html"],"apps":["chrome"]} drops
+	// the paths and everything of the apps from the object cache and the CDN
+	if purge != nil {
+		r.Post("/cache/purge", func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				Paths []string `json:"paths"`
+				Apps  []string `json:"apps"`
+			}
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil || len(body.Paths) == 0 && len(body.Apps) == 0 {
+				problem.Error(w, r, http.StatusBadRequest, "")
+				return
+			}
+			for _, p := range body.Paths {
+				if !strings.HasPrefix(p, "/") {
+					problem.Error(w, r, http.StatusBadRequest, "paths must start with /")
+					return
+				}
+			}
+			purged, err := purge(r.Context(), body.Paths, body.Apps)
+			fields := logger.Fields{"process": "admin", "paths": len(body.Paths), "apps": body.Apps, "purged": purged}
+			if err != nil {
+				log.WithFields(fields).Errorf("cache purge: %v", err)
+				problem.Error(w, r, http.StatusBadGateway, "CDN purge failed")
+				return
+			}
+			log.WithFields(fields).Infof("cache purged")
+			writeJSON(w, http.StatusOK, map[string]int{"purged": purged})
+		})
+	}
+
+	if sampling != nil {
+		r.Get("/accesslog", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, sampling.Rules())
+		})
+
+		// PUT /admin/accesslog {"rates":{"2xx":0.01},"exclude":["/healthz"]} replaces the sampling rules
+		r.Put("/accesslog", func(w http.ResponseWriter, r *http.Request) {
+			var rules logger.SamplingRules
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&rules); err != nil {
+				problem.Error(w, r, http.StatusBadRequest, "")
+				return
+			}
+			if err := sampling.Set(rules); err != nil {
+				problem.Error(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			log.WithFields(logger.Fields{"process": "admin", "rates": rules.Rates, "exclude": rules.Exclude}).Warnf("access log sampling changed")
+			writeJSON(w, http.StatusOK, sampling.Rules())
+		})
+	}
+
+	// GET /admin/hotkeys?n=20 lists the most requested keys with their hits and bytes
+	if hot != nil {
+		r.Get("/hotkeys", func(w http.ResponseWriter, r *http.Request) {
+			n := 20
+			if v := r.URL.Query().Get("n"); v != "" {
+				var err error
+				if n, err = strconv.Atoi(v); err != nil || n < 1 {
+					problem.Error(w, r, http.StatusBadRequest, "")
+					return
+				}
+			}
+			writeJSON(w, http.StatusOK, map[string][]hotkeys.Key{"keys": hot.Top(n)})
+		})
+	}
+
+	// POST /admin/grants {"prefix":"/apps/embargoed","ttl":"72h"} issues an access link to
+	// a restricted prefix
+	if grants != nil {
+		r.Post("/grants", func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				Prefix string          `json:"prefix"`
+				TTL    config.Duration `json:"ttl"`
+			}
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil {
+				problem.Error(w, r, http.StatusBadRequest, "")
+				return
+			}
+			if body.TTL == 0 {
+				body.TTL = config.Duration(defaultGrantTTL)
+			}
+			grant, token, err := grants.Issue(body.Prefix, time.Duration(body.TTL))
+			if err != nil {
+				problem.Error(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			log.WithFields(logger.Fields{"process": "admin", "prefix": grant.Prefix, "expires": grant.Expires}).Warnf("access grant issued")
+			writeJSON(w, http.StatusOK, map[string]any{
+				"prefix":  grant.Prefix,
+				"expires": time.Unix(grant.Expires, 0).UTC(),
+				"url":     grants.RedeemPath + "?" + url.Values{"token": {token}}.Encode(),
+			})
+		})
+	}
+
+	return r
+}
+
+// requireAuth rejects requests from outside the allowed networks with 403 and requests
+// without matching credentials with 401.
+func requireAuth(auth Auth) func(http.Handler) http.Handler {
+	bearer := []byte("Bearer " + auth.Token)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(auth.AllowedCIDRs) > 0 && !clientip.Contains(auth.AllowedCIDRs, auth.Clients.ClientIP(r)) {
+				problem.Error(w, r, http.StatusForbidden, "")
+				return
+			}
+			ok := auth.Token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), bearer) == 1
+			if !ok && auth.Username != "" && auth.Password != "" {
+				user, pass, basic := r.BasicAuth()
+				// Both are compared so a wrong username takes as long as a wrong password
+				userOK := subtle.ConstantTimeCompare([]byte(user), []byte(auth.Username)) == 1
+				passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(auth.Password)) == 1
+				ok = basic && userOK && passOK
+				if !ok {
+					w.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+				}
+			}
+			if !ok {
+				problem.Error(w, r, http.StatusUnauthorized, "")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,85 @@
+package admin
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/clientip"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/problem"
+)
+
+// DeploySignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the deploy hook body.
+const DeploySignatureHeader = "X-Deploy-Signature"
+
+// maxDeploySkew is how far a deploy payload's timestamp may be from now, so captured
+// payloads cannot be replayed later.
+const maxDeploySkew = 5 * time.Minute
+
+// Deploy is the payload of the deploy hook, sent after an app's build was uploaded.
+type Deploy struct {
+	App     string `json:"app"`
+	Release string `json:"release"`
+	// Timestamp is the Unix time the payload was signed at.
+	Timestamp int64 `json:"timestamp"`
+	// Warmup loads the app's assets from the warmup list into the cache.
+	Warmup bool `json:"warmup,omitempty"`
+}
+
+// DeployResult reports what the deploy hook did.
+type DeployResult struct {
+	App     string `json:"app"`
+	Release string `json:"release"`
+	Purged  int    `json:"purged"`
+	Warmed  int    `json:"warmed"`
+}
+
+// DeployHook handles POST /admin/deploy-hook: a payload signed with secret (see
+// DeploySignatureHeader) runs deploy for the app it names, so a push pipeline needs a
+// single call after uploading a build. Requests must come from auth's AllowedCIDRs when
+// set; the signature replaces the admin credentials.
+func DeployHook(auth Auth, secret string, deploy func(ctx context.Context, d Deploy) (DeployResult, error), log logger.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(auth.AllowedCIDRs) > 0 && !clientip.Contains(auth.AllowedCIDRs, auth.Clients.ClientIP(r)) {
+			problem.Error(w, r, http.StatusForbidden, "")
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 4096))
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, "")
+			return
+		}
+		sig, _ := hex.DecodeString(strings.TrimPrefix(r.Header.Get(DeploySignatureHeader), "sha256="))
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			problem.Error(w, r, http.StatusUnauthorized, "")
+			return
+		}
+		var d Deploy
+		if err := json.Unmarshal(body, &d); err != nil || d.App == "" || strings.Contains(d.App, "/") {
+			problem.Error(w, r, http.StatusBadRequest, "")
+			return
+		}
+		if skew := time.Since(time.Unix(d.Timestamp, 0)); skew > maxDeploySkew || skew < -maxDeploySkew {
+			problem.Error(w, r, http.StatusUnauthorized, "timestamp outside the accepted window")
+			return
+		}
+		res, err := deploy(r.Context(), d)
+		fields := logger.Fields{"process": "admin", "app": d.App, "release": d.Release, "purged": res.Purged, "warmed": res.Warmed}
+		if err != nil {
+			log.WithFields(fields).Errorf("deploy hook: %v", err)
+			problem.Error(w, r, http.StatusBadGateway, "")
+			return
+		}
+		log.WithFields(fields).Infof("deploy hook handled")
+		writeJSON(w, http.StatusOK, res)
+	}
+}
@@ -0,0 +1,250 @@
+// Package bench replays recorded requests against the proxy at a fixed rate and
+// summarizes latencies and errors, to compare the performance of releases.
+package bench
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request is one replayed request.
+type Request struct {
+	Method string
+	URI    string
+}
+
+// requestLine finds the request line in access logs: the proxy's default format, the
+// common and combined formats, and the JSON encoding of either, where quotes are escaped.
+var requestLine = regexp.MustCompile(`\\?"([A-Z]+) (\S+) HTTP/[0-9.]+\\?"`)
+
+// ParseRequests reads one request per line: an access log line, "/path" or
+// "METHOD /path". Only GET and HEAD requests are replayed; skipped counts the other
+// lines that were not empty.
+func ParseRequests(r io.Reader) (reqs []Request, skipped int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		req, ok := parseLine(line)
+		if !ok || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+			skipped++
+			continue
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, skipped, scanner.Err()
+}
+
+func parseLine(line string) (Request, bool) {
+	var req Request
+	if m := requestLine.FindStringSubmatch(line); m != nil {
+		req = Request{Method: m[1], URI: m[2]}
+	} else if method, uri, ok := strings.Cut(line, " "); ok && !strings.Contains(uri, " ") {
+		req = Request{Method: strings.ToUpper(method), URI: uri}
+	} else {
+		req = Request{Method: http.MethodGet, URI: line}
+	}
+	// The default access log has absolute URLs; only the path and query are replayed
+	u, err := url.Parse(req.URI)
+	if err != nil || !strings.HasPrefix(u.RequestURI(), "/") {
+		return Request{}, false
+	}
+	req.URI = u.RequestURI()
+	return req, true
+}
+
+// Options controls a run.
+type Options struct {
+	// Target is the base URL requests are sent to, e.g. http://localhost:8080.
+	Target string
+	// RPS is the rate requests are started at, regardless of how fast they complete.
+	RPS float64
+	// Duration bounds the run; Requests, when set, ends it after that many requests.
+	Duration time.Duration
+	Requests int
+	// Concurrency caps requests in flight; requests due while at the cap are dropped
+	// rather than delayed, so a slow proxy cannot lower the offered rate.
+	Concurrency int
+	// Header is added to every request.
+	Header http.Header
+}
+
+// Result summarizes a run.
+type Result struct {
+	Requests  int            `json:"requests"`
+	Errors    int            `json:"errors"`
+	ErrorRate float64        `json:"error_rate"`
+	Dropped   int            `json:"dropped"`
+	Statuses  map[string]int `json:"statuses"`
+	Elapsed   time.Duration  `json:"elapsed_ns"`
+	RPS       float64        `json:"achieved_rps"`
+	Bytes     int64          `json:"bytes"`
+	Latency   Latency        `json:"latency_ms"`
+}
+
+// Latency holds latency percentiles in milliseconds.
+type Latency struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// Run replays reqs in order, starting over when they run out, until ctx is done or the
+// duration or request count is reached. Requests failing to complete and 5xx responses
+// count as errors.
+func Run(ctx context.Context, client *http.Client, reqs []Request, opts Options) (Result, error) {
+	if len(reqs) == 0 {
+		return Result{}, errors.New("no requests to replay")
+	}
+	if opts.RPS <= 0 {
+		return Result{}, errors.New("rate must be positive")
+	}
+	target := strings.TrimSuffix(opts.Target, "/")
+	if opts.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		latencies []time.Duration
+		res       = Result{Statuses: map[string]int{}}
+	)
+	inflight := make(chan struct{}, max(opts.Concurrency, 1))
+	interval := time.Duration(float64(time.Second) / opts.RPS)
+	start := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+loop:
+	for i := 0; opts.Requests == 0 || i < opts.Requests; i++ {
+		// Requests are scheduled from the start time, so a late tick does not slow the rate
+		timer.Reset(time.Until(start.Add(time.Duration(i) * interval)))
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-timer.C:
+		}
+		select {
+		case inflight <- struct{}{}:
+		default:
+			res.Dropped++
+			continue
+		}
+		req := reqs[i%len(reqs)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inflight }()
+			status, n, elapsed, err := send(client, target, req, opts.Header)
+			mu.Lock()
+			defer mu.Unlock()
+			res.Requests++
+			res.Bytes += n
+			if err != nil {
+				res.Errors++
+				res.Statuses["error"]++
+				return
+			}
+			if status >= http.StatusInternalServerError {
+				res.Errors++
+			}
+			res.Statuses[fmt.Sprint(status)]++
+			latencies = append(latencies, elapsed)
+		}()
+	}
+	wg.Wait()
+	res.Elapsed = time.Since(start)
+	if res.Requests > 0 {
+		res.ErrorRate = float64(res.Errors) / float64(res.Requests)
+		res.RPS = float64(res.Requests) / res.Elapsed.Seconds()
+	}
+	res.Latency = percentiles(latencies)
+	return res, nil
+}
+
+// send runs req and reads the whole body, as latency includes the transfer.
+func send(client *http.Client, target string, req Request, header http.Header) (int, int64, time.Duration, error) {
+	r, err := http.NewRequest(req.Method, target+req.URI, nil)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	start := time.Now()
+	resp, err := client.Do(r)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer resp.Body.Close()
+	n, err := io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, n, time.Since(start), err
+}
+
+func percentiles(latencies []time.Duration) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+	slices.Sort(latencies)
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	at := func(p float64) float64 { return ms(latencies[int(p*float64(len(latencies)-1))]) }
+	var sum time.Duration
+	for _, l := range latencies {
+		sum += l
+	}
+	return Latency{
+		Min:  ms(latencies[0]),
+		Mean: ms(sum / time.Duration(len(latencies))),
+		P50:  at(0.50),
+		P90:  at(0.90),
+		P95:  at(0.95),
+		P99:  at(0.99),
+		Max:  ms(latencies[len(latencies)-1]),
+	}
+}
+
+// WriteText writes res as a human readable report.
+func WriteText(w io.Writer, res Result) {
+	fmt.Fprintf(w, "requests:  %d in %s (%.1f/s), %d dropped at the concurrency cap\n", res.Requests, res.Elapsed.Round(time.Millisecond), res.RPS, res.Dropped)
+	fmt.Fprintf(w, "errors:    %d (%.2f%%)\n", res.Errors, res.ErrorRate*100)
+	fmt.Fprintf(w, "received:  %d bytes\n", res.Bytes)
+	l := res.Latency
+	fmt.Fprintf(w, "latency:   min %.2fms  mean %.2fms  p50 %.2fms  p90 %.2fms  p95 %.2fms  p99 %.2fms  max %.2fms\n", l.Min, l.Mean, l.P50, l.P90, l.P95, l.P99, l.Max)
+	statuses := make([]string, 0, len(res.Statuses))
+	for status := range res.Statuses {
+		statuses = append(statuses, status)
+	}
+	slices.Sort(statuses)
+	fmt.Fprint(w, "statuses: ")
+	for _, status := range statuses {
+		fmt.Fprintf(w, " %s=%d", status, res.Statuses[status])
+	}
+	fmt.Fprintln(w)
+}
+
+// WriteJSON writes res as JSON, for comparing runs in scripts.
+func WriteJSON(w io.Writer, res Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(res)
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache is an LRU cache bounded by the total size of its values. Entries expire ttl after
+// they were stored. It is safe for concurrent use.
+type Cache[V any] struct {
+	maxBytes int64
+	ttl      time.Duration
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	used  int64
+}
+
+type entry[V any] struct {
+	key    string
+	value  V
+	size   int64
+	stored time.Time
+}
+
+// New returns a cache holding at most maxBytes of values, each for at most ttl.
+func New[V any](maxBytes int64, ttl time.Duration) *Cache[V] {
+	return &Cache[V]{maxBytes: maxBytes, ttl: ttl, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+// Get returns the value stored for key and when it was stored.
+func (c *Cache[V]) Get(key string) (value V, stored time.Time, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return value, stored, false
+	}
+	e := el.Value.(*entry[V])
+	if time.Since(e.stored) > c.ttl {
+		c.remove(el)
+		return value, stored, false
+	}
+	c.ll.MoveToFront(el)
+	return e.value, e.stored, true
+}
+
+// Add stores value of the given size under key, evicting the least recently used
+// entries to make room. Values larger than the cache are not stored.
+func (c *Cache[V]) Add(key string, value V, size int64) {
+	if size > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	c.items[key] = c.ll.PushFront(&entry[V]{key: key, value: value, size: size, stored: time.Now()})
+	c.used += size
+	for c.used > c.maxBytes {
+		c.remove(c.ll.Back())
+	}
+}
+
+// RemoveFunc removes the entries whose key matches and returns how many it removed.
+func (c *Cache[V]) RemoveFunc(match func(key string) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for key, el := range c.items {
+		if match(key) {
+			c.remove(el)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Len returns the number of cached entries.
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Bytes returns the total size of cached values.
+func (c *Cache[V]) Bytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.used
+}
+
+func (c *Cache[V]) remove(el *list.Element) {
+	e := el.Value.(*entry[V])
+	c.ll.Remove(el)
+	delete(c.items, e.key)
+	c.used -= e.size
+}
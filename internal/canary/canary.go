@@ -0,0 +1,63 @@
+package canary
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strings"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/vary"
+)
+
+const (
+	Stable = "stable"
+	Canary = "canary"
+
+	// cookieMaxAge keeps a client on the same variant for a day so an app's
+	// index.html and its chunks are always served from the same release.
+	cookieMaxAge = 24 * 60 * 60
+)
+
+// CookieName returns the sticky assignment cookie for a route prefix, e.g. "/apps/chrome" -> "canary-apps-chrome".
+func CookieName(prefix string) string {
+	name := strings.Trim(strings.ReplaceAll(prefix, "/", "-"), "-")
+	if name == "" {
+		name = "root"
+	}
+	return "canary-" + name
+}
+
+// Choose picks the variant for r. An explicit opt-in header wins, then a previous
+// sticky assignment; otherwise the client is assigned by percentage and the
+// assignment is persisted in a cookie scoped to the route prefix.
+func Choose(w http.ResponseWriter, r *http.Request, prefix string, rule *config.CanaryRule) string {
+	vary.Add(w.Header(), rule.Header, "Cookie")
+	if rule.Header != "" {
+		switch strings.ToLower(r.Header.Get(rule.Header)) {
+		case "true":
+			return Canary
+		case "false":
+			return Stable
+		}
+	}
+
+	name := CookieName(prefix)
+	if c, err := r.Cookie(name); err == nil && (c.Value == Canary || c.Value == Stable) {
+		return c.Value
+	}
+
+	variant := Stable
+	if rule.Percent > 0 && rand.Float64()*100 < rule.Percent {
+		variant = Canary
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    variant,
+		Path:     prefix,
+		MaxAge:   cookieMaxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return variant
+}
@@ -0,0 +1,148 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/metrics"
+)
+
+// maxPurgeBody is the Fast Purge API's limit on the size of a request body.
+const maxPurgeBody = 50_000
+
+// AkamaiConfig configures Fast Purge API (CCU v3) calls with EdgeGrid API client
+// credentials.
+type AkamaiConfig struct {
+	// Host is the API client's host, e.g. "akab-xxxx.purge.akamaiapis.net".
+	Host         string
+	ClientToken  string
+	ClientSecret string
+	AccessToken  string
+	// Network is "production" or "staging".
+	Network string
+	// BaseURL is the public origin of the proxied assets, e.g. "https://console.redhat.com";
+	// purged request paths are appended to it.
+	BaseURL string
+}
+
+// Akamai invalidates content on the Akamai edge through the Fast Purge API.
+type Akamai struct {
+	cfg    AkamaiConfig
+	client *http.Client
+}
+
+// NewAkamai returns an Akamai purger for cfg.
+func NewAkamai(cfg AkamaiConfig) (*Akamai, error) {
+	if cfg.Host == "" || cfg.ClientToken == "" || cfg.ClientSecret == "" || cfg.AccessToken == "" {
+		return nil, errors.New("akamai: host, client token, client secret and access token are required")
+	}
+	if cfg.BaseURL == "" {
+		return nil, errors.New("akamai: base URL is required")
+	}
+	if cfg.Network == "" {
+		cfg.Network = "production"
+	}
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	return &Akamai{cfg: cfg, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+// Purge invalidates the public URLs of the request paths, and every object tagged with
+// one of the apps (see CACHE_TAG_HEADERS, which must include Edge-Cache-Tag).
+func (a *Akamai) Purge(ctx context.Context, paths, apps []string) error {
+	urls := make([]string, len(paths))
+	for i, p := range paths {
+		urls[i] = a.cfg.BaseURL + p
+	}
+	err := a.invalidate(ctx, "url", urls)
+	if tagErr := a.invalidate(ctx, "tag", apps); tagErr != nil {
+		err = errors.Join(err, tagErr)
+	}
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	metrics.CDNPurgesTotal.WithLabelValues("akamai", outcome).Inc()
+	return err
+}
+
+// invalidate posts objects to the invalidate endpoint of kind ("url" or "tag") in
+// batches that fit the request size limit.
+func (a *Akamai) invalidate(ctx context.Context, kind string, objects []string) error {
+	for len(objects) > 0 {
+		n, size := 0, 0
+		// Each object adds its quotes and a comma to the {"objects":[...]} body
+		for n < len(objects) && (n == 0 || size+len(objects[n])+3 <= maxPurgeBody-len(`{"objects":[]}`)) {
+			size += len(objects[n]) + 3
+			n++
+		}
+		if err := a.post(ctx, "/ccu/v3/invalidate/"+kind+"/"+a.cfg.Network, objects[:n]); err != nil {
+			return fmt.Errorf("akamai %s purge: %w", kind, err)
+		}
+		objects = objects[n:]
+	}
+	return nil
+}
+
+func (a *Akamai) post(ctx context.Context, path string, objects []string) error {
+	body, err := json.Marshal(map[string][]string{"objects": objects})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+a.cfg.Host+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", a.authorization(req, body, time.Now()))
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		var problem struct {
+			Detail string `json:"detail"`
+		}
+		_ = json.NewDecoder(http.MaxBytesReader(nil, resp.Body, 1<<16)).Decode(&problem)
+		return fmt.Errorf("%s: %s", resp.Status, problem.Detail)
+	}
+	return nil
+}
+
+// authorization signs req with the EdgeGrid EG1-HMAC-SHA256 scheme.
+func (a *Akamai) authorization(req *http.Request, body []byte, now time.Time) string {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	timestamp := now.UTC().Format("20060102T15:04:05+0000")
+	header := "EG1-HMAC-SHA256 client_token=" + a.cfg.ClientToken + ";access_token=" + a.cfg.AccessToken +
+		";timestamp=" + timestamp + ";nonce=" + hex.EncodeToString(nonce) + ";"
+	contentHash := sha256.Sum256(body)
+	data := strings.Join([]string{
+		req.Method,
+		req.URL.Scheme,
+		req.URL.Host,
+		req.URL.RequestURI(),
+		"", // no signed headers
+		base64.StdEncoding.EncodeToString(contentHash[:]),
+		header,
+	}, "\t")
+	signingKey := base64.StdEncoding.EncodeToString(hmacSHA256([]byte(a.cfg.ClientSecret), timestamp))
+	return header + "signature=" + base64.StdEncoding.EncodeToString(hmacSHA256([]byte(signingKey), data))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,10 @@
+package cdn
+
+import "context"
+
+// Purger invalidates content cached at a CDN edge.
+type Purger interface {
+	// Purge invalidates the request paths and everything of the apps, the path segments
+	// following one of CACHE_TAG_PREFIXES.
+	Purge(ctx context.Context, paths, apps []string) error
+}
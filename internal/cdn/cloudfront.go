@@ -0,0 +1,152 @@
+package cdn
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/metrics"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+)
+
+// maxWildcardPaths is CloudFront's quota of wildcard paths in progress per distribution.
+const maxWildcardPaths = 15
+
+// CloudFrontConfig configures invalidations of a CloudFront distribution.
+type CloudFrontConfig struct {
+	DistributionID string
+	// AppPrefixes are the prefixes apps are invalidated under, as "<prefix>/<app>/*".
+	AppPrefixes []string
+	// Interval is how often queued paths are sent as one invalidation.
+	Interval time.Duration
+	// MaxPaths is the most paths sent in one invalidation; larger batches invalidate "/*"
+	// instead, which CloudFront counts as a single path.
+	MaxPaths int
+}
+
+// CloudFront invalidates paths of a CloudFront distribution. Purged paths are queued and
+// sent as a single CreateInvalidation every interval, so bursts of purges stay within
+// the distribution's invalidation quotas; failed batches are retried with the next one.
+type CloudFront struct {
+	client *cloudfront.Client
+	cfg    CloudFrontConfig
+	log    logger.Logger
+
+	mu      sync.Mutex
+	pending map[string]struct{}
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewCloudFront starts sending the invalidations of the distribution in cfg.
+func NewCloudFront(awsCfg aws.Config, cfg CloudFrontConfig, log logger.Logger) *CloudFront {
+	c := &CloudFront{
+		client:  cloudfront.NewFromConfig(awsCfg),
+		cfg:     cfg,
+		log:     log,
+		pending: map[string]struct{}{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// Purge queues the paths and the apps' paths for the next invalidation. It does not
+// wait for CloudFront, so it only fails on invalid input.
+func (c *CloudFront) Purge(_ context.Context, paths, apps []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, p := range paths {
+		c.pending[p] = struct{}{}
+	}
+	for _, app := range apps {
+		if app == "" || strings.Contains(app, "/") {
+			return fmt.Errorf("cloudfront: invalid app %q", app)
+		}
+		for _, prefix := range c.cfg.AppPrefixes {
+			c.pending[strings.TrimSuffix(prefix, "/")+"/"+app+"/*"] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// Close sends the queued paths and stops sending invalidations.
+func (c *CloudFront) Close() {
+	close(c.stop)
+	<-c.done
+}
+
+func (c *CloudFront) run() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.stop:
+			c.flush()
+			return
+		}
+		c.flush()
+	}
+}
+
+// flush sends the queued paths as one invalidation, collapsed to "/*" when they exceed
+// the path or wildcard quotas. They stay queued when it fails.
+func (c *CloudFront) flush() {
+	c.mu.Lock()
+	queued := make([]string, 0, len(c.pending))
+	for p := range c.pending {
+		queued = append(queued, p)
+	}
+	c.mu.Unlock()
+	if len(queued) == 0 {
+		return
+	}
+	slices.Sort(queued)
+	paths := queued
+	wildcards := 0
+	for _, p := range paths {
+		if strings.HasSuffix(p, "*") {
+			wildcards++
+		}
+	}
+	if len(paths) > c.cfg.MaxPaths || wildcards > maxWildcardPaths {
+		paths = []string{"/*"}
+	}
+
+	ref := make([]byte, 8)
+	rand.Read(ref)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err := c.client.CreateInvalidation(ctx, &cloudfront.CreateInvalidationInput{
+		DistributionId: aws.String(c.cfg.DistributionID),
+		InvalidationBatch: &types.InvalidationBatch{
+			CallerReference: aws.String(time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(ref)),
+			Paths:           &types.Paths{Quantity: aws.Int32(int32(len(paths))), Items: paths},
+		},
+	})
+	fields := logger.Fields{"process": "cloudfront", "distribution": c.cfg.DistributionID, "paths": len(paths), "queued": len(queued)}
+	if err != nil {
+		metrics.CDNPurgesTotal.WithLabelValues("cloudfront", "error").Inc()
+		c.log.WithFields(fields).Errorf("invalidation failed, retrying with the next batch: %v", err)
+		return
+	}
+	metrics.CDNPurgesTotal.WithLabelValues("cloudfront", "ok").Inc()
+	c.log.WithFields(fields).Infof("invalidation created")
+	c.mu.Lock()
+	for _, p := range queued {
+		delete(c.pending, p)
+	}
+	c.mu.Unlock()
+}
@@ -0,0 +1,90 @@
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParseCIDRs parses CIDR blocks or bare IP addresses (treated as single-host prefixes).
+func ParseCIDRs(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP %q: %w", v, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", v, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Contains reports whether addr falls within any of prefixes.
+func Contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromRequest returns the address of the peer that sent r.
+func FromRequest(r *http.Request) netip.Addr {
+	host := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	addr, _ := netip.ParseAddr(host)
+	return addr.Unmap()
+}
+
+// Resolver determines the client address of a request, honoring X-Forwarded-For only
+// when the request arrived through a trusted proxy.
+type Resolver struct {
+	// Trusted are the networks of proxies (load balancers, ingress) allowed to set X-Forwarded-For.
+	Trusted []netip.Prefix
+}
+
+// TrustedPeer reports whether r arrived directly from a trusted proxy, so headers that
+// proxy sets, such as x-rh-identity, can be believed.
+func (res Resolver) TrustedPeer(r *http.Request) bool {
+	return Contains(res.Trusted, FromRequest(r))
+}
+
+// ClientIP returns the client address of r. Starting from the peer, it walks X-Forwarded-For
+// from right to left while the current hop is a trusted proxy; the first untrusted hop is the
+// client. Without trusted proxies this is the peer address.
+func (res Resolver) ClientIP(r *http.Request) netip.Addr {
+	addr := FromRequest(r)
+	if len(res.Trusted) == 0 || !Contains(res.Trusted, addr) {
+		return addr
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !Contains(res.Trusted, addr) {
+			break
+		}
+	}
+	return addr
+}
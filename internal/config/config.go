@@ -1,7 +1,11 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"os"
+	"path"
 	"strconv"
 	"time"
 
@@ -10,10 +14,295 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 )
 
+// RouteRule maps requests under Prefix to BucketPath in object storage.
+type RouteRule struct {
+	// Prefix is the request path prefix, e.g. "/apps/chrome". "/" matches everything.
+	Prefix string `json:"prefix"`
+	// BucketPath is "/bucket[/prefix]"; its first segment is treated as the bucket.
+	BucketPath string `json:"bucketPath"`
+	// StripPrefix removes Prefix from the request path before it is joined to BucketPath.
+	StripPrefix bool `json:"stripPrefix"`
+	// Immutable serves content-addressed snapshots: the first path segment after Prefix must be
+	// a git commit SHA and hits are cached as "public, max-age=31536000, immutable".
+	Immutable bool `json:"immutable,omitempty"`
+	// BaseHref rewrites the href of the <base> element in served HTML, so assets built for
+	// one mount point can be served under another route.
+	BaseHref string `json:"baseHref,omitempty"`
+	// PublicPath replaces a build-time public path inside HTML and JavaScript entrypoints.
+	PublicPath *PathRewrite `json:"publicPath,omitempty"`
+	// Host restricts the rule to requests for this Host header (without port). Empty matches any host.
+	Host string `json:"host,omitempty"`
+	// Name identifies the rule for admin operations, e.g. "chrome".
+	Name string `json:"name,omitempty"`
+	// Releases maps release names (e.g. "blue", "green") to bucket paths. When set, the
+	// live release's bucket path is served instead of BucketPath and can be flipped via the admin API.
+	Releases map[string]string `json:"releases,omitempty"`
+	// Live is the release served at startup.
+	Live string `json:"live,omitempty"`
+	// VersionMap is the bucket path of a JSON object mapping S3 keys to the VersionId that
+	// makes up the pinned release, e.g. "/frontend-assets/releases/chrome.json".
+	VersionMap string `json:"versionMap,omitempty"`
+	// Canary optionally routes a share of this rule's traffic to an alternate bucket path.
+	Canary *CanaryRule `json:"canary,omitempty"`
+	// EarlyHints sends 103 Early Hints preloading the listed assets before HTML navigations.
+	EarlyHints *EarlyHintsRule `json:"earlyHints,omitempty"`
+	// Links are resource hints sent as Link headers on the rule's HTML responses, so
+	// platform-wide preloads and preconnects live in proxy config rather than every app's HTML.
+	Links []LinkHeader `json:"links,omitempty"`
+	// Extensions, when set, is the allowlist of servable file extensions without the dot,
+	// e.g. ["js", "css", "html"]. Other requests get 404 without contacting S3.
+	Extensions []string `json:"extensions,omitempty"`
+	// Timeout overrides S3_GET_TIMEOUT for the rule, e.g. "2s" for manifests that should
+	// fail fast or "60s" for large bundles.
+	Timeout Duration `json:"timeout,omitempty"`
+	// WriteTimeout overrides WRITE_TIMEOUT for the rule's responses.
+	WriteTimeout Duration `json:"writeTimeout,omitempty"`
+	// RequireIdentity overrides REQUIRE_IDENTITY for the rule: requests without a valid
+	// x-rh-identity header are rejected with 401.
+	RequireIdentity *bool `json:"requireIdentity,omitempty"`
+	// AllowCIDRs, when set, restricts the rule to clients from these networks (CIDRs or
+	// IPs), e.g. cluster-internal callers for /manifests. Others get 403.
+	AllowCIDRs []string `json:"allowCIDRs,omitempty"`
+	// DenyCIDRs rejects clients from these networks with 403, even when AllowCIDRs matches.
+	DenyCIDRs []string `json:"denyCIDRs,omitempty"`
+	// Presign redirects requests to short-lived presigned object storage URLs instead of
+	// streaming the objects through the proxy.
+	Presign *PresignRule `json:"presign,omitempty"`
+	// TrailingSlash redirects extensionless paths under the rule (301) to one canonical
+	// form: "add" sends /apps/foo to /apps/foo/, "remove" sends /apps/foo/ to /apps/foo.
+	// Empty serves both forms.
+	TrailingSlash string `json:"trailingSlash,omitempty"`
+	// SurrogateControl overrides SURROGATE_CONTROL for the rule's responses.
+	SurrogateControl string `json:"surrogateControl,omitempty"`
+	// CacheTags are added to the CACHE_TAG_HEADERS of the rule's responses, e.g. ["chrome"].
+	CacheTags []string `json:"cacheTags,omitempty"`
+	// Key is an expression computing the object path under the bucket path instead of the
+	// request path, e.g. `"data/" + app + "/" + hash(path)`.
+	Key string `json:"key,omitempty"`
+	// ResponseHeaders add and remove headers of the rule's responses, applied in order.
+	ResponseHeaders []ResponseHeaderRule `json:"responseHeaders,omitempty"`
+	// UpstreamHeaders replaces UPSTREAM_HEADERS for the rule, e.g. ["Content-Type",
+	// "Content-MD5", "X-Amz-Meta-*"].
+	UpstreamHeaders []string `json:"upstreamHeaders,omitempty"`
+	// UpstreamHeadersDeny are object headers never passed through for the rule, e.g. ["ETag"].
+	UpstreamHeadersDeny []string `json:"upstreamHeadersDeny,omitempty"`
+}
+
+// ResponseHeaderRule sets and removes response headers, e.g.
+// {"contentTypes":["text/html"],"set":{"X-Frame-Options":"DENY"}} or {"remove":["x-amz-*"]}.
+type ResponseHeaderRule struct {
+	// Set adds headers, replacing any value from the object.
+	Set map[string]string `json:"set,omitempty"`
+	// Remove drops headers by name; a trailing "*" matches a name prefix.
+	Remove []string `json:"remove,omitempty"`
+	// ContentTypes restricts the rule to responses of these media types, e.g. "text/html"
+	// or "image/*". Empty matches every response.
+	ContentTypes []string `json:"contentTypes,omitempty"`
+}
+
+// PresignRule configures redirects to presigned URLs. HTML navigations are always streamed.
+type PresignRule struct {
+	// Expires is the lifetime of the presigned URLs, e.g. "5m" (the default).
+	Expires Duration `json:"expires,omitempty"`
+	// MinSize streams objects smaller than this many bytes instead of redirecting.
+	MinSize int64 `json:"minSize,omitempty"`
+}
+
+// RequestTimeout returns the rule's upstream timeout, or def when the rule does not set one.
+func (rule RouteRule) RequestTimeout(def time.Duration) time.Duration {
+	if rule.Timeout > 0 {
+		return time.Duration(rule.Timeout)
+	}
+	return def
+}
+
+// IdentityRequired reports whether the rule requires an x-rh-identity header, or def when
+// the rule does not say.
+func (rule RouteRule) IdentityRequired(def bool) bool {
+	if rule.RequireIdentity != nil {
+		return *rule.RequireIdentity
+	}
+	return def
+}
+
+// Duration is a time.Duration read from JSON as a duration string such as "1m30s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// AllowsExtension reports whether reqPath may be served under the rule's extension allowlist.
+// Extensionless paths are navigations or directories and are allowed when "html" is listed.
+func (rule RouteRule) AllowsExtension(reqPath string) bool {
+	if len(rule.Extensions) == 0 {
+		return true
+	}
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(reqPath), "."))
+	if ext == "" || strings.HasSuffix(reqPath, "/") {
+		ext = "html"
+	}
+	for _, allowed := range rule.Extensions {
+		if ext == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// PathRewrite replaces From with To in served entrypoints.
+type PathRewrite struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Files are path.Match patterns on the object's base name selecting JavaScript entrypoints
+	// to rewrite, e.g. ["app.*.js"]. HTML documents are always rewritten.
+	Files []string `json:"files,omitempty"`
+}
+
+// Matches reports whether the file named name should be rewritten.
+func (pr *PathRewrite) Matches(name string, isHTML bool) bool {
+	if isHTML {
+		return true
+	}
+	for _, pattern := range pr.Files {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RedirectRule answers requests for From with a redirect to To, e.g. for moved apps and
+// legacy bookmarks, instead of keeping stub objects in the bucket.
+type RedirectRule struct {
+	// From is the request path to redirect, e.g. "/apps/old-app". With Pattern it is a
+	// regular expression matched against the whole path, e.g. "/apps/old-app/(.*)".
+	From string `json:"from"`
+	// To is the redirect target. With Pattern, $1 or ${name} are replaced by the
+	// captures of From, e.g. "/apps/new-app/$1". The request's query string is kept
+	// unless To has one.
+	To      string `json:"to"`
+	Pattern bool   `json:"pattern,omitempty"`
+	// Status is 301 (the default), 302, 307 or 308.
+	Status int `json:"status,omitempty"`
+}
+
+// EarlyHintsRule lists the assets preloaded through 103 Early Hints.
+type EarlyHintsRule struct {
+	// Preload are request paths of assets to preload, e.g. "/apps/chrome/js/app.js".
+	Preload []string `json:"preload,omitempty"`
+	// Manifest is the bucket path of a JSON array of request paths to preload, so the list
+	// can be published with each build, e.g. "/frontend-assets/data/chrome/preload.json".
+	Manifest string `json:"manifest,omitempty"`
+}
+
+// LinkHeader is a resource hint, e.g. {"href":"https://console.example.com","rel":"preconnect"}.
+type LinkHeader struct {
+	Href string `json:"href"`
+	// Rel is the link relation: "preload", "modulepreload", "preconnect", "dns-prefetch", ...
+	Rel string `json:"rel"`
+	// As is the preload destination, e.g. "script", "style" or "font".
+	As string `json:"as,omitempty"`
+	// Crossorigin is "anonymous" or "use-credentials"; empty omits the attribute.
+	Crossorigin string `json:"crossorigin,omitempty"`
+}
+
+// String formats the hint as a Link header value.
+func (l LinkHeader) String() string {
+	v := "<" + l.Href + ">; rel=" + l.Rel
+	if l.As != "" {
+		v += "; as=" + l.As
+	}
+	switch l.Crossorigin {
+	case "":
+	case "anonymous":
+		v += "; crossorigin"
+	default:
+		v += "; crossorigin=" + l.Crossorigin
+	}
+	return v
+}
+
+// CanaryRule splits a route's traffic between its stable BucketPath and a canary bucket path.
+type CanaryRule struct {
+	// BucketPath is the canary release's "/bucket[/prefix]".
+	BucketPath string `json:"bucketPath"`
+	// Percent of new clients (0-100) assigned to the canary; assignments are sticky via cookie.
+	Percent float64 `json:"percent"`
+	// Header, when present with "true"/"false", forces the canary or stable variant.
+	Header string `json:"header,omitempty"`
+}
+
 type FrontendAssetProxyConfig struct {
 	// Server configuration
-	ServerPort string
-	LogLevel   string
+	ServerPort   string
+	ServerSocket string
+	// MetricsPort, when set, serves /metrics on its own port instead of ServerPort
+	MetricsPort string
+	// ExpvarEnabled serves expvar's /debug/vars next to /metrics
+	ExpvarEnabled bool
+	// Request metrics are labeled with the path segment after these prefixes, for up to
+	// MetricsAppLimit distinct apps
+	MetricsAppPrefixes []string
+	MetricsAppLimit    int
+	LogLevel           string
+	// LogBackend is "logrus" or "slog"; LogFormat is "text" or "json"
+	LogBackend string
+	LogFormat  string
+	// Requests whose DebugHeader carries DebugToken are logged at debug level
+	DebugHeader string
+	DebugToken  string
+	// Echo object storage request IDs in the headers of error responses
+	ExposeUpstreamRequestID bool
+	// Optional rotated log file, written in addition to stderr
+	LogFile           string
+	LogFileMaxSizeMB  int
+	LogFileMaxAgeDays int
+	LogFileMaxBackups int
+	LogFileCompress   bool
+	// Optional syslog endpoint, written in addition to stderr
+	SyslogAddress  string
+	SyslogFacility string
+	SyslogTag      string
+	// Optional CloudWatch Logs stream, written in addition to stderr
+	CloudWatchLogGroup      string
+	CloudWatchLogStream     string
+	CloudWatchFlushInterval time.Duration
+	// Kafka access events, on KafkaBrokers or the brokers in the Clowder app config
+	KafkaTopic    string
+	KafkaBrokers  []string
+	ClowderConfig string
+	// Request headers captured as access log fields
+	LogRequestHeaders []string
+	// Query parameters redacted from logs in addition to the built-in list
+	LogRedactParams []string
+	// Access log line format: default, common, combined or a Go template
+	AccessLogFormat string
+	// Access log sampling by status code or class, and path prefixes never logged
+	AccessLogSampleRates  map[string]float64
+	AccessLogExcludePaths []string
+	// Inbound header carrying the request ID used in logs and echoed on responses
+	RequestIDHeader string
+
+	// Requests slower than this are logged as warnings regardless of LogLevel
+	SlowRequestThreshold time.Duration
+
+	// Sentry/GlitchTip error reporting
+	SentryDSN         string
+	SentryEnvironment string
 
 	// TLS configuration
 	TLSCertFile string
@@ -31,14 +320,239 @@ type FrontendAssetProxyConfig struct {
 	UpstreamURL       string
 	BucketPathPrefix  string
 	SPAEntrypointPath string
+	SPAEntrypoints    map[string]string
+	DirectoryIndex    string
 	Region            string
 	MaxRetryAttempts  int
+	RetryMode         string
+	RetryMaxBackoff   time.Duration
+	RetryableCodes    []string
 	ClientLogMode     aws.ClientLogMode
+	Routes            []RouteRule
+	VersionMapTTL     time.Duration
+	EarlyHintsTTL     time.Duration
+	MaxObjectSize     int64
+	FlushInterval     time.Duration
+
+	// ReleaseStatePath is the bucket path of the object holding the live releases
+	// switched through the admin API, re-read every ReleaseStateTTL. Empty keeps them
+	// in memory.
+	ReleaseStatePath string
+	ReleaseStateTTL  time.Duration
+
+	// ReleaseSnapshotsEnabled adds the default /releases/<sha>/* route serving immutable
+	// release snapshots. It is off by default because it shadows existing /releases paths.
+	ReleaseSnapshotsEnabled bool
+
+	// RoutesErr is why ROUTE_RULES could not be parsed; NewHandler refuses to start with it
+	// rather than serve the default routes.
+	RoutesErr error
+
+	// VersionQueryEnabled serves the object version named by the versionId query
+	// parameter, to holders of VersionQueryToken when one is set
+	VersionQueryEnabled bool
+	VersionQueryHeader  string
+	VersionQueryToken   string
+
+	// UpstreamHeaders are the object headers copied to responses, unless a route rule
+	// sets its own
+	UpstreamHeaders []string
+	// The object's VersionId and the listed user metadata keys are sent as
+	// x-amz-version-id and x-amz-meta-* response headers
+	ExposeVersionID bool
+	ExposeMetadata  []string
+
+	// ErrorPages maps status codes ("404") or classes ("5xx") to error documents,
+	// relative to BucketPathPrefix
+	ErrorPages    map[string]string
+	ErrorPagesTTL time.Duration
+
+	// Error responses under these prefixes are RFC 7807 problem details
+	ProblemJSONPrefixes []string
+
+	// CDN integration: Surrogate-Control of served objects, and the headers tagging
+	// responses with the app named after one of CacheTagPrefixes for targeted purges
+	SurrogateControl string
+	CacheTagHeaders  []string
+	CacheTagPrefixes []string
+
+	// Akamai Fast Purge API credentials; purges are forwarded to Akamai when AkamaiHost is set
+	AkamaiHost         string
+	AkamaiClientToken  string
+	AkamaiClientSecret string
+	AkamaiAccessToken  string
+	AkamaiNetwork      string
+	// AkamaiBaseURL is the public origin purged request paths are appended to
+	AkamaiBaseURL string
+
+	// DeployHookSecret signs POST /admin/deploy-hook payloads; the hook is off when empty
+	DeployHookSecret string
+
+	// Purges are sent as batched invalidations of this CloudFront distribution when set
+	CloudFrontDistributionID       string
+	CloudFrontInvalidationInterval time.Duration
+	CloudFrontInvalidationMaxPaths int
+
+	// Fault injection for chaos experiments; nothing is injected unless FaultInjection is set
+	FaultInjection     bool
+	FaultLatency       time.Duration
+	FaultLatencyRate   float64
+	FaultStatus        int
+	FaultErrorRate     float64
+	FaultTruncateBytes int64
+	FaultTruncateRate  float64
+	FaultHeader        string
+
+	// FilterModules are WebAssembly request filters run in order for route rule requests
+	FilterModules       []string
+	FilterTimeout       time.Duration
+	FilterMemoryLimitMB int
+
+	// In-memory object cache
+	CacheMaxBytes       int64
+	CacheMaxObjectSize  int64
+	CacheTTL            time.Duration
+	CacheWarmupManifest string
+	CacheWarmupPaths    []string
+	CachePrefetchHTML   bool
+
+	// Parallel ranged fetch of large objects
+	ParallelFetchThreshold   int64
+	ParallelFetchPartSize    int64
+	ParallelFetchConcurrency int
+
+	// Hedged GetObject requests
+	HedgeDelay time.Duration
+
+	// S3 client HTTP transport
+	S3MaxIdleConns          int
+	S3MaxIdleConnsPerHost   int
+	S3IdleConnTimeout       time.Duration
+	S3TLSHandshakeTimeout   time.Duration
+	S3ExpectContinueTimeout time.Duration
+	S3DualStack             bool
+	S3Accelerate            bool
+	S3ChecksumValidation    bool
+	S3DNSCacheTTL           time.Duration
+	S3DNSNegativeTTL        time.Duration
+	OutboundProxyURL        string
+
+	// Offline development: record object storage responses to a directory or replay them
+	S3RecordMode string
+	S3RecordDir  string
+
+	// SPA fallback response tuning
+	SPAFallbackStatus       int
+	SPAFallbackCacheControl string
 
 	// Object store credentials
 	AccessKeyID     string
 	SecretAccessKey string
 
+	// Preview (beta) environment routing
+	PreviewBucketPathPrefix string
+	PreviewHeader           string
+	PreviewCookie           string
+
+	// HTML placeholder substitution
+	HTMLVariables map[string]string
+
+	// Client address resolution
+	TrustedProxies []string
+
+	// Rate limiting
+	RateLimitRPS    float64
+	RateLimitBurst  int
+	RateLimitExempt []string
+	RateLimitKey    string
+
+	// Load shedding
+	MaxConcurrentRequests int
+	MaxQueuedRequests     int
+	QueueTimeout          time.Duration
+	MemoryShedThreshold   float64
+	MemoryLimit           uint64
+
+	// Bandwidth throttling in bytes per second
+	BandwidthPerResponse int
+	BandwidthGlobal      int
+
+	// Denylist of probed paths answered with 404 before contacting S3
+	DenylistPatterns []string
+
+	// Redirects answered before routing to object storage. RedirectsErr is why
+	// REDIRECT_RULES could not be parsed; NewHandler refuses to start with it.
+	Redirects    []RedirectRule
+	RedirectsErr error
+
+	// Source map access policy
+	SourceMapHeader       string
+	SourceMapToken        string
+	SourceMapAllowedCIDRs []string
+
+	// Manifest discovery and validation
+	ManifestIndexEnabled  bool
+	ManifestSchemaFile    string
+	ManifestSchemaMatch   string
+	ManifestInvalidAction string
+
+	// JSON listings of prefixes requested with ?list
+	ListingEnabled bool
+	ListingMaxKeys int
+
+	// fed-modules.json aggregation
+	FedModulesPath     string
+	FedModulesAppsPath string
+	FedModulesFile     string
+	FedModulesTTL      time.Duration
+
+	// Batch existence check API
+	ExistsAPIEnabled bool
+	ExistsMaxPaths   int
+
+	// RequireIdentity rejects requests without a valid x-rh-identity header, unless a
+	// route rule overrides it
+	RequireIdentity bool
+
+	// Requests under JWTProtectedPrefixes need a bearer token signed by a key from JWKSURL
+	JWKSURL              string
+	JWKSRefreshInterval  time.Duration
+	JWTIssuer            string
+	JWTAudience          string
+	JWTProtectedPrefixes []string
+
+	// Browser requests under OIDCProtectedPrefixes log in through an OpenID provider
+	OIDCIssuerURL         string
+	OIDCClientID          string
+	OIDCClientSecret      string
+	OIDCRedirectURL       string
+	OIDCScopes            []string
+	OIDCCookieSecret      string
+	OIDCCookieName        string
+	OIDCSessionTTL        time.Duration
+	OIDCProtectedPrefixes []string
+
+	// Requests under SignedCookiePrefixes need an access cookie issued through the admin API
+	SignedCookieSecret     string
+	SignedCookieName       string
+	SignedCookieRedeemPath string
+	SignedCookiePrefixes   []string
+
+	// Admin API
+	AdminToken string
+	// AdminBasicAuth is "user:password" accepted in addition to AdminToken
+	AdminBasicAuth    string
+	AdminAllowedCIDRs []string
+	// HotKeysCapacity is how many keys the hot key report tracks; 0 disables it
+	HotKeysCapacity int
+
+	// Shadow traffic mirroring
+	MirrorBucketPathPrefix string
+	MirrorUpstreamURL      string
+	MirrorSampleRate       float64
+	MirrorTimeout          time.Duration
+	MirrorMaxInFlight      int
+
 	// Local dev flags
 	InsecureSkipVerify bool
 	DisableIMDS        bool
@@ -59,6 +573,14 @@ func parseInt(v string, def int) int {
 	return i
 }
 
+func parseFloat(v string, def float64) float64 {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return def
+	}
+	return f
+}
+
 func parseDuration(v string) time.Duration {
 	d, err := time.ParseDuration(v)
 	if err != nil {
@@ -67,6 +589,32 @@ func parseDuration(v string) time.Duration {
 	return d
 }
 
+// parseList parses a comma-separated list, dropping empty entries.
+func parseList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// parseMap parses a comma-separated list of key=value pairs, e.g. "/apps/a=/a.html,/apps/b=/b.html".
+// Malformed pairs are skipped.
+func parseMap(v string) map[string]string {
+	out := map[string]string{}
+	for _, pair := range strings.Split(v, ",") {
+		k, val, ok := strings.Cut(pair, "=")
+		k, val = strings.TrimSpace(k), strings.TrimSpace(val)
+		if !ok || k == "" || val == "" {
+			continue
+		}
+		out[k] = val
+	}
+	return out
+}
+
 // parseClientLogMode parses a comma/pipe-separated list of aws log flags, or a numeric bitmask.
 // Supported names (case-insensitive): retries, request, response, request_with_body, response_with_body,
 // deprecated, deprecated_usage, signing, rebuilds, event_stream_body, all, none.
@@ -112,12 +660,175 @@ func parseClientLogMode(v string) aws.ClientLogMode {
 	return mode
 }
 
+// defaultRoutes reproduces the built-in routing on top of a single bucket path prefix:
+// /manifests/* -> {prefix}/manifests/*, /apps/* -> {prefix}/data/*, /* -> {prefix}/data/*,
+// and with snapshots /releases/<sha>/* -> {prefix}/releases/<sha>/*.
+func defaultRoutes(prefix string, snapshots bool) []RouteRule {
+	rules := []RouteRule{
+		{Prefix: "/manifests", BucketPath: prefix},
+		{Prefix: "/apps", BucketPath: strings.TrimSuffix(prefix, "/") + "/data", StripPrefix: true},
+	}
+	if snapshots {
+		rules = append(rules, RouteRule{Prefix: "/releases", BucketPath: strings.TrimSuffix(prefix, "/") + "/releases", StripPrefix: true, Immutable: true})
+	}
+	return append(rules, RouteRule{Prefix: "/", BucketPath: strings.TrimSuffix(prefix, "/") + "/data"})
+}
+
+// parseRouteRules parses a JSON array of route rules and merges it over defaults.
+// A configured rule replaces the default with the same prefix; other defaults are kept.
+// If empty, the defaults are returned unchanged; invalid JSON is an error.
+func parseRouteRules(v string, defaults []RouteRule) ([]RouteRule, error) {
+	if v == "" {
+		return defaults, nil
+	}
+	var rules []RouteRule
+	if err := json.Unmarshal([]byte(v), &rules); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(rules))
+	valid := rules[:0]
+	for _, rule := range rules {
+		if rule.BucketPath == "" || !strings.HasPrefix(rule.Prefix, "/") {
+			continue
+		}
+		if rule.Canary != nil && rule.Canary.BucketPath == "" {
+			rule.Canary = nil
+		}
+		if rule.Prefix != "/" {
+			rule.Prefix = strings.TrimSuffix(rule.Prefix, "/")
+		}
+		rule.Host = strings.ToLower(rule.Host)
+		links := rule.Links[:0]
+		for _, l := range rule.Links {
+			if l.Href != "" && l.Rel != "" {
+				links = append(links, l)
+			}
+		}
+		rule.Links = links
+		for i, ext := range rule.Extensions {
+			rule.Extensions[i] = strings.ToLower(strings.TrimPrefix(ext, "."))
+		}
+		if rule.Host == "" {
+			seen[rule.Prefix] = true
+		}
+		valid = append(valid, rule)
+	}
+	for _, rule := range defaults {
+		if !seen[rule.Prefix] {
+			valid = append(valid, rule)
+		}
+	}
+	return valid, nil
+}
+
+// parseRedirectRules parses a JSON array of redirect rules. If empty, there are no
+// redirects; invalid JSON and rules without a path or target are errors.
+func parseRedirectRules(v string) ([]RedirectRule, error) {
+	if v == "" {
+		return nil, nil
+	}
+	var rules []RedirectRule
+	if err := json.Unmarshal([]byte(v), &rules); err != nil {
+		return nil, err
+	}
+	for i, rule := range rules {
+		if rule.From == "" || rule.To == "" {
+			return nil, fmt.Errorf("rule %d: from and to are required", i)
+		}
+		if rule.Status == 0 {
+			rules[i].Status = http.StatusMovedPermanently
+		}
+	}
+	return rules, nil
+}
+
+// RoutesForHost returns the rules that apply to host: host-specific rules first,
+// followed by host-agnostic rules whose prefix the host does not override.
+// An empty host returns only the host-agnostic rules.
+func RoutesForHost(rules []RouteRule, host string) []RouteRule {
+	var out []RouteRule
+	seen := map[string]bool{}
+	if host != "" {
+		for _, rule := range rules {
+			if rule.Host == host {
+				seen[rule.Prefix] = true
+				out = append(out, rule)
+			}
+		}
+	}
+	for _, rule := range rules {
+		if rule.Host == "" && !seen[rule.Prefix] {
+			out = append(out, rule)
+		}
+	}
+	return out
+}
+
+// MatchRoute returns the rule with the longest prefix matching reqPath on a segment boundary,
+// mirroring how the chi routes registered per rule resolve requests.
+func MatchRoute(rules []RouteRule, reqPath string) (RouteRule, bool) {
+	var best RouteRule
+	found := false
+	for _, rule := range rules {
+		prefix := strings.TrimSuffix(rule.Prefix, "/")
+		if prefix != "" && !strings.HasPrefix(reqPath, prefix+"/") {
+			continue
+		}
+		if !found || len(rule.Prefix) > len(best.Prefix) {
+			best, found = rule, true
+		}
+	}
+	return best, found
+}
+
 func FromEnv() FrontendAssetProxyConfig {
 	cfg := FrontendAssetProxyConfig{}
 
 	// Server configuration
 	cfg.ServerPort = getEnv("SERVER_PORT", "8080")
+	cfg.ServerSocket = getEnv("SERVER_SOCKET", "")
+	cfg.MetricsPort = getEnv("METRICS_PORT", "")
+	cfg.ExpvarEnabled = getEnv("EXPVAR_ENABLED", "false") == "true"
+	cfg.MetricsAppPrefixes = parseList(getEnv("METRICS_APP_PREFIXES", "/apps"))
+	cfg.MetricsAppLimit = parseInt(getEnv("METRICS_APP_LIMIT", "100"), 100)
 	cfg.LogLevel = getEnv("LOG_LEVEL", "error")
+	cfg.LogBackend = getEnv("LOG_BACKEND", "logrus")
+	cfg.LogFormat = getEnv("LOG_FORMAT", "text")
+	cfg.DebugHeader = getEnv("DEBUG_HEADER", "X-Proxy-Debug")
+	cfg.DebugToken = getEnv("DEBUG_TOKEN", "")
+	cfg.ExposeUpstreamRequestID = getEnv("EXPOSE_UPSTREAM_REQUEST_ID", "false") == "true"
+	cfg.LogFile = getEnv("LOG_FILE", "")
+	cfg.LogFileMaxSizeMB = parseInt(getEnv("LOG_FILE_MAX_SIZE_MB", "100"), 100)
+	cfg.LogFileMaxAgeDays = parseInt(getEnv("LOG_FILE_MAX_AGE_DAYS", "7"), 7)
+	cfg.LogFileMaxBackups = parseInt(getEnv("LOG_FILE_MAX_BACKUPS", "5"), 5)
+	cfg.LogFileCompress = getEnv("LOG_FILE_COMPRESS", "true") == "true"
+	cfg.SyslogAddress = getEnv("SYSLOG_ADDRESS", "")
+	cfg.SyslogFacility = getEnv("SYSLOG_FACILITY", "daemon")
+	cfg.SyslogTag = getEnv("SYSLOG_TAG", "frontend-asset-proxy")
+	cfg.CloudWatchLogGroup = getEnv("CLOUDWATCH_LOG_GROUP", "")
+	hostname, _ := os.Hostname()
+	cfg.CloudWatchLogStream = getEnv("CLOUDWATCH_LOG_STREAM", hostname)
+	cfg.CloudWatchFlushInterval = parseDuration(getEnv("CLOUDWATCH_FLUSH_INTERVAL", "5s"))
+	if cfg.CloudWatchFlushInterval <= 0 {
+		cfg.CloudWatchFlushInterval = 5 * time.Second
+	}
+	cfg.KafkaTopic = getEnv("KAFKA_TOPIC", "")
+	cfg.KafkaBrokers = parseList(getEnv("KAFKA_BROKERS", ""))
+	cfg.ClowderConfig = getEnv("ACG_CONFIG", "")
+	cfg.LogRequestHeaders = parseList(getEnv("LOG_REQUEST_HEADERS", ""))
+	cfg.LogRedactParams = parseList(getEnv("LOG_REDACT_PARAMS", ""))
+	cfg.AccessLogFormat = getEnv("ACCESS_LOG_FORMAT", "default")
+	cfg.AccessLogSampleRates = map[string]float64{}
+	for status, rate := range parseMap(getEnv("ACCESS_LOG_SAMPLE_RATES", "")) {
+		if f := parseFloat(rate, -1); f >= 0 && f <= 1 {
+			cfg.AccessLogSampleRates[status] = f
+		}
+	}
+	cfg.AccessLogExcludePaths = parseList(getEnv("ACCESS_LOG_EXCLUDE_PATHS", ""))
+	cfg.RequestIDHeader = getEnv("REQUEST_ID_HEADER", "X-Request-Id")
+	cfg.SlowRequestThreshold = parseDuration(getEnv("SLOW_REQUEST_THRESHOLD", "0"))
+	cfg.SentryDSN = getEnv("SENTRY_DSN", "")
+	cfg.SentryEnvironment = getEnv("SENTRY_ENVIRONMENT", "")
 
 	// TLS configuration
 	cfg.TLSCertFile = getEnv("TLS_CERT_FILE", "")
@@ -135,13 +846,230 @@ func FromEnv() FrontendAssetProxyConfig {
 	cfg.UpstreamURL = getEnv("MINIO_UPSTREAM_URL", "http://minio:9000")
 	cfg.BucketPathPrefix = getEnv("BUCKET_PATH_PREFIX", "/frontend-assets")
 	cfg.SPAEntrypointPath = getEnv("SPA_ENTRYPOINT_PATH", "/index.html")
+	cfg.SPAEntrypoints = parseMap(getEnv("SPA_ENTRYPOINTS", ""))
+	cfg.DirectoryIndex = getEnv("DIRECTORY_INDEX", "index.html")
+	cfg.ErrorPages = parseMap(getEnv("ERROR_PAGES", ""))
+	cfg.ErrorPagesTTL = parseDuration(getEnv("ERROR_PAGES_TTL", "1m"))
+	cfg.ProblemJSONPrefixes = parseList(getEnv("PROBLEM_JSON_PREFIXES", ""))
+	cfg.SurrogateControl = getEnv("SURROGATE_CONTROL", "")
+	cfg.CacheTagHeaders = parseList(getEnv("CACHE_TAG_HEADERS", ""))
+	cfg.CacheTagPrefixes = parseList(getEnv("CACHE_TAG_PREFIXES", "/apps"))
+	cfg.AkamaiHost = getEnv("AKAMAI_HOST", "")
+	cfg.AkamaiClientToken = os.Getenv("AKAMAI_CLIENT_TOKEN")
+	cfg.AkamaiClientSecret = os.Getenv("AKAMAI_CLIENT_SECRET")
+	cfg.AkamaiAccessToken = os.Getenv("AKAMAI_ACCESS_TOKEN")
+	cfg.AkamaiNetwork = getEnv("AKAMAI_NETWORK", "production")
+	cfg.AkamaiBaseURL = getEnv("AKAMAI_BASE_URL", "")
+	cfg.DeployHookSecret = os.Getenv("DEPLOY_HOOK_SECRET")
+	cfg.CloudFrontDistributionID = getEnv("CLOUDFRONT_DISTRIBUTION_ID", "")
+	cfg.CloudFrontInvalidationInterval = parseDuration(getEnv("CLOUDFRONT_INVALIDATION_INTERVAL", "1m"))
+	if cfg.CloudFrontInvalidationInterval <= 0 {
+		cfg.CloudFrontInvalidationInterval = time.Minute
+	}
+	cfg.CloudFrontInvalidationMaxPaths = parseInt(getEnv("CLOUDFRONT_INVALIDATION_MAX_PATHS", "1000"), 1000)
+	if cfg.CloudFrontInvalidationMaxPaths < 1 {
+		cfg.CloudFrontInvalidationMaxPaths = 1000
+	}
+	cfg.FaultInjection = getEnv("FAULT_INJECTION", "false") == "true"
+	cfg.FaultLatency = parseDuration(getEnv("FAULT_LATENCY", "0"))
+	cfg.FaultLatencyRate = parseFloat(getEnv("FAULT_LATENCY_RATE", "0"), 0)
+	cfg.FaultStatus = parseInt(getEnv("FAULT_STATUS", "503"), 503)
+	if cfg.FaultStatus < 400 || cfg.FaultStatus > 599 {
+		cfg.FaultStatus = 503
+	}
+	cfg.FaultErrorRate = parseFloat(getEnv("FAULT_ERROR_RATE", "0"), 0)
+	cfg.FaultTruncateBytes = int64(parseInt(getEnv("FAULT_TRUNCATE_BYTES", "1024"), 1024))
+	cfg.FaultTruncateRate = parseFloat(getEnv("FAULT_TRUNCATE_RATE", "0"), 0)
+	cfg.FaultHeader = getEnv("FAULT_HEADER", "")
+	cfg.FilterModules = parseList(getEnv("FILTER_MODULES", ""))
+	cfg.FilterTimeout = parseDuration(getEnv("FILTER_TIMEOUT", "50ms"))
+	if cfg.FilterTimeout <= 0 {
+		cfg.FilterTimeout = 50 * time.Millisecond
+	}
+	cfg.FilterMemoryLimitMB = parseInt(getEnv("FILTER_MEMORY_LIMIT_MB", "64"), 64)
+	if cfg.FilterMemoryLimitMB < 1 {
+		cfg.FilterMemoryLimitMB = 64
+	}
+	cfg.SPAFallbackStatus = parseInt(getEnv("SPA_FALLBACK_STATUS", "200"), 200)
+	if cfg.SPAFallbackStatus != 200 && cfg.SPAFallbackStatus != 404 {
+		cfg.SPAFallbackStatus = 200
+	}
+	cfg.SPAFallbackCacheControl = getEnv("SPA_FALLBACK_CACHE_CONTROL", "no-store")
 	cfg.Region = getEnv("AWS_REGION", "us-east-1")
 	cfg.MaxRetryAttempts = parseInt(getEnv("S3_MAX_ATTEMPTS", "3"), 3)
+	cfg.RetryMode = getEnv("S3_RETRY_MODE", "standard")
+	if cfg.RetryMode != "adaptive" {
+		cfg.RetryMode = "standard"
+	}
+	cfg.RetryMaxBackoff = parseDuration(getEnv("S3_RETRY_MAX_BACKOFF", "20s"))
+	cfg.RetryableCodes = parseList(getEnv("S3_RETRYABLE_ERROR_CODES", ""))
 	cfg.ClientLogMode = parseClientLogMode(getEnv("AWS_SDK_CLIENT_LOG_MODE", ""))
+	cfg.ReleaseSnapshotsEnabled = getEnv("RELEASE_SNAPSHOTS_ENABLED", "false") == "true"
+	cfg.Routes, cfg.RoutesErr = parseRouteRules(getEnv("ROUTE_RULES", ""), defaultRoutes(cfg.BucketPathPrefix, cfg.ReleaseSnapshotsEnabled))
+	cfg.VersionMapTTL = parseDuration(getEnv("VERSION_MAP_TTL", "30s"))
+	cfg.ReleaseStatePath = getEnv("RELEASE_STATE_PATH", "")
+	cfg.ReleaseStateTTL = parseDuration(getEnv("RELEASE_STATE_TTL", "10s"))
+	if cfg.ReleaseStateTTL <= 0 {
+		cfg.ReleaseStateTTL = 10 * time.Second
+	}
+	cfg.VersionQueryEnabled = getEnv("VERSION_QUERY_ENABLED", "false") == "true"
+	cfg.VersionQueryHeader = getEnv("VERSION_QUERY_HEADER", "X-Version-Token")
+	cfg.VersionQueryToken = os.Getenv("VERSION_QUERY_TOKEN")
+	cfg.UpstreamHeaders = parseList(getEnv("UPSTREAM_HEADERS", "Content-Type,ETag,Cache-Control,Content-Encoding,Content-Disposition,Content-Language,Expires,Accept-Ranges"))
+	cfg.ExposeVersionID = getEnv("EXPOSE_VERSION_ID", "false") == "true"
+	cfg.ExposeMetadata = parseList(strings.ToLower(getEnv("EXPOSE_METADATA", "")))
+	cfg.EarlyHintsTTL = parseDuration(getEnv("EARLY_HINTS_TTL", "30s"))
+	cfg.MaxObjectSize = int64(parseInt(getEnv("MAX_OBJECT_SIZE", "0"), 0))
+	cfg.FlushInterval = parseDuration(getEnv("FLUSH_INTERVAL", "0"))
+
+	// In-memory object cache (disabled unless a size is set)
+	cfg.CacheMaxBytes = int64(parseInt(getEnv("CACHE_MAX_BYTES", "0"), 0))
+	cfg.CacheMaxObjectSize = int64(parseInt(getEnv("CACHE_MAX_OBJECT_SIZE", "1048576"), 1<<20))
+	cfg.CacheTTL = parseDuration(getEnv("CACHE_TTL", "60s"))
+	cfg.CacheWarmupManifest = getEnv("CACHE_WARMUP_MANIFEST", "")
+	cfg.CacheWarmupPaths = parseList(getEnv("CACHE_WARMUP_PATHS", ""))
+	cfg.CachePrefetchHTML = getEnv("CACHE_PREFETCH_HTML", "false") == "true"
+
+	// Parallel ranged fetch for objects above the threshold (disabled unless a threshold is set)
+	cfg.ParallelFetchThreshold = int64(parseInt(getEnv("PARALLEL_FETCH_THRESHOLD", "0"), 0))
+	cfg.ParallelFetchPartSize = int64(parseInt(getEnv("PARALLEL_FETCH_PART_SIZE", "8388608"), 8<<20))
+	cfg.ParallelFetchConcurrency = parseInt(getEnv("PARALLEL_FETCH_CONCURRENCY", "4"), 4)
+	cfg.HedgeDelay = parseDuration(getEnv("HEDGE_DELAY", "0"))
+
+	// S3 client HTTP transport
+	cfg.S3MaxIdleConns = parseInt(getEnv("S3_MAX_IDLE_CONNS", "256"), 256)
+	cfg.S3MaxIdleConnsPerHost = parseInt(getEnv("S3_MAX_IDLE_CONNS_PER_HOST", "128"), 128)
+	cfg.S3IdleConnTimeout = parseDuration(getEnv("S3_IDLE_CONN_TIMEOUT", "90s"))
+	cfg.S3TLSHandshakeTimeout = parseDuration(getEnv("S3_TLS_HANDSHAKE_TIMEOUT", "10s"))
+	cfg.S3ExpectContinueTimeout = parseDuration(getEnv("S3_EXPECT_CONTINUE_TIMEOUT", "1s"))
+	cfg.S3DualStack = getEnv("S3_DUALSTACK", "false") == "true"
+	cfg.S3Accelerate = getEnv("S3_ACCELERATE", "false") == "true"
+	cfg.S3ChecksumValidation = getEnv("S3_CHECKSUM_VALIDATION", "false") == "true"
+	cfg.S3DNSCacheTTL = parseDuration(getEnv("S3_DNS_CACHE_TTL", "0"))
+	cfg.S3DNSNegativeTTL = parseDuration(getEnv("S3_DNS_NEGATIVE_TTL", "5s"))
+	cfg.OutboundProxyURL = getEnv("OUTBOUND_PROXY_URL", "")
+	cfg.S3RecordMode = getEnv("S3_RECORD_MODE", "")
+	cfg.S3RecordDir = getEnv("S3_RECORD_DIR", "s3-recordings")
 
 	// Object store credentials
 	cfg.AccessKeyID = os.Getenv("PUSHCACHE_AWS_ACCESS_KEY_ID")
 	cfg.SecretAccessKey = os.Getenv("PUSHCACHE_AWS_SECRET_ACCESS_KEY")
 
+	// HTML placeholder substitution: NAME=value pairs replace %%NAME%% in served HTML
+	cfg.HTMLVariables = parseMap(getEnv("HTML_VARIABLES", ""))
+
+	// Proxies trusted to set X-Forwarded-For (CIDRs or IPs)
+	cfg.TrustedProxies = parseList(getEnv("TRUSTED_PROXIES", ""))
+
+	// Per-client rate limiting (disabled unless a rate is set)
+	cfg.RateLimitRPS = parseFloat(getEnv("RATE_LIMIT_RPS", "0"), 0)
+	cfg.RateLimitBurst = parseInt(getEnv("RATE_LIMIT_BURST", "100"), 100)
+	if cfg.RateLimitBurst < 1 {
+		cfg.RateLimitBurst = 1
+	}
+	cfg.RateLimitExempt = parseList(getEnv("RATE_LIMIT_EXEMPT_PATHS", "/healthz,/readyz,/metrics"))
+	cfg.RateLimitKey = getEnv("RATE_LIMIT_KEY", "ip")
+	if cfg.RateLimitKey != "ip" && cfg.RateLimitKey != "identity" && cfg.RateLimitKey != "account" {
+		cfg.RateLimitKey = "ip"
+	}
+
+	// Concurrency cap on proxied requests (disabled unless a maximum is set)
+	cfg.MaxConcurrentRequests = parseInt(getEnv("MAX_CONCURRENT_REQUESTS", "0"), 0)
+	cfg.MaxQueuedRequests = parseInt(getEnv("MAX_QUEUED_REQUESTS", "100"), 100)
+	if cfg.MaxQueuedRequests < 0 {
+		cfg.MaxQueuedRequests = 0
+	}
+	cfg.QueueTimeout = parseDuration(getEnv("QUEUE_TIMEOUT", "1s"))
+
+	// Memory-pressure shedding (disabled unless a threshold is set; the limit defaults to the cgroup limit)
+	cfg.MemoryShedThreshold = parseFloat(getEnv("MEMORY_SHED_THRESHOLD", "0"), 0)
+	if cfg.MemoryShedThreshold < 0 || cfg.MemoryShedThreshold > 1 {
+		cfg.MemoryShedThreshold = 0
+	}
+	cfg.MemoryLimit = uint64(max(parseInt(getEnv("MEMORY_LIMIT_BYTES", "0"), 0), 0))
+
+	// Bandwidth throttling (disabled unless a rate is set)
+	cfg.BandwidthPerResponse = parseInt(getEnv("BANDWIDTH_PER_RESPONSE", "0"), 0)
+	cfg.BandwidthGlobal = parseInt(getEnv("BANDWIDTH_GLOBAL", "0"), 0)
+
+	// Denylist of sensitive paths ("none" disables it)
+	cfg.DenylistPatterns = parseList(getEnv("DENYLIST_PATTERNS", ".git/,.env,.DS_Store,*.bak"))
+	if len(cfg.DenylistPatterns) == 1 && cfg.DenylistPatterns[0] == "none" {
+		cfg.DenylistPatterns = nil
+	}
+
+	cfg.Redirects, cfg.RedirectsErr = parseRedirectRules(getEnv("REDIRECT_RULES", ""))
+
+	// Source map access policy (disabled unless a token or CIDRs are set)
+	cfg.SourceMapHeader = getEnv("SOURCEMAP_HEADER", "X-Sourcemap-Token")
+	cfg.SourceMapToken = os.Getenv("SOURCEMAP_TOKEN")
+	cfg.SourceMapAllowedCIDRs = parseList(getEnv("SOURCEMAP_ALLOWED_CIDRS", ""))
+
+	// Manifest discovery (GET /manifests)
+	cfg.ManifestIndexEnabled = getEnv("MANIFEST_INDEX_ENABLED", "false") == "true"
+
+	// Prefix listings (GET <prefix>?list)
+	cfg.ListingEnabled = getEnv("LISTING_ENABLED", "false") == "true"
+	cfg.ListingMaxKeys = parseInt(getEnv("LISTING_MAX_KEYS", "1000"), 1000)
+
+	// Manifest schema validation (disabled unless a schema file is set)
+	cfg.ManifestSchemaFile = getEnv("MANIFEST_SCHEMA_FILE", "")
+	cfg.ManifestSchemaMatch = getEnv("MANIFEST_SCHEMA_MATCH", "*-manifest.json")
+	cfg.ManifestInvalidAction = getEnv("MANIFEST_INVALID_ACTION", "warn")
+
+	// fed-modules.json aggregation (disabled unless a path is set)
+	cfg.FedModulesPath = getEnv("FED_MODULES_PATH", "")
+	cfg.FedModulesAppsPath = getEnv("FED_MODULES_APPS_PATH", strings.TrimSuffix(cfg.BucketPathPrefix, "/")+"/data")
+	cfg.FedModulesFile = getEnv("FED_MODULES_FILE", "fed-mods.json")
+	cfg.FedModulesTTL = parseDuration(getEnv("FED_MODULES_TTL", "30s"))
+
+	// Batch existence check API (POST /exists)
+	cfg.ExistsAPIEnabled = getEnv("EXISTS_API_ENABLED", "false") == "true"
+	cfg.ExistsMaxPaths = parseInt(getEnv("EXISTS_MAX_PATHS", "1000"), 1000)
+
+	cfg.RequireIdentity = getEnv("REQUIRE_IDENTITY", "false") == "true"
+	cfg.JWKSURL = getEnv("JWKS_URL", "")
+	cfg.JWKSRefreshInterval = parseDuration(getEnv("JWKS_REFRESH_INTERVAL", "1h"))
+	if cfg.JWKSRefreshInterval <= 0 {
+		cfg.JWKSRefreshInterval = time.Hour
+	}
+	cfg.JWTIssuer = getEnv("JWT_ISSUER", "")
+	cfg.JWTAudience = getEnv("JWT_AUDIENCE", "")
+	cfg.JWTProtectedPrefixes = parseList(getEnv("JWT_PROTECTED_PREFIXES", ""))
+	cfg.OIDCIssuerURL = getEnv("OIDC_ISSUER_URL", "")
+	cfg.OIDCClientID = getEnv("OIDC_CLIENT_ID", "")
+	cfg.OIDCClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+	cfg.OIDCRedirectURL = getEnv("OIDC_REDIRECT_URL", "")
+	cfg.OIDCScopes = parseList(getEnv("OIDC_SCOPES", "openid"))
+	cfg.OIDCCookieSecret = os.Getenv("OIDC_COOKIE_SECRET")
+	cfg.OIDCCookieName = getEnv("OIDC_COOKIE_NAME", "asset_session")
+	cfg.OIDCSessionTTL = parseDuration(getEnv("OIDC_SESSION_TTL", "8h"))
+	if cfg.OIDCSessionTTL <= 0 {
+		cfg.OIDCSessionTTL = 8 * time.Hour
+	}
+	cfg.OIDCProtectedPrefixes = parseList(getEnv("OIDC_PROTECTED_PREFIXES", ""))
+	cfg.SignedCookieSecret = os.Getenv("SIGNED_COOKIE_SECRET")
+	cfg.SignedCookieName = getEnv("SIGNED_COOKIE_NAME", "asset_grant")
+	cfg.SignedCookieRedeemPath = getEnv("SIGNED_COOKIE_REDEEM_PATH", "/_grant")
+	cfg.SignedCookiePrefixes = parseList(getEnv("SIGNED_COOKIE_PREFIXES", ""))
+
+	// Admin API (disabled unless a token is set)
+	cfg.AdminToken = os.Getenv("ADMIN_TOKEN")
+	cfg.AdminBasicAuth = os.Getenv("ADMIN_BASIC_AUTH")
+	cfg.AdminAllowedCIDRs = parseList(getEnv("ADMIN_ALLOWED_CIDRS", ""))
+	cfg.HotKeysCapacity = parseInt(getEnv("HOTKEYS_CAPACITY", "1000"), 1000)
+
+	// Preview environment routing (disabled unless a preview prefix is set)
+	cfg.PreviewBucketPathPrefix = getEnv("PREVIEW_BUCKET_PATH_PREFIX", "")
+	cfg.PreviewHeader = getEnv("PREVIEW_HEADER", "x-rh-frontend-preview")
+	cfg.PreviewCookie = getEnv("PREVIEW_COOKIE", "x-rh-frontend-preview")
+
+	// Shadow traffic mirroring (disabled unless a mirror prefix is set)
+	cfg.MirrorBucketPathPrefix = getEnv("MIRROR_BUCKET_PATH_PREFIX", "")
+	cfg.MirrorUpstreamURL = getEnv("MIRROR_UPSTREAM_URL", cfg.UpstreamURL)
+	cfg.MirrorSampleRate = parseFloat(getEnv("MIRROR_SAMPLE_RATE", "0.01"), 0.01)
+	cfg.MirrorTimeout = parseDuration(getEnv("MIRROR_TIMEOUT", "5s"))
+	cfg.MirrorMaxInFlight = parseInt(getEnv("MIRROR_MAX_IN_FLIGHT", "32"), 32)
+
 	return cfg
 }
@@ -0,0 +1,151 @@
+package cwlogs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/smithy-go/logging"
+)
+
+// PutLogEvents limits: events per batch, batch bytes, and per-event overhead.
+const (
+	maxBatchEvents = 10000
+	maxBatchBytes  = 1048576
+	eventOverhead  = 26
+	maxEventBytes  = 256*1024 - eventOverhead
+	// maxPendingBytes bounds what is buffered while CloudWatch is unreachable.
+	maxPendingBytes = 8 * maxBatchBytes
+)
+
+// Writer ships each written log line as an event to a CloudWatch Logs stream. Lines are
+// batched and sent every interval or when a batch fills up; the client's retryer retries
+// failed batches. Lines written while too much is pending are dropped.
+type Writer struct {
+	client *cloudwatchlogs.Client
+	group  string
+	stream string
+
+	mu      sync.Mutex
+	pending []types.InputLogEvent
+	bytes   int
+	dropped int
+
+	full chan struct{}
+	done chan struct{}
+	stop chan struct{}
+}
+
+// New creates stream in group if needed and starts shipping lines written to the Writer.
+func New(ctx context.Context, awsCfg aws.Config, group, stream string, interval time.Duration) (*Writer, error) {
+	client := cloudwatchlogs.NewFromConfig(awsCfg, func(o *cloudwatchlogs.Options) {
+		// The SDK logs through the logger this writer feeds
+		o.Logger = logging.Nop{}
+		o.ClientLogMode = 0
+	})
+	_, err := client.CreateLogStream(ctx, &cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(group),
+		LogStreamName: aws.String(stream),
+	})
+	var exists *types.ResourceAlreadyExistsException
+	if err != nil && !errors.As(err, &exists) {
+		return nil, fmt.Errorf("create log stream %s/%s: %w", group, stream, err)
+	}
+	w := &Writer{
+		client: client,
+		group:  group,
+		stream: stream,
+		full:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		stop:   make(chan struct{}),
+	}
+	go w.run(interval)
+	return w, nil
+}
+
+// Write queues p as one log event.
+func (w *Writer) Write(p []byte) (int, error) {
+	msg := string(p)
+	if len(msg) > maxEventBytes {
+		msg = msg[:maxEventBytes]
+	}
+	size := len(msg) + eventOverhead
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.bytes+size > maxPendingBytes {
+		w.dropped++
+		return len(p), nil
+	}
+	w.pending = append(w.pending, types.InputLogEvent{
+		Message:   aws.String(msg),
+		Timestamp: aws.Int64(time.Now().UnixMilli()),
+	})
+	w.bytes += size
+	if len(w.pending) >= maxBatchEvents || w.bytes >= maxBatchBytes {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Close sends the pending events and stops the Writer.
+func (w *Writer) Close() error {
+	close(w.stop)
+	<-w.done
+	return nil
+}
+
+func (w *Writer) run(interval time.Duration) {
+	defer close(w.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.full:
+		case <-w.stop:
+			w.flush()
+			return
+		}
+		w.flush()
+	}
+}
+
+// flush sends the pending events in batches within the PutLogEvents limits.
+func (w *Writer) flush() {
+	w.mu.Lock()
+	events, dropped := w.pending, w.dropped
+	w.pending, w.bytes, w.dropped = nil, 0, 0
+	w.mu.Unlock()
+
+	if dropped > 0 {
+		// Logging through the logger would feed this writer
+		fmt.Fprintf(os.Stderr, "cloudwatch logs: dropped %d log lines while the stream was unreachable\n", dropped)
+	}
+	for len(events) > 0 {
+		n, size := 0, 0
+		for n < len(events) && n < maxBatchEvents && size+len(*events[n].Message)+eventOverhead <= maxBatchBytes {
+			size += len(*events[n].Message) + eventOverhead
+			n++
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		_, err := w.client.PutLogEvents(ctx, &cloudwatchlogs.PutLogEventsInput{
+			LogGroupName:  aws.String(w.group),
+			LogStreamName: aws.String(w.stream),
+			LogEvents:     events[:n],
+		})
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cloudwatch logs: dropped %d log lines: %v\n", n, err)
+		}
+		events = events[n:]
+	}
+}
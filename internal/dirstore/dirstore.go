@@ -0,0 +1,249 @@
+// Package dirstore answers the object storage requests the proxy makes from a local
+// directory, so the whole proxy can run over a build output without S3 or MinIO.
+package dirstore
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// contentTypes covers frontend build output the standard library has no type for, or
+// types it would name differently than browsers and the test script expect.
+var contentTypes = map[string]string{
+	".js":    "application/javascript",
+	".mjs":   "application/javascript",
+	".map":   "application/json",
+	".json":  "application/json",
+	".html":  "text/html; charset=utf-8",
+	".css":   "text/css; charset=utf-8",
+	".svg":   "image/svg+xml",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".wasm":  "application/wasm",
+}
+
+// ContentType returns the Content-Type of a file named name, as stored in the bucket.
+func ContentType(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if t, ok := contentTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// Store serves the files of a directory as the objects below one bucket path: with a
+// bucket path of /frontend-assets, data/my-app/main.js in the directory is the object
+// frontend-assets/data/my-app/main.js.
+// It implements GetObject and HeadObject, with ranges and conditional requests, and
+// ListObjectsV2; other requests get 405.
+type Store struct {
+	dir    fs.FS
+	bucket string
+	// prefix is the key prefix of the files, empty or ending in "/".
+	prefix string
+}
+
+// New returns a Store serving dir at bucketPath ("/bucket" or "/bucket/prefix").
+func New(dir fs.FS, bucketPath string) *Store {
+	bucket, prefix, _ := strings.Cut(strings.Trim(bucketPath, "/"), "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &Store{dir: dir, bucket: bucket, prefix: prefix}
+}
+
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.bucket {
+		s3Error(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		s3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "The local directory is read-only")
+		return
+	}
+	if r.URL.Query().Get("list-type") == "2" {
+		s.list(w, r)
+		return
+	}
+	s.object(w, r, key)
+}
+
+// object serves a GetObject or HeadObject request for key.
+func (s *Store) object(w http.ResponseWriter, r *http.Request, key string) {
+	name, ok := strings.CutPrefix(key, s.prefix)
+	if !ok || !fs.ValidPath(name) {
+		s3Error(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+	f, err := s.dir.Open(name)
+	if err != nil {
+		s3Error(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		s3Error(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			s3Error(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+	w.Header().Set("Content-Type", ContentType(name))
+	w.Header().Set("ETag", etag(info))
+	w.Header().Set("Accept-Ranges", "bytes")
+	// ServeContent answers ranges and If-* headers with the same statuses as S3
+	http.ServeContent(w, r, "", info.ModTime(), content)
+}
+
+// etag identifies a file version by its modification time and size, so neither
+// listing nor serving has to hash file contents.
+func etag(info fs.FileInfo) string {
+	return `"` + strconv.FormatInt(info.ModTime().UnixNano(), 16) + "-" + strconv.FormatInt(info.Size(), 16) + `"`
+}
+
+type listResult struct {
+	XMLName               xml.Name       `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	KeyCount              int            `xml:"KeyCount"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	Contents              []listObject   `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type listObject struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// list serves a ListObjectsV2 request. Continuation tokens are the last key or common
+// prefix of the previous page; keys grouped under that prefix sort after it and are
+// skipped along with it.
+func (s *Store) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+	maxKeys := 1000
+	if v, err := strconv.Atoi(q.Get("max-keys")); err == nil && v > 0 && v < maxKeys {
+		maxKeys = v
+	}
+	after := q.Get("start-after")
+	if token := q.Get("continuation-token"); token != "" {
+		after = token
+	}
+
+	type object struct {
+		key  string
+		info fs.FileInfo
+	}
+	var objects []object
+	err := fs.WalkDir(s.dir, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, object{key: s.prefix + name, info: info})
+		return nil
+	})
+	if err != nil {
+		s3Error(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	// Keys sort byte-wise in S3, which differs from the walk order around "/"
+	sort.Slice(objects, func(i, j int) bool { return objects[i].key < objects[j].key })
+
+	res := listResult{
+		Name:              s.bucket,
+		Prefix:            prefix,
+		Delimiter:         delimiter,
+		MaxKeys:           maxKeys,
+		ContinuationToken: q.Get("continuation-token"),
+		StartAfter:        q.Get("start-after"),
+	}
+	last := ""
+	for _, o := range objects {
+		if !strings.HasPrefix(o.key, prefix) || o.key <= after {
+			continue
+		}
+		entry := o.key
+		if delimiter != "" {
+			if i := strings.Index(o.key[len(prefix):], delimiter); i >= 0 {
+				entry = o.key[:len(prefix)+i+len(delimiter)]
+				if entry == last || entry <= after {
+					continue
+				}
+			}
+		}
+		if res.KeyCount == maxKeys {
+			res.IsTruncated = true
+			res.NextContinuationToken = last
+			break
+		}
+		res.KeyCount++
+		last = entry
+		if entry != o.key {
+			res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: entry})
+			continue
+		}
+		res.Contents = append(res.Contents, listObject{
+			Key:          o.key,
+			LastModified: o.info.ModTime().UTC().Format(time.RFC3339),
+			ETag:         etag(o.info),
+			Size:         o.info.Size(),
+			StorageClass: "STANDARD",
+		})
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = io.WriteString(w, xml.Header)
+	_ = xml.NewEncoder(w).Encode(res)
+}
+
+type s3ErrorBody struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func s3Error(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = io.WriteString(w, xml.Header)
+	_ = xml.NewEncoder(w).Encode(s3ErrorBody{Code: code, Message: message})
+}
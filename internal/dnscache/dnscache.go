@@ -0,0 +1,99 @@
+package dnscache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Resolver caches host lookups for dialing. Successful lookups are kept for TTL and
+// failures for NegativeTTL; when a refresh fails, the previous addresses are kept so a
+// flaky cluster DNS does not surface as upstream errors.
+type Resolver struct {
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	// Lookup resolves a host to addresses; defaults to net.DefaultResolver.LookupHost.
+	Lookup func(ctx context.Context, host string) ([]string, error)
+	Dialer *net.Dialer
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+type entry struct {
+	addrs   []string
+	err     error
+	expires time.Time
+}
+
+// LookupHost returns the cached addresses of host, resolving it when the entry expired.
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	e := r.entries[host]
+	r.mu.Unlock()
+	if e != nil && time.Now().Before(e.expires) {
+		return e.addrs, e.err
+	}
+
+	lookup := r.Lookup
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupHost
+	}
+	addrs, err := lookup(ctx, host)
+	if err != nil && ctx.Err() != nil {
+		// A canceled request says nothing about the host, so don't cache the failure.
+		if e != nil && e.err == nil {
+			return e.addrs, nil
+		}
+		return nil, err
+	}
+	next := &entry{addrs: addrs, err: err, expires: time.Now().Add(r.TTL)}
+	if err != nil {
+		if e != nil && e.err == nil {
+			// Keep serving the last known addresses until the next negative TTL passes.
+			next = &entry{addrs: e.addrs, expires: time.Now().Add(r.NegativeTTL)}
+		} else {
+			next.expires = time.Now().Add(r.NegativeTTL)
+		}
+	}
+	r.mu.Lock()
+	if r.entries == nil {
+		r.entries = map[string]*entry{}
+	}
+	r.entries[host] = next
+	r.mu.Unlock()
+	return next.addrs, next.err
+}
+
+// DialContext dials addr, resolving its host through the cache and trying each address in turn.
+func (r *Resolver) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := r.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	addrs, err := r.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, ip := range addrs {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) == 0 {
+		return nil, &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+	}
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,107 @@
+package errreport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// sensitive marks header and query parameter names whose values are never reported.
+var sensitive = []string{"authorization", "cookie", "token", "secret", "password", "identity", "signature", "credential", "key"}
+
+// Init enables reporting to the Sentry or GlitchTip project at dsn. Reporting stays
+// disabled when dsn is empty, and Report and Middleware do nothing.
+func Init(dsn, environment string) error {
+	if dsn == "" {
+		return nil
+	}
+	return sentry.Init(sentry.ClientOptions{
+		Dsn:         dsn,
+		Environment: environment,
+		BeforeSend:  scrub,
+	})
+}
+
+// Flush waits up to timeout for buffered events to be sent, e.g. before exiting.
+func Flush(timeout time.Duration) {
+	sentry.Flush(timeout)
+}
+
+// Report sends err, which made the proxy answer r with a 5xx status, tagged with the
+// request ID and tags such as the bucket and key.
+func Report(r *http.Request, status int, err error, tags map[string]string) {
+	if sentry.CurrentHub().Client() == nil {
+		return
+	}
+	if err == nil {
+		err = fmt.Errorf("%d %s", status, http.StatusText(status))
+	}
+	hub := sentry.CurrentHub().Clone()
+	hub.ConfigureScope(func(scope *sentry.Scope) {
+		scope.SetRequest(r)
+		scope.SetTag("status", fmt.Sprint(status))
+		scope.SetTag("request_id", middleware.GetReqID(r.Context()))
+		scope.SetTags(tags)
+	})
+	hub.CaptureException(err)
+}
+
+// Middleware reports panics and re-panics, leaving the response to chi's Recoverer.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if v := recover(); v != nil {
+				if err, ok := v.(error); !ok || !errors.Is(err, http.ErrAbortHandler) {
+					hub := sentry.CurrentHub().Clone()
+					hub.Scope().SetRequest(r)
+					hub.Scope().SetTag("request_id", middleware.GetReqID(r.Context()))
+					hub.RecoverWithContext(r.Context(), v)
+				}
+				panic(v)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// scrub removes credentials from reported requests: identity and token headers, cookies
+// and presigned URL signatures.
+func scrub(event *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+	req := event.Request
+	if req == nil {
+		return event
+	}
+	req.Cookies = ""
+	for name := range req.Headers {
+		if isSensitive(name) {
+			req.Headers[name] = "[Filtered]"
+		}
+	}
+	if query, err := url.ParseQuery(req.QueryString); err == nil {
+		for name := range query {
+			if isSensitive(name) {
+				query.Set(name, "[Filtered]")
+			}
+		}
+		req.QueryString = query.Encode()
+	} else {
+		req.QueryString = ""
+	}
+	return event
+}
+
+func isSensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range sensitive {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
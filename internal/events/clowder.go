@@ -0,0 +1,110 @@
+package events
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// clowderConfig is the subset of the Clowder app config (cdappconfig.json) describing Kafka.
+type clowderConfig struct {
+	Kafka *struct {
+		Brokers []struct {
+			Hostname         string  `json:"hostname"`
+			Port             *int    `json:"port"`
+			Cacert           *string `json:"cacert"`
+			SecurityProtocol *string `json:"securityProtocol"`
+			Sasl             *struct {
+				Username      *string `json:"username"`
+				Password      *string `json:"password"`
+				SaslMechanism *string `json:"saslMechanism"`
+			} `json:"sasl"`
+		} `json:"brokers"`
+		Topics []struct {
+			RequestedName string `json:"requestedName"`
+			Name          string `json:"name"`
+		} `json:"topics"`
+	} `json:"kafka"`
+}
+
+// FromClowder reads the brokers from the Clowder app config at path (ACG_CONFIG) and maps
+// requestedTopic to the topic name Clowder provisioned. The transport carries the TLS
+// and SASL settings of the first broker, and is nil for plaintext brokers.
+func FromClowder(path, requestedTopic string) (brokers []string, topic string, transport *kafka.Transport, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	var cfg clowderConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, "", nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if cfg.Kafka == nil || len(cfg.Kafka.Brokers) == 0 {
+		return nil, "", nil, fmt.Errorf("%s has no kafka brokers", path)
+	}
+	for _, b := range cfg.Kafka.Brokers {
+		port := 9092
+		if b.Port != nil {
+			port = *b.Port
+		}
+		brokers = append(brokers, fmt.Sprintf("%s:%d", b.Hostname, port))
+	}
+	topic = requestedTopic
+	for _, t := range cfg.Kafka.Topics {
+		if t.RequestedName == requestedTopic {
+			topic = t.Name
+		}
+	}
+
+	b := cfg.Kafka.Brokers[0]
+	protocol := ""
+	if b.SecurityProtocol != nil {
+		protocol = strings.ToUpper(*b.SecurityProtocol)
+	}
+	if protocol == "" || protocol == "PLAINTEXT" {
+		return brokers, topic, nil, nil
+	}
+	transport = &kafka.Transport{DialTimeout: 10 * time.Second}
+	if protocol == "SSL" || protocol == "SASL_SSL" {
+		transport.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+		if b.Cacert != nil && *b.Cacert != "" {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM([]byte(*b.Cacert)) {
+				return nil, "", nil, fmt.Errorf("invalid kafka broker CA certificate in %s", path)
+			}
+			transport.TLS.RootCAs = pool
+		}
+	}
+	if b.Sasl != nil && b.Sasl.Username != nil && b.Sasl.Password != nil {
+		mechanism := ""
+		if b.Sasl.SaslMechanism != nil {
+			mechanism = *b.Sasl.SaslMechanism
+		}
+		transport.SASL, err = saslMechanism(mechanism, *b.Sasl.Username, *b.Sasl.Password)
+		if err != nil {
+			return nil, "", nil, err
+		}
+	}
+	return brokers, topic, transport, nil
+}
+
+func saslMechanism(name, username, password string) (sasl.Mechanism, error) {
+	switch strings.ToUpper(name) {
+	case "", "PLAIN":
+		return plain.Mechanism{Username: username, Password: password}, nil
+	case "SCRAM-SHA-512":
+		return scram.Mechanism(scram.SHA512, username, password)
+	case "SCRAM-SHA-256":
+		return scram.Mechanism(scram.SHA256, username, password)
+	}
+	return nil, fmt.Errorf("unsupported kafka SASL mechanism %q", name)
+}
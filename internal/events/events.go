@@ -0,0 +1,129 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/metrics"
+	"github.com/segmentio/kafka-go"
+)
+
+// AccessEvent describes one proxied asset request for the analytics pipeline.
+type AccessEvent struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Method     string    `json:"method"`
+	Host       string    `json:"host"`
+	Path       string    `json:"path"`
+	Route      string    `json:"route"`
+	Variant    string    `json:"variant"`
+	Bucket     string    `json:"bucket,omitempty"`
+	Key        string    `json:"key,omitempty"`
+	Status     int       `json:"status"`
+	Bytes      int       `json:"bytes"`
+	DurationMS int64     `json:"duration_ms"`
+	OrgID      string    `json:"org_id,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Referer    string    `json:"referer,omitempty"`
+}
+
+// queueSize bounds the events waiting for the writer; more are dropped.
+const queueSize = 10000
+
+// Publisher publishes access events to a Kafka topic. Events are queued and written in
+// batches from a background goroutine so a slow or unavailable broker never delays
+// responses; events that overflow the queue or fail to publish are counted and logged.
+// A nil Publisher discards events.
+type Publisher struct {
+	w     *kafka.Writer
+	log   logger.Logger
+	queue chan kafka.Message
+	done  chan struct{}
+}
+
+// NewPublisher returns a Publisher writing to topic on brokers or, when no brokers are
+// given, on the brokers and topic Clowder provisioned in the app config at clowderConfig.
+func NewPublisher(brokers []string, topic, clowderConfig string, log logger.Logger) (*Publisher, error) {
+	var transport *kafka.Transport
+	if len(brokers) == 0 && clowderConfig != "" {
+		var err error
+		if brokers, topic, transport, err = FromClowder(clowderConfig, topic); err != nil {
+			return nil, err
+		}
+	}
+	if len(brokers) == 0 {
+		return nil, errors.New("no brokers configured")
+	}
+	p := &Publisher{
+		w: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			BatchTimeout: 100 * time.Millisecond,
+			RequiredAcks: kafka.RequireOne,
+		},
+		log:   log.WithFields(logger.Fields{"process": "events", "topic": topic}),
+		queue: make(chan kafka.Message, queueSize),
+		done:  make(chan struct{}),
+	}
+	if transport != nil {
+		p.w.Transport = transport
+	}
+	go p.run()
+	return p, nil
+}
+
+// Publish queues e, keyed by route so one app's events stay ordered within a partition.
+func (p *Publisher) Publish(e AccessEvent) {
+	if p == nil {
+		return
+	}
+	value, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	select {
+	case p.queue <- kafka.Message{Key: []byte(e.Route), Value: value}:
+	default:
+		metrics.EventPublishErrorsTotal.Inc()
+	}
+}
+
+// Close publishes the queued events and closes the connections to the brokers.
+func (p *Publisher) Close() error {
+	if p == nil {
+		return nil
+	}
+	close(p.queue)
+	<-p.done
+	return p.w.Close()
+}
+
+func (p *Publisher) run() {
+	defer close(p.done)
+	batch := make([]kafka.Message, 0, 100)
+	for msg := range p.queue {
+		batch = append(batch[:0], msg)
+	fill:
+		for len(batch) < cap(batch) {
+			select {
+			case msg, ok := <-p.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, msg)
+			default:
+				break fill
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := p.w.WriteMessages(ctx, batch...); err != nil {
+			metrics.EventPublishErrorsTotal.Add(float64(len(batch)))
+			p.log.Errorf("failed to publish %d events: %v", len(batch), err)
+		}
+		cancel()
+	}
+}
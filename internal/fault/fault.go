@@ -0,0 +1,167 @@
+package fault
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/metrics"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/problem"
+)
+
+// Config configures which faults are injected into which share (0-1) of requests.
+type Config struct {
+	Latency     time.Duration
+	LatencyRate float64
+	Status      int
+	ErrorRate   float64
+	// TruncateBytes is where bodies are cut off; shorter bodies are cut in half.
+	TruncateBytes int64
+	TruncateRate  float64
+	// Header, when set, names a request header forcing faults, e.g.
+	// "latency=2s,status=503,truncate=100".
+	Header string
+}
+
+// Spec is the faults injected into one request.
+type Spec struct {
+	Latency time.Duration
+	// Status answers the request with this status instead of serving it; 0 serves it.
+	Status int
+	// Truncate cuts the body off after this many bytes; negative leaves it intact.
+	Truncate int64
+}
+
+// ParseSpec parses a fault header value such as "latency=2s,status=503,truncate=100".
+func ParseSpec(v string) (Spec, error) {
+	spec := Spec{Truncate: -1}
+	for _, part := range strings.Split(v, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		var err error
+		switch name {
+		case "latency":
+			spec.Latency, err = time.ParseDuration(value)
+		case "status":
+			spec.Status, err = strconv.Atoi(value)
+			if err == nil && (spec.Status < 400 || spec.Status > 599) {
+				err = fmt.Errorf("status %d is not an error", spec.Status)
+			}
+		case "truncate":
+			spec.Truncate, err = strconv.ParseInt(value, 10, 64)
+		default:
+			err = fmt.Errorf("unknown fault %q", name)
+		}
+		if err != nil {
+			return Spec{}, err
+		}
+	}
+	return spec, nil
+}
+
+// choose returns the faults for a request: those of the fault header when present,
+// otherwise each configured fault with its rate.
+func (c Config) choose(r *http.Request) (Spec, bool, error) {
+	if c.Header != "" {
+		if v := r.Header.Get(c.Header); v != "" {
+			spec, err := ParseSpec(v)
+			return spec, err == nil, err
+		}
+	}
+	spec := Spec{Truncate: -1}
+	if c.Latency > 0 && rand.Float64() < c.LatencyRate {
+		spec.Latency = c.Latency
+	}
+	if rand.Float64() < c.ErrorRate {
+		spec.Status = c.Status
+	}
+	if rand.Float64() < c.TruncateRate {
+		spec.Truncate = c.TruncateBytes
+	}
+	return spec, spec.Latency > 0 || spec.Status != 0 || spec.Truncate >= 0, nil
+}
+
+// Middleware injects faults for chaos experiments: it delays requests, answers them with
+// an error status, or cuts their body off and aborts the connection.
+func Middleware(c Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			spec, ok, err := c.choose(r)
+			if err != nil {
+				problem.Error(w, r, http.StatusBadRequest, "invalid "+c.Header+": "+err.Error())
+				return
+			}
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			var injected []string
+			if spec.Latency > 0 {
+				injected = append(injected, "latency")
+				metrics.FaultsInjectedTotal.WithLabelValues("latency").Inc()
+				select {
+				case <-time.After(spec.Latency):
+				case <-r.Context().Done():
+					return
+				}
+			}
+			if spec.Status != 0 {
+				injected = append(injected, "error")
+				metrics.FaultsInjectedTotal.WithLabelValues("error").Inc()
+				logger.AddFields(r, logger.Fields{"fault": strings.Join(injected, ",")})
+				problem.Error(w, r, spec.Status, "injected fault")
+				return
+			}
+			if spec.Truncate >= 0 {
+				injected = append(injected, "truncate")
+				w = &truncateWriter{ResponseWriter: w, limit: spec.Truncate}
+			}
+			logger.AddFields(r, logger.Fields{"fault": strings.Join(injected, ",")})
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// truncateWriter aborts the response after limit body bytes, or half the body when it
+// is shorter, so clients see a connection closed mid-body.
+type truncateWriter struct {
+	http.ResponseWriter
+	limit   int64
+	written int64
+	started bool
+}
+
+func (w *truncateWriter) WriteHeader(status int) {
+	if !w.started && status >= http.StatusOK {
+		w.started = true
+		if n, err := strconv.ParseInt(w.Header().Get("Content-Length"), 10, 64); err == nil && n <= w.limit {
+			w.limit = n / 2
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *truncateWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.written+int64(len(b)) <= w.limit {
+		n, err := w.ResponseWriter.Write(b)
+		w.written += int64(n)
+		return n, err
+	}
+	n, _ := w.ResponseWriter.Write(b[:w.limit-w.written])
+	w.written += int64(n)
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+	metrics.FaultsInjectedTotal.WithLabelValues("truncate").Inc()
+	// http.ErrAbortHandler closes the connection without logging a stack trace
+	panic(http.ErrAbortHandler)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *truncateWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,308 @@
+package filter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// Exports a filter module may provide. Each filter function takes the pointer and length
+// of a JSON document written to memory allocated with alloc, and returns the pointer and
+// length of its JSON answer packed as ptr<<32|len, or 0 for no change.
+const (
+	exportAlloc           = "alloc"
+	exportDealloc         = "dealloc"
+	exportKey             = "filter_key"
+	exportResponseHeaders = "filter_response_headers"
+)
+
+// maxOutput bounds the answer read back from a filter.
+const maxOutput = 1 << 20
+
+// Request describes the client request a filter runs for.
+type Request struct {
+	Method  string            `json:"method"`
+	Host    string            `json:"host"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// KeyCall is the input of filter_key: the route rule prefix and full bucket path
+// ("/bucket/key") the request resolved to.
+type KeyCall struct {
+	Request Request `json:"request"`
+	Rule    string  `json:"rule"`
+	Key     string  `json:"key"`
+}
+
+// KeyResult replaces the bucket path when Key is set. Vary lists the request headers the
+// answer depends on, even when it keeps the key, so shared caches don't serve the object
+// chosen for one header value to every client.
+type KeyResult struct {
+	Key  string   `json:"key"`
+	Vary []string `json:"vary,omitempty"`
+}
+
+// HeadersCall is the input of filter_response_headers: the response status and headers
+// about to be written.
+type HeadersCall struct {
+	Request Request             `json:"request"`
+	Status  int                 `json:"status"`
+	Headers map[string][]string `json:"headers"`
+}
+
+// HeadersResult sets and removes response headers.
+type HeadersResult struct {
+	Set    map[string]string `json:"set"`
+	Remove []string          `json:"remove"`
+}
+
+// Module is a request filter compiled from a WebAssembly module. Filters run sandboxed:
+// they get WASI without filesystem, environment or network access, bounded memory, and
+// are aborted when a call exceeds the timeout. Instances are pooled, as one instance
+// cannot serve concurrent calls, and at most GOMAXPROCS run at once so bursts cannot
+// multiply the memory filters use; further calls wait for an instance.
+type Module struct {
+	Name string
+
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	timeout  time.Duration
+	pool     chan api.Module
+	// slots holds a token per live instance, bounding them to its capacity.
+	slots chan struct{}
+
+	hasKey, hasHeaders bool
+}
+
+// Load compiles the module at path. Calls are aborted after timeout, and its memory is
+// limited to memoryLimitMB.
+func Load(ctx context.Context, path string, timeout time.Duration, memoryLimitMB int) (*Module, error) {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rt := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithMemoryLimitPages(uint32(memoryLimitMB)*16))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, rt); err != nil {
+		rt.Close(ctx)
+		return nil, err
+	}
+	compiled, err := rt.CompileModule(ctx, code)
+	if err != nil {
+		rt.Close(ctx)
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	exports := compiled.ExportedFunctions()
+	m := &Module{
+		Name:       strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		runtime:    rt,
+		compiled:   compiled,
+		timeout:    timeout,
+		pool:       make(chan api.Module, runtime.GOMAXPROCS(0)),
+		slots:      make(chan struct{}, runtime.GOMAXPROCS(0)),
+		hasKey:     exports[exportKey] != nil,
+		hasHeaders: exports[exportResponseHeaders] != nil,
+	}
+	if exports[exportAlloc] == nil || !m.hasKey && !m.hasHeaders || len(compiled.ExportedMemories()) == 0 {
+		rt.Close(ctx)
+		return nil, fmt.Errorf("%s: must export its memory, %s and %s or %s", path, exportAlloc, exportKey, exportResponseHeaders)
+	}
+	if err := checkExports(exports); err != nil {
+		rt.Close(ctx)
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	// Fail at startup rather than on the first request when the module cannot start
+	m.slots <- struct{}{}
+	inst, err := m.instantiate(ctx)
+	if err != nil {
+		rt.Close(ctx)
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m.put(inst)
+	return m, nil
+}
+
+// checkExports verifies the signatures of the exports calls rely on: alloc(len) -> ptr,
+// dealloc(ptr, len), and filter functions (ptr, len) -> i64 packing the answer.
+func checkExports(exports map[string]api.FunctionDefinition) error {
+	isInt := func(t api.ValueType) bool { return t == api.ValueTypeI32 || t == api.ValueTypeI64 }
+	check := func(name string, params int, result func(api.ValueType) bool, want string) error {
+		def := exports[name]
+		if def == nil {
+			return nil
+		}
+		ok := len(def.ParamTypes()) == params
+		for _, t := range def.ParamTypes() {
+			ok = ok && isInt(t)
+		}
+		if result != nil {
+			ok = ok && len(def.ResultTypes()) == 1 && result(def.ResultTypes()[0])
+		}
+		if !ok {
+			return fmt.Errorf("%s must have the signature %s", name, want)
+		}
+		return nil
+	}
+	isI64 := func(t api.ValueType) bool { return t == api.ValueTypeI64 }
+	return errors.Join(
+		check(exportAlloc, 1, isInt, "(len i32) -> ptr i32"),
+		check(exportDealloc, 2, nil, "(ptr i32, len i32)"),
+		check(exportKey, 2, isI64, "(ptr i32, len i32) -> i64"),
+		check(exportResponseHeaders, 2, isI64, "(ptr i32, len i32) -> i64"),
+	)
+}
+
+// HasKey reports whether the module filters resolved keys.
+func (m *Module) HasKey() bool { return m.hasKey }
+
+// HasResponseHeaders reports whether the module filters response headers.
+func (m *Module) HasResponseHeaders() bool { return m.hasHeaders }
+
+// Key calls filter_key.
+func (m *Module) Key(ctx context.Context, in KeyCall) (KeyResult, error) {
+	var out KeyResult
+	err := m.call(ctx, exportKey, in, &out)
+	return out, err
+}
+
+// ResponseHeaders calls filter_response_headers.
+func (m *Module) ResponseHeaders(ctx context.Context, in HeadersCall) (HeadersResult, error) {
+	var out HeadersResult
+	err := m.call(ctx, exportResponseHeaders, in, &out)
+	return out, err
+}
+
+// Close releases the module's instances and compiled code.
+func (m *Module) Close(ctx context.Context) error {
+	return m.runtime.Close(ctx)
+}
+
+func (m *Module) instantiate(ctx context.Context) (api.Module, error) {
+	// Reactor modules (e.g. Go's -buildmode=c-shared) initialize in _initialize; _start
+	// would run and exit a command module's main.
+	return m.runtime.InstantiateModule(ctx, m.compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize").
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader))
+}
+
+// get takes an idle instance or, below the instance limit, starts one, waiting until ctx
+// is done for either. Starting is not bound by ctx, as language runtimes may take longer
+// to initialize than a filter call.
+func (m *Module) get(ctx context.Context) (api.Module, error) {
+	select {
+	case inst := <-m.pool:
+		return inst, nil
+	default:
+	}
+	select {
+	case inst := <-m.pool:
+		return inst, nil
+	case m.slots <- struct{}{}:
+		inst, err := m.instantiate(context.Background())
+		if err != nil {
+			<-m.slots
+		}
+		return inst, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (m *Module) put(inst api.Module) {
+	select {
+	case m.pool <- inst:
+	default:
+		m.discard(inst)
+	}
+}
+
+// discard closes inst and frees its slot.
+func (m *Module) discard(inst api.Module) {
+	inst.Close(context.Background())
+	<-m.slots
+}
+
+// call runs fn with in as JSON and decodes its answer into out, leaving out untouched
+// when the filter returns 0.
+func (m *Module) call(ctx context.Context, fn string, in, out any) error {
+	input, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+	inst, err := m.get(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: waiting for an instance: %w", fn, err)
+	}
+	output, err := invoke(ctx, inst, fn, input)
+	if err != nil {
+		// The instance is closed when the call timed out, and its state is unknown otherwise
+		m.discard(inst)
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s: %w", fn, ctx.Err())
+		}
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	m.put(inst)
+	if output == nil {
+		return nil
+	}
+	return json.Unmarshal(output, out)
+}
+
+func invoke(ctx context.Context, inst api.Module, fn string, input []byte) ([]byte, error) {
+	res, err := inst.ExportedFunction(exportAlloc).Call(ctx, uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	ptr := uint32(res[0])
+	if !inst.Memory().Write(ptr, input) {
+		return nil, errors.New("alloc returned memory out of range")
+	}
+	res, err = inst.ExportedFunction(fn).Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	dealloc := inst.ExportedFunction(exportDealloc)
+	if dealloc != nil {
+		if _, err := dealloc.Call(ctx, uint64(ptr), uint64(len(input))); err != nil {
+			return nil, err
+		}
+	}
+	if res[0] == 0 {
+		return nil, nil
+	}
+	outPtr, outLen := uint32(res[0]>>32), uint32(res[0])
+	if outLen > maxOutput {
+		return nil, fmt.Errorf("answer of %d bytes exceeds %d", outLen, maxOutput)
+	}
+	b, ok := inst.Memory().Read(outPtr, outLen)
+	if !ok {
+		return nil, errors.New("answer out of memory range")
+	}
+	// Read aliases the module's memory, which the next call may overwrite
+	output := append([]byte(nil), b...)
+	if dealloc != nil {
+		if _, err := dealloc.Call(ctx, uint64(outPtr), uint64(outLen)); err != nil {
+			return nil, err
+		}
+	}
+	return output, nil
+}
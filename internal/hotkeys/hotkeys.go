@@ -0,0 +1,110 @@
+package hotkeys
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+)
+
+// Key is a requested object and its approximate traffic.
+type Key struct {
+	Key   string `json:"key"`
+	Hits  int64  `json:"hits"`
+	Bytes int64  `json:"bytes"`
+	// Error bounds how much Hits may overcount: the hits of the key it replaced when it
+	// entered the tracker.
+	Error int64 `json:"error"`
+}
+
+// Tracker finds the most requested keys in bounded memory with the Space-Saving
+// algorithm: it counts up to capacity keys, and a new key replaces the least requested
+// one, inheriting its count as an error bound. Any key requested more often than
+// 1/capacity of all requests is guaranteed to be tracked.
+type Tracker struct {
+	capacity int
+
+	mu   sync.Mutex
+	keys map[string]*entry
+	heap entries
+}
+
+type entry struct {
+	Key
+	index int
+}
+
+// New returns a Tracker counting up to capacity keys.
+func New(capacity int) *Tracker {
+	return &Tracker{capacity: capacity, keys: make(map[string]*entry, capacity)}
+}
+
+// Record counts a request for key that sent bytes.
+func (t *Tracker) Record(key string, bytes int64) {
+	if t == nil || key == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e, ok := t.keys[key]; ok {
+		e.Hits++
+		e.Bytes += bytes
+		heap.Fix(&t.heap, e.index)
+		return
+	}
+	if len(t.heap) < t.capacity {
+		e := &entry{Key: Key{Key: key, Hits: 1, Bytes: bytes}}
+		t.keys[key] = e
+		heap.Push(&t.heap, e)
+		return
+	}
+	// Replace the least requested key
+	e := t.heap[0]
+	delete(t.keys, e.Key.Key)
+	e.Key = Key{Key: key, Hits: e.Hits + 1, Bytes: bytes, Error: e.Hits}
+	t.keys[key] = e
+	heap.Fix(&t.heap, 0)
+}
+
+// Top returns the n most requested keys, most requested first.
+func (t *Tracker) Top(n int) []Key {
+	t.mu.Lock()
+	top := make([]Key, 0, len(t.heap))
+	for _, e := range t.heap {
+		top = append(top, e.Key)
+	}
+	t.mu.Unlock()
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Hits != top[j].Hits {
+			return top[i].Hits > top[j].Hits
+		}
+		return top[i].Key < top[j].Key
+	})
+	if n < len(top) {
+		top = top[:n]
+	}
+	return top
+}
+
+// entries is a min-heap of entries by hits.
+type entries []*entry
+
+func (h entries) Len() int           { return len(h) }
+func (h entries) Less(i, j int) bool { return h[i].Hits < h[j].Hits }
+
+func (h entries) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *entries) Push(x any) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *entries) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
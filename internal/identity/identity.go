@@ -0,0 +1,70 @@
+package identity
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Header carries the base64-encoded identity JSON set by 3scale/turnpike in front of Insights services.
+const Header = "x-rh-identity"
+
+// ErrMissing is returned when a request has no identity header.
+var ErrMissing = errors.New("missing " + Header + " header")
+
+// Identity is the subset of the x-rh-identity document used by the proxy.
+type Identity struct {
+	OrgID         string `json:"org_id"`
+	AccountNumber string `json:"account_number"`
+	Type          string `json:"type"`
+	Internal      struct {
+		OrgID string `json:"org_id"`
+	} `json:"internal"`
+}
+
+// Org returns the organization ID, falling back to the legacy internal org ID
+// and then the account number.
+func (id *Identity) Org() string {
+	switch {
+	case id.OrgID != "":
+		return id.OrgID
+	case id.Internal.OrgID != "":
+		return id.Internal.OrgID
+	}
+	return id.AccountNumber
+}
+
+// FromRequest decodes the identity header of r.
+func FromRequest(r *http.Request) (*Identity, error) {
+	v := r.Header.Get(Header)
+	if v == "" {
+		return nil, ErrMissing
+	}
+	raw, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", Header, err)
+	}
+	var doc struct {
+		Identity Identity `json:"identity"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", Header, err)
+	}
+	return &doc.Identity, nil
+}
+
+// TrustedOnly drops the identity header of requests that did not arrive through a
+// trusted gateway, so clients reaching the proxy directly cannot pick their org for
+// REQUIRE_IDENTITY, per-org rate limiting or access logs.
+func TrustedOnly(trusted func(r *http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(Header) != "" && !trusted(r) {
+				r.Header.Del(Header)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
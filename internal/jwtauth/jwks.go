@@ -0,0 +1,191 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// minRefetch limits how often an unknown key ID triggers a refetch, so tokens with made-up
+// key IDs cannot hammer the JWKS endpoint.
+const minRefetch = time.Minute
+
+// KeySet is a JSON Web Key Set fetched from a URL and kept current: it is refreshed every
+// interval and when a token names an unknown key ID, so signing key rotations are picked
+// up without a restart. The last good keys are kept while the endpoint is failing.
+type KeySet struct {
+	url      string
+	interval time.Duration
+	client   *http.Client
+
+	refreshing sync.Mutex
+	mu         sync.RWMutex
+	keys       map[string]any
+	fetched    time.Time
+	attempted  time.Time
+}
+
+// NewKeySet returns a KeySet for the JWKS document at url. Keys are fetched on first use.
+func NewKeySet(url string, interval time.Duration) *KeySet {
+	return &KeySet{url: url, interval: interval, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Key returns the public key with ID kid. An empty kid matches the only key of a set.
+func (ks *KeySet) Key(ctx context.Context, kid string) (any, error) {
+	ks.mu.RLock()
+	key, found := ks.lookup(kid)
+	stale := time.Since(ks.fetched) > ks.interval
+	ks.mu.RUnlock()
+	if found && !stale {
+		return key, nil
+	}
+	if err := ks.refresh(ctx, !found); err != nil && !found {
+		return nil, err
+	}
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if key, found := ks.lookup(kid); found {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key ID %q", kid)
+}
+
+func (ks *KeySet) lookup(kid string) (any, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// refresh fetches the key set unless another caller just did. missing forces a fetch for
+// an unknown key ID, at most once per minRefetch.
+func (ks *KeySet) refresh(ctx context.Context, missing bool) error {
+	ks.refreshing.Lock()
+	defer ks.refreshing.Unlock()
+	ks.mu.RLock()
+	fresh := time.Since(ks.fetched) <= ks.interval
+	recent := time.Since(ks.attempted) < minRefetch
+	ks.mu.RUnlock()
+	if (fresh && !missing) || recent {
+		return nil
+	}
+
+	keys, err := ks.fetch(ctx)
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.attempted = time.Now()
+	if err != nil {
+		return err
+	}
+	ks.keys, ks.fetched = keys, ks.attempted
+	return nil
+}
+
+func (ks *KeySet) fetch(ctx context.Context) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch JWKS: %s", resp.Status)
+	}
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(nil, resp.Body, 1<<20)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parse JWKS: %w", err)
+	}
+	keys := make(map[string]any, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		// Keys of unsupported types are skipped rather than failing the whole set
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no usable signing keys")
+	}
+	return keys, nil
+}
+
+// jwk is a public JSON Web Key (RFC 7517) of type RSA, EC or OKP (Ed25519).
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+var curves = map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+	case "EC":
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("invalid EC point")
+		}
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
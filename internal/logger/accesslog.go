@@ -0,0 +1,83 @@
+package logger
+
+import (
+	"bytes"
+	"net"
+	"text/template"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Predefined access log formats, matching Apache's common and combined log formats.
+const (
+	commonLogFormat   = `{{.RemoteHost}} - - [{{.Time.Format "02/Jan/2006:15:04:05 -0700"}}] "{{.Method}} {{.URI}} {{.Proto}}" {{.Status}} {{if .Bytes}}{{.Bytes}}{{else}}-{{end}}`
+	combinedLogFormat = commonLogFormat + ` "{{or .Referer "-"}}" "{{or .UserAgent "-"}}"`
+)
+
+// AccessLogLine is the data available to access log templates.
+type AccessLogLine struct {
+	RemoteHost string
+	Time       time.Time
+	Method     string
+	Host       string
+	URI        string
+	Proto      string
+	Status     int
+	Bytes      int
+	Duration   time.Duration
+	RequestID  string
+	Referer    string
+	UserAgent  string
+	// Headers holds the captured request headers by field name, e.g. .Headers.org_id.
+	Headers map[string]string
+	// Fields holds the fields handlers added with AddFields, e.g. .Fields.s3_request_id.
+	Fields Fields
+}
+
+// ParseAccessLogFormat returns the template for an ACCESS_LOG_FORMAT value: "common",
+// "combined", or a Go template over AccessLogLine. It returns nil for "" and "default",
+// which keep the built-in log line.
+func ParseAccessLogFormat(format string) (*template.Template, error) {
+	switch format {
+	case "", "default":
+		return nil, nil
+	case "common":
+		format = commonLogFormat
+	case "combined":
+		format = combinedLogFormat
+	}
+	return template.New("accesslog").Parse(format)
+}
+
+func (l *LogEntry) writeAccessLog(status, size int, elapsed time.Duration) {
+	r := l.request
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	line := AccessLogLine{
+		RemoteHost: host,
+		Time:       l.start,
+		Method:     r.Method,
+		Host:       r.Host,
+		URI:        r.RequestURI,
+		Proto:      r.Proto,
+		Status:     status,
+		Bytes:      size,
+		Duration:   elapsed,
+		RequestID:  middleware.GetReqID(r.Context()),
+		Referer:    r.Referer(),
+		UserAgent:  r.UserAgent(),
+		Headers:    capturedHeaders(r, l.CaptureHeaders),
+		Fields:     l.fields,
+	}
+	var buf bytes.Buffer
+	if err := l.AccessLog.Execute(&buf, line); err != nil {
+		l.Logger.Errorf("access log template: %v", err)
+		return
+	}
+	buf.WriteByte('\n')
+	// One write per line keeps concurrent requests from interleaving
+	l.Out.Write(buf.Bytes())
+}
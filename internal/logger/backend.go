@@ -0,0 +1,177 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Fields are structured fields attached to a log entry.
+type Fields map[string]any
+
+// Logger is what the proxy logs through, so the backend producing the lines (logrus or a
+// log/slog handler) is a deployment choice rather than a dependency of every package.
+type Logger interface {
+	WithFields(fields Fields) Logger
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+	Errorf(format string, args ...any)
+	// Fatalf logs at error level and exits the process.
+	Fatalf(format string, args ...any)
+}
+
+// Backends selectable with New.
+const (
+	BackendLogrus = "logrus"
+	BackendSlog   = "slog"
+)
+
+// Root is the process logger built from the configuration. Its output can be replaced
+// once the configured destinations are open; loggers derived from it follow.
+type Root struct {
+	Logger
+	// Level is the minimum level written.
+	Level slog.Level
+
+	backend string
+	format  string
+	out     *switchWriter
+	// debug serves requests that asked for debug logging.
+	debug Logger
+}
+
+// New returns a Root logger writing to stderr with backend ("logrus" or "slog") in format
+// ("text" or "json") at level ("debug", "info", "warn" or "error"). An unknown level
+// falls back to error, as it always has.
+func New(backend, format, level string) (*Root, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		lvl = slog.LevelError
+	}
+	backend, format = strings.ToLower(backend), strings.ToLower(format)
+	if backend != BackendLogrus && backend != BackendSlog {
+		return nil, fmt.Errorf("unknown log backend %q: want logrus or slog", backend)
+	}
+	if format != "text" && format != "json" {
+		return nil, fmt.Errorf("unknown log format %q: want text or json", format)
+	}
+	r := &Root{Level: lvl, backend: backend, format: format, out: &switchWriter{}}
+	r.out.Set(os.Stderr)
+	r.Logger = r.AtLevel(lvl)
+	r.debug = r.AtLevel(slog.LevelDebug)
+	return r, nil
+}
+
+// SetOutput sends the output of the Root and every logger derived from it to w.
+func (r *Root) SetOutput(w io.Writer) { r.out.Set(w) }
+
+// Writer returns the Root's output, for lines written as they are, such as templated
+// access log lines.
+func (r *Root) Writer() io.Writer { return r.out }
+
+// AtLevel returns a logger writing to the Root's output at level instead of the Root's,
+// for messages that must be seen whatever LOG_LEVEL is.
+func (r *Root) AtLevel(level slog.Level) Logger {
+	if r.backend == BackendSlog {
+		opts := &slog.HandlerOptions{Level: level}
+		if r.format == "json" {
+			return FromSlog(slog.New(slog.NewJSONHandler(r.out, opts)))
+		}
+		return FromSlog(slog.New(slog.NewTextHandler(r.out, opts)))
+	}
+	l := logrus.New()
+	l.SetOutput(r.out)
+	l.SetLevel(logrusLevel(level))
+	if r.format == "json" {
+		l.SetFormatter(&logrus.JSONFormatter{})
+	}
+	return logrusLogger{logrus.NewEntry(l)}
+}
+
+// ParseLevel parses a level name. Logrus's trace, fatal and panic map to the closest
+// level.
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "trace", "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error", "fatal", "panic":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// FromSlog adapts a slog logger, so any slog.Handler, including bridges to other
+// libraries such as zap, can back the proxy's logging.
+func FromSlog(l *slog.Logger) Logger { return slogLogger{l} }
+
+type slogLogger struct{ l *slog.Logger }
+
+func (l slogLogger) WithFields(fields Fields) Logger {
+	args := make([]any, 0, 2*len(fields))
+	for _, k := range slices.Sorted(maps.Keys(fields)) {
+		args = append(args, k, fields[k])
+	}
+	return slogLogger{l.l.With(args...)}
+}
+
+func (l slogLogger) Debugf(format string, args ...any) { l.log(slog.LevelDebug, format, args) }
+func (l slogLogger) Infof(format string, args ...any)  { l.log(slog.LevelInfo, format, args) }
+func (l slogLogger) Warnf(format string, args ...any)  { l.log(slog.LevelWarn, format, args) }
+func (l slogLogger) Errorf(format string, args ...any) { l.log(slog.LevelError, format, args) }
+
+func (l slogLogger) Fatalf(format string, args ...any) {
+	l.log(slog.LevelError, format, args)
+	os.Exit(1)
+}
+
+func (l slogLogger) log(level slog.Level, format string, args []any) {
+	ctx := context.Background()
+	if !l.l.Enabled(ctx, level) {
+		return
+	}
+	l.l.Log(ctx, level, fmt.Sprintf(format, args...))
+}
+
+type logrusLogger struct{ e *logrus.Entry }
+
+func (l logrusLogger) WithFields(fields Fields) Logger {
+	return logrusLogger{l.e.WithFields(logrus.Fields(fields))}
+}
+
+func (l logrusLogger) Debugf(format string, args ...any) { l.e.Debugf(format, args...) }
+func (l logrusLogger) Infof(format string, args ...any)  { l.e.Infof(format, args...) }
+func (l logrusLogger) Warnf(format string, args ...any)  { l.e.Warnf(format, args...) }
+func (l logrusLogger) Errorf(format string, args ...any) { l.e.Errorf(format, args...) }
+func (l logrusLogger) Fatalf(format string, args ...any) { l.e.Fatalf(format, args...) }
+
+func logrusLevel(level slog.Level) logrus.Level {
+	switch {
+	case level <= slog.LevelDebug:
+		return logrus.DebugLevel
+	case level <= slog.LevelInfo:
+		return logrus.InfoLevel
+	case level <= slog.LevelWarn:
+		return logrus.WarnLevel
+	}
+	return logrus.ErrorLevel
+}
+
+// switchWriter forwards to a writer that can be replaced while logging.
+type switchWriter struct{ w atomic.Pointer[io.Writer] }
+
+func (s *switchWriter) Set(w io.Writer) { s.w.Store(&w) }
+
+func (s *switchWriter) Write(p []byte) (int, error) { return (*s.w.Load()).Write(p) }
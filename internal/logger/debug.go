@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+)
+
+type debugKey struct{}
+
+// DebugRequests marks requests whose header carries token for debug logging, so a
+// single failing request can be traced without lowering LOG_LEVEL for the fleet.
+// An empty token disables it.
+func DebugRequests(header, token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if token == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if v := r.Header.Get(header); v != "" && subtle.ConstantTimeCompare([]byte(v), []byte(token)) == 1 {
+				r = r.WithContext(context.WithValue(r.Context(), debugKey{}, true))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Debug reports whether the request in ctx asked for debug logging.
+func Debug(ctx context.Context) bool {
+	debug, _ := ctx.Value(debugKey{}).(bool)
+	return debug
+}
+
+// For returns l, or a debug level logger with the same output when the request in ctx
+// asked for debug logging.
+func For(ctx context.Context, l Logger) Logger {
+	if root, ok := l.(*Root); ok && Debug(ctx) {
+		return root.debug
+	}
+	return l
+}
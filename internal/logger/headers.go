@@ -0,0 +1,38 @@
+package logger
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/identity"
+)
+
+// headerFields returns the captured request headers as log fields named after the
+// header, e.g. "user_agent". The identity header is never logged as is: only the
+// organization it carries is, as "org_id".
+func (l *LogEntry) headerFields() Fields {
+	fields := Fields{}
+	for name, value := range capturedHeaders(l.request, l.CaptureHeaders) {
+		fields[name] = value
+	}
+	return fields
+}
+
+func capturedHeaders(r *http.Request, names []string) map[string]string {
+	if len(names) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(names))
+	for _, name := range names {
+		if strings.EqualFold(name, identity.Header) {
+			if id, err := identity.FromRequest(r); err == nil && id.Org() != "" {
+				out["org_id"] = id.Org()
+			}
+			continue
+		}
+		if v := r.Header.Get(name); v != "" {
+			out[strings.ReplaceAll(strings.ToLower(name), "-", "_")] = v
+		}
+	}
+	return out
+}
@@ -4,30 +4,60 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"maps"
 	"net/http"
+	"text/template"
 	"time"
 
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/tracecontext"
 	"github.com/aws/smithy-go/logging"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/sirupsen/logrus"
 )
 
 type StructuredLogger struct {
-	Logger   *logrus.Logger
-	LogLevel logrus.Level
+	Logger   Logger
+	LogLevel slog.Level
+	// Out receives access log lines rendered with AccessLog.
+	Out io.Writer
+	// AccessLog, when set, renders every request's access log line instead of the
+	// built-in format, regardless of LogLevel.
+	AccessLog *template.Template
+	// Sampling, when set, drops the access log lines of excluded or unsampled requests.
+	Sampling *Sampling
+	// CaptureHeaders lists request headers added to access log lines as fields.
+	CaptureHeaders []string
 }
 
 type LogEntry struct {
 	*StructuredLogger
 	request  *http.Request
+	start    time.Time
 	buf      *bytes.Buffer
 	useColor bool
+	// fields are added by handlers through AddFields.
+	fields Fields
+}
+
+// AddFields adds fields to the access log line of r, so handlers can report what serving
+// it involved, such as the object storage request ID.
+func AddFields(r *http.Request, fields Fields) {
+	entry, ok := middleware.GetLogEntry(r).(*LogEntry)
+	if !ok {
+		return
+	}
+	if entry.fields == nil {
+		entry.fields = Fields{}
+	}
+	maps.Copy(entry.fields, fields)
 }
 
 func (l *StructuredLogger) NewLogEntry(r *http.Request) middleware.LogEntry {
 	entry := &LogEntry{
 		StructuredLogger: l,
 		request:          r,
+		start:            time.Now(),
 		buf:              &bytes.Buffer{},
 		useColor:         false,
 	}
@@ -54,8 +84,17 @@ func (l *StructuredLogger) NewLogEntry(r *http.Request) middleware.LogEntry {
 }
 
 func (l *LogEntry) Write(status, bytes int, header http.Header, elapsed time.Duration, extra interface{}) {
+	if l.Sampling != nil && !l.Sampling.Keep(l.request.URL.Path, status) {
+		return
+	}
+	if l.AccessLog != nil {
+		l.writeAccessLog(status, bytes, elapsed)
+		return
+	}
+
+	debug := Debug(l.request.Context())
 	// Do nothing if status code is 200/201/eg and the log level is above Warn (3)
-	if (l.LogLevel <= logrus.WarnLevel) && (status < 400) {
+	if (l.LogLevel >= slog.LevelWarn) && (status < 400) && !debug {
 		return
 	}
 
@@ -71,69 +110,73 @@ func (l *LogEntry) Write(status, bytes int, header http.Header, elapsed time.Dur
 		fmt.Fprintf(l.buf, "%s", elapsed)
 	}
 
-	l.Logger.Print(l.buf.String())
+	For(l.request.Context(), l.Logger).WithFields(TraceFields(l.request.Context())).WithFields(l.headerFields()).WithFields(l.fields).Infof("%s", l.buf.String())
 }
 
 func (l *LogEntry) Panic(v interface{}, stack []byte) {
 	middleware.PrintPrettyStack(v)
 }
 
-func NewLogger(lvl string, logger *logrus.Logger) *StructuredLogger {
-	logLevel, err := logrus.ParseLevel(lvl)
-	if err != nil {
-		logLevel = logrus.ErrorLevel
-	}
-	logger.SetLevel(logLevel)
+func NewLogger(root *Root) *StructuredLogger {
 	return &StructuredLogger{
-		Logger:   logger,
-		LogLevel: logLevel,
+		Logger:   root,
+		LogLevel: root.Level,
+		Out:      root.Writer(),
 	}
 }
 
 // ContextAwareLogger implements smithy logging.Logger and logging.ContextLogger.
 // It enriches AWS SDK logs with chi's request ID when available.
-type ContextAwareLogger struct{ Base *logrus.Logger }
+type ContextAwareLogger struct{ Base Logger }
 
 type requestLoggerWithID struct {
-	Base  *logrus.Logger
-	ReqID string
+	Base   Logger
+	ReqID  string
+	Fields Fields
 }
 
 func (l ContextAwareLogger) WithContext(ctx context.Context) logging.Logger {
 	rid := middleware.GetReqID(ctx)
-	return requestLoggerWithID{Base: l.Base, ReqID: rid}
+	return requestLoggerWithID{Base: l.Base, ReqID: rid, Fields: TraceFields(ctx)}
+}
+
+// TraceFields returns the trace_id and span_id log fields of the trace the request in ctx
+// belongs to, or no fields when it carried no traceparent.
+func TraceFields(ctx context.Context) Fields {
+	tc, ok := tracecontext.FromContext(ctx)
+	if !ok {
+		return Fields{}
+	}
+	return Fields{"trace_id": tc.TraceID, "span_id": tc.SpanID}
 }
 
 // Fallback when no context is provided by the SDK
 func (l ContextAwareLogger) Logf(class logging.Classification, format string, v ...interface{}) {
-	entry := l.Base.WithFields(logrus.Fields{
+	entry := l.Base.WithFields(Fields{
 		"process": "s3client",
 	})
 	logWith(entry, "", class, format, v...)
 }
 
 func (l requestLoggerWithID) Logf(class logging.Classification, format string, v ...interface{}) {
-	entry := l.Base.WithFields(logrus.Fields{
+	entry := l.Base.WithFields(l.Fields).WithFields(Fields{
 		"process": "s3client",
 	})
 	if l.ReqID != "" {
-		entry = entry.WithField("request_id", l.ReqID)
+		entry = entry.WithFields(Fields{"request_id": l.ReqID})
 	}
 	logWith(entry, l.ReqID, class, format, v...)
 }
 
-// map smithy classification to logrus level
-func levelFor(class logging.Classification) logrus.Level {
-	if class == logging.Warn {
-		return logrus.WarnLevel
-	}
-	return logrus.DebugLevel
-}
-
-// logWith prefixes the message with the request ID (if any) and logs at the mapped level
-func logWith(entry *logrus.Entry, reqID string, class logging.Classification, format string, v ...interface{}) {
+// logWith prefixes the message with the request ID (if any) and logs smithy's Warn
+// classification as a warning, everything else at debug level
+func logWith(entry Logger, reqID string, class logging.Classification, format string, v ...interface{}) {
 	if reqID != "" {
 		format = fmt.Sprintf("[%s] %s", reqID, format)
 	}
-	entry.Logf(levelFor(class), format, v...)
+	if class == logging.Warn {
+		entry.Warnf(format, v...)
+		return
+	}
+	entry.Debugf(format, v...)
 }
@@ -0,0 +1,112 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// OutputOptions configure where logs are written in addition to stderr.
+type OutputOptions struct {
+	File   FileOptions
+	Syslog SyslogOptions
+	// Sinks are further destinations, such as a CloudWatch Logs stream.
+	Sinks []io.WriteCloser
+	// RedactParams are the query parameters whose values are removed from every log line,
+	// along with credential headers and bearer tokens.
+	RedactParams []string
+}
+
+// FileOptions configure a rotated log file.
+type FileOptions struct {
+	Path string
+	// MaxSizeMB is the size at which the file is rotated.
+	MaxSizeMB int
+	// MaxAgeDays and MaxBackups bound the rotated files kept; 0 keeps all.
+	MaxAgeDays int
+	MaxBackups int
+	Compress   bool
+}
+
+// SyslogOptions configure a syslog endpoint.
+type SyslogOptions struct {
+	// Address is "udp://host:514", "tcp://host:514" or "unix:///dev/log".
+	Address string
+	// Facility is a syslog facility name such as "daemon" or "local0".
+	Facility string
+	Tag      string
+}
+
+var facilities = map[string]syslog.Priority{
+	"kern": syslog.LOG_KERN, "user": syslog.LOG_USER, "mail": syslog.LOG_MAIL, "daemon": syslog.LOG_DAEMON,
+	"auth": syslog.LOG_AUTH, "syslog": syslog.LOG_SYSLOG, "lpr": syslog.LOG_LPR, "news": syslog.LOG_NEWS,
+	"uucp": syslog.LOG_UUCP, "cron": syslog.LOG_CRON, "authpriv": syslog.LOG_AUTHPRIV, "ftp": syslog.LOG_FTP,
+	"local0": syslog.LOG_LOCAL0, "local1": syslog.LOG_LOCAL1, "local2": syslog.LOG_LOCAL2, "local3": syslog.LOG_LOCAL3,
+	"local4": syslog.LOG_LOCAL4, "local5": syslog.LOG_LOCAL5, "local6": syslog.LOG_LOCAL6, "local7": syslog.LOG_LOCAL7,
+}
+
+// NewOutput returns the writer logs go to: stderr, plus a rotated file, a syslog endpoint
+// and sinks when configured, for deployments without a log collector sidecar. Credentials
+// are redacted before any destination sees a line. closer closes the extra destinations.
+func NewOutput(opts OutputOptions) (out io.Writer, closer func() error, err error) {
+	writers := []io.Writer{os.Stderr}
+	var closers []io.Closer
+	if opts.File.Path != "" {
+		rotated := &lumberjack.Logger{
+			Filename:   opts.File.Path,
+			MaxSize:    opts.File.MaxSizeMB,
+			MaxAge:     opts.File.MaxAgeDays,
+			MaxBackups: opts.File.MaxBackups,
+			Compress:   opts.File.Compress,
+		}
+		writers, closers = append(writers, rotated), append(closers, rotated)
+	}
+	if opts.Syslog.Address != "" {
+		w, err := dialSyslog(opts.Syslog)
+		if err != nil {
+			return nil, nil, err
+		}
+		writers, closers = append(writers, w), append(closers, w)
+	}
+	for _, sink := range opts.Sinks {
+		writers, closers = append(writers, sink), append(closers, sink)
+	}
+	closer = func() error {
+		for _, c := range closers {
+			c.Close()
+		}
+		return nil
+	}
+	return Redact(io.MultiWriter(writers...), opts.RedactParams), closer, nil
+}
+
+func dialSyslog(opts SyslogOptions) (*syslog.Writer, error) {
+	u, err := url.Parse(opts.Address)
+	if err != nil {
+		return nil, fmt.Errorf("syslog address: %w", err)
+	}
+	facility, ok := facilities[strings.ToLower(opts.Facility)]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", opts.Facility)
+	}
+	var network, addr string
+	switch u.Scheme {
+	case "udp", "tcp":
+		network, addr = u.Scheme, u.Host
+	case "unix":
+		// Local syslog daemons usually listen on a datagram socket; a stream socket is tried next
+		network, addr = "unixgram", u.Path
+	default:
+		return nil, fmt.Errorf("syslog address %q: want udp://, tcp:// or unix://", opts.Address)
+	}
+	w, err := syslog.Dial(network, addr, facility|syslog.LOG_INFO, opts.Tag)
+	if err != nil && u.Scheme == "unix" {
+		w, err = syslog.Dial("unix", addr, facility|syslog.LOG_INFO, opts.Tag)
+	}
+	return w, err
+}
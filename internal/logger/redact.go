@@ -0,0 +1,61 @@
+package logger
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+// DefaultRedactedParams are query parameters whose values never reach the logs.
+var DefaultRedactedParams = []string{
+	"token", "access_token", "id_token", "code", "password", "secret", "signature", "sig",
+	"X-Amz-Signature", "X-Amz-Credential", "X-Amz-Security-Token", "Signature", "Policy", "Key-Pair-Id",
+}
+
+// redactedHeaders are headers whose values never reach the logs, including the request
+// dumps of the AWS SDK's LogRequest and LogRequestWithBody modes.
+var redactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Amz-Security-Token", "X-Rh-Identity"}
+
+const redacted = "[REDACTED]"
+
+// redactor rewrites log output so credentials are removed from every destination,
+// whichever call site or library produced the line.
+type redactor struct {
+	w     io.Writer
+	rules []redaction
+}
+
+type redaction struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+// Redact returns a writer that strips the values of params (query parameters), the
+// credential headers and bearer tokens from each log entry before writing it to w.
+func Redact(w io.Writer, params []string) io.Writer {
+	quoted := func(names []string) string {
+		q := make([]string, len(names))
+		for i, n := range names {
+			q[i] = regexp.QuoteMeta(n)
+		}
+		return strings.Join(q, "|")
+	}
+	return &redactor{w: w, rules: []redaction{
+		// name=value in URLs and query strings, up to the next separator or quote
+		{regexp.MustCompile(`(?i)([?&;](?:` + quoted(params) + `)=)[^&;\s"'\\]*`), "${1}" + redacted},
+		// "Name: value" header lines, which logrus escapes as \r\n inside quoted messages
+		{regexp.MustCompile(`(?i)((?:^|\\n|\n|\s)(?:` + quoted(redactedHeaders) + `):\s*)[^\r\n\\]*`), "${1}" + redacted},
+		{regexp.MustCompile(`(?i)(\bbearer\s+)[a-z0-9\-._~+/]+=*`), "${1}" + redacted},
+	}}
+}
+
+func (r *redactor) Write(p []byte) (int, error) {
+	out := p
+	for _, rule := range r.rules {
+		out = rule.re.ReplaceAll(out, []byte(rule.repl))
+	}
+	if _, err := r.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,40 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// requestIDPrefix makes generated request IDs unique across replicas and restarts, in
+// chi's "host/random-000001" form.
+var requestIDPrefix = func() string {
+	hostname, err := os.Hostname()
+	if hostname == "" || err != nil {
+		hostname = "localhost"
+	}
+	return hostname + "/" + rand.Text()[:10]
+}()
+
+// RequestID is chi's RequestID middleware reading the inbound request ID from header,
+// e.g. the edge's x-rh-insights-request-id, instead of X-Request-Id. The ID, received or
+// generated, is stored where middleware.GetReqID finds it and echoed on the response under
+// the same header so clients and upstream services can correlate their logs with ours.
+// chi's package-level RequestIDHeader is left alone, so an embedding program's own use of
+// it is not affected.
+func RequestID(header string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(header)
+			if id == "" {
+				id = fmt.Sprintf("%s-%06d", requestIDPrefix, middleware.NextRequestID())
+			}
+			w.Header().Set(header, id)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), middleware.RequestIDKey, id)))
+		})
+	}
+}
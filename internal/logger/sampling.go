@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SamplingRules select which requests get an access log line.
+type SamplingRules struct {
+	// Rates maps a status code ("404") or class ("2xx") to the fraction of matching
+	// requests logged. Codes take precedence over classes; unmatched statuses are always logged.
+	Rates map[string]float64 `json:"rates"`
+	// Exclude lists path prefixes never logged, e.g. "/healthz".
+	Exclude []string `json:"exclude"`
+}
+
+// Sampling applies SamplingRules that can be replaced at runtime through the admin API.
+type Sampling struct {
+	mu    sync.RWMutex
+	rules SamplingRules
+}
+
+// NewSampling returns a Sampling applying rules, which must be valid.
+func NewSampling(rules SamplingRules) (*Sampling, error) {
+	s := &Sampling{}
+	if err := s.Set(rules); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Set validates and replaces the rules.
+func (s *Sampling) Set(rules SamplingRules) error {
+	rates := make(map[string]float64, len(rules.Rates))
+	for k, rate := range rules.Rates {
+		k = strings.ToLower(k)
+		if !isStatusKey(k) {
+			return fmt.Errorf("invalid status %q: want a code such as 404 or a class such as 2xx", k)
+		}
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("invalid rate %v for %s: want 0 to 1", rate, k)
+		}
+		rates[k] = rate
+	}
+	rules.Rates = rates
+	s.mu.Lock()
+	s.rules = rules
+	s.mu.Unlock()
+	return nil
+}
+
+// Rules returns the current rules.
+func (s *Sampling) Rules() SamplingRules {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rules
+}
+
+// Keep reports whether a request for path answered with status should be logged.
+func (s *Sampling) Keep(path string, status int) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, prefix := range s.rules.Exclude {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	code := strconv.Itoa(status)
+	rate, ok := s.rules.Rates[code]
+	if !ok {
+		rate, ok = s.rules.Rates[code[:1]+"xx"]
+	}
+	return !ok || rate >= 1 || rand.Float64() < rate
+}
+
+func isStatusKey(k string) bool {
+	if len(k) != 3 || k[0] < '1' || k[0] > '5' {
+		return false
+	}
+	if k[1:] == "xx" {
+		return true
+	}
+	_, err := strconv.Atoi(k)
+	return err == nil
+}
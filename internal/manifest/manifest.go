@@ -0,0 +1,54 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+const (
+	// ActionWarn serves invalid manifests with a warning header and a log line.
+	ActionWarn = "warn"
+	// ActionReject answers invalid manifests with 502 Bad Gateway.
+	ActionReject = "reject"
+)
+
+// Validator checks served manifests against a JSON schema.
+type Validator struct {
+	schema *jsonschema.Schema
+	match  string
+	Action string
+}
+
+// NewValidator compiles the JSON schema at schemaFile. match is a path.Match pattern applied to
+// the object's base name (e.g. "*-manifest.json"); action is ActionWarn or ActionReject.
+func NewValidator(schemaFile, match, action string) (*Validator, error) {
+	if _, err := path.Match(match, ""); err != nil {
+		return nil, fmt.Errorf("invalid manifest match pattern %q: %w", match, err)
+	}
+	if action != ActionWarn && action != ActionReject {
+		return nil, fmt.Errorf("invalid manifest validation action %q", action)
+	}
+	schema, err := jsonschema.NewCompiler().Compile(schemaFile)
+	if err != nil {
+		return nil, fmt.Errorf("compile manifest schema: %w", err)
+	}
+	return &Validator{schema: schema, match: match, Action: action}, nil
+}
+
+// Matches reports whether the object key should be validated.
+func (v *Validator) Matches(key string) bool {
+	ok, _ := path.Match(v.match, path.Base(key))
+	return ok
+}
+
+// Validate returns an error describing why body is not a valid manifest.
+func (v *Validator) Validate(body []byte) error {
+	inst, err := jsonschema.UnmarshalJSON(bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("malformed JSON: %w", err)
+	}
+	return v.schema.Validate(inst)
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+)
+
+// Values of the app label for requests that do not name a tracked app.
+const (
+	NoApp    = "none"
+	OtherApp = "other"
+)
+
+// AppLabels derives the app label of request metrics from the path segment following one
+// of its prefixes, e.g. "chrome" for /apps/chrome/js/app.js. To bound cardinality, only
+// the first limit apps served successfully get their own value; other apps are "other"
+// and paths outside the prefixes are "none".
+type AppLabels struct {
+	prefixes []string
+	limit    int
+
+	mu   sync.RWMutex
+	apps map[string]struct{}
+}
+
+// NewAppLabels tracks up to limit apps under prefixes such as "/apps".
+func NewAppLabels(prefixes []string, limit int) *AppLabels {
+	a := &AppLabels{limit: limit, apps: map[string]struct{}{}}
+	for _, p := range prefixes {
+		a.prefixes = append(a.prefixes, strings.TrimSuffix(p, "/")+"/")
+	}
+	return a
+}
+
+// Label returns the app label of a request for reqPath answered with status. Failed
+// requests never add an app, so scans of made-up paths cannot use up the limit.
+func (a *AppLabels) Label(reqPath string, status int) string {
+	app := a.app(reqPath)
+	if app == "" {
+		return NoApp
+	}
+	a.mu.RLock()
+	_, ok := a.apps[app]
+	a.mu.RUnlock()
+	if ok {
+		return app
+	}
+	if status >= 400 {
+		return OtherApp
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.apps[app]; !ok && len(a.apps) >= a.limit {
+		return OtherApp
+	}
+	a.apps[app] = struct{}{}
+	return app
+}
+
+func (a *AppLabels) app(reqPath string) string {
+	for _, prefix := range a.prefixes {
+		if rest, ok := strings.CutPrefix(reqPath, prefix); ok {
+			app, _, _ := strings.Cut(rest, "/")
+			return app
+		}
+	}
+	return ""
+}
@@ -0,0 +1,206 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "frontend_asset_proxy"
+
+// RequestsTotal counts proxied asset requests by route prefix, release variant, app (see
+// AppLabels) and status code.
+var RequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "requests_total",
+	Help:      "Proxied asset requests by route, variant, app and HTTP status code.",
+}, []string{"route", "variant", "app", "code"})
+
+// RequestDuration observes proxied asset request latency by route prefix, release variant
+// and app.
+var RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "request_duration_seconds",
+	Help:      "Proxied asset request latency by route, variant and app.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"route", "variant", "app"})
+
+// CacheRequestsTotal counts object cache lookups by result ("hit" or "miss").
+var CacheRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "cache_requests_total",
+	Help:      "Object cache lookups by result.",
+}, []string{"result"})
+
+// AbortedTransfersTotal counts responses not fully streamed, by reason: "client_disconnect"
+// while streaming, "client_cancel" while waiting for object storage, "checksum" when the
+// object failed checksum validation, or "upstream".
+var AbortedTransfersTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "aborted_transfers_total",
+	Help:      "Responses not fully streamed, by reason.",
+}, []string{"reason"})
+
+// ChecksumMismatchesTotal counts object bodies that did not match their stored checksum.
+var ChecksumMismatchesTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "checksum_mismatches_total",
+	Help:      "Object bodies that failed checksum validation.",
+})
+
+// InFlightRequests is the number of asset requests being served.
+var InFlightRequests = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "in_flight_requests",
+	Help:      "Asset requests currently being served.",
+})
+
+// StreamingResponses is the number of response bodies being streamed to clients.
+var StreamingResponses = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "streaming_responses",
+	Help:      "Response bodies currently being streamed to clients.",
+})
+
+// QueuedRequests is the number of requests waiting for a concurrency slot.
+var QueuedRequests = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "queued_requests",
+	Help:      "Requests waiting for a concurrency slot.",
+})
+
+// UpstreamConnections is the number of open connections to object storage.
+var UpstreamConnections = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "upstream_connections",
+	Help:      "Open connections to object storage.",
+})
+
+// S3RetriesTotal counts object storage request retries by the error code that triggered
+// them, or "transport" for errors without one.
+var S3RetriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "s3_retries_total",
+	Help:      "Object storage request retries, by triggering error code.",
+}, []string{"code"})
+
+// S3RetryQuotaExceededTotal counts retryable errors that were not retried because the
+// client's retry token bucket was empty.
+var S3RetryQuotaExceededTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "s3_retry_quota_exceeded_total",
+	Help:      "Retryable object storage errors not retried because the retry quota was exhausted.",
+})
+
+// HedgedRequestsTotal counts GetObject calls that sent a hedge request, by which attempt
+// responded first ("primary", "hedge", or "none" when both failed).
+var HedgedRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "hedged_requests_total",
+	Help:      "GetObject calls that sent a hedge request, by winning attempt.",
+}, []string{"winner"})
+
+// PresignedRedirectsTotal counts requests redirected to a presigned object storage URL.
+var PresignedRedirectsTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "presigned_redirects_total",
+	Help:      "Requests redirected to a presigned object storage URL.",
+})
+
+// CDNPurgesTotal counts purges forwarded to a CDN, by CDN and outcome ("ok", "error").
+var CDNPurgesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "cdn_purges_total",
+	Help:      "Purges forwarded to a CDN, by CDN and outcome.",
+}, []string{"cdn", "outcome"})
+
+// FilterErrorsTotal counts request filter calls that failed or timed out, by module and
+// function; the request continues unfiltered.
+var FilterErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "filter_errors_total",
+	Help:      "Request filter calls that failed or timed out, by module and function.",
+}, []string{"module", "function"})
+
+// FaultsInjectedTotal counts faults injected for chaos experiments, by fault ("latency",
+// "error", "truncate").
+var FaultsInjectedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "faults_injected_total",
+	Help:      "Faults injected for chaos experiments, by fault.",
+}, []string{"fault"})
+
+// EventPublishErrorsTotal counts access events that could not be published to Kafka.
+var EventPublishErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "event_publish_errors_total",
+	Help:      "Access events that failed to publish to Kafka.",
+})
+
+// RateLimitedTotal counts requests rejected with 429 by the limiting key type, e.g. "ip".
+var RateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "rate_limited_total",
+	Help:      "Requests rejected by the rate limiter, by limiting key type.",
+}, []string{"by"})
+
+// ShedTotal counts requests rejected with 503 to shed load, by reason ("concurrency", "memory").
+var ShedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "shed_total",
+	Help:      "Requests shed with 503 under load, by reason.",
+}, []string{"reason"})
+
+// MirrorDroppedTotal counts sampled requests not compared against the mirror bucket
+// because MIRROR_MAX_IN_FLIGHT comparisons were already running.
+var MirrorDroppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "mirror_dropped_total",
+	Help:      "Sampled requests dropped because too many mirror comparisons were in flight.",
+})
+
+// MemoryInUse reports the memory held by the Go runtime, as sampled for memory-pressure shedding.
+var MemoryInUse = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "memory_in_use_bytes",
+	Help:      "Memory held by the Go runtime, as sampled for load shedding.",
+})
+
+// MemoryPressure is 1 while memory use is above the shedding threshold.
+var MemoryPressure = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "memory_pressure",
+	Help:      "1 while memory use is above the load shedding threshold, otherwise 0.",
+})
+
+// Handler serves the Prometheus exposition format for the default registry, or
+// OpenMetrics with exemplars to scrapers that ask for it.
+func Handler() http.Handler {
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+}
+
+// ObserveWithTrace observes v, attaching traceID as an exemplar when set, so a dashboard
+// can jump from a latency bucket to a representative trace.
+func ObserveWithTrace(o prometheus.Observer, v float64, traceID string) {
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && traceID != "" {
+		eo.ObserveWithExemplar(v, prometheus.Labels{"trace_id": traceID})
+		return
+	}
+	o.Observe(v)
+}
+
+// NewServer returns a server for addr that serves only /metrics (and /debug/vars when
+// expvars is set), so scrapes stay off the asset routes and the port can be firewalled
+// on its own.
+func NewServer(addr string, expvars bool) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	if expvars {
+		mux.Handle("/debug/vars", ExpvarHandler())
+	}
+	return &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+}
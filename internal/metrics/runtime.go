@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"expvar"
+	"net"
+	"net/http"
+	"runtime"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+func init() {
+	// Replace the default Go collector with one that also exports the runtime/metrics
+	// GC pause, heap and scheduler latency histograms.
+	prometheus.Unregister(collectors.NewGoCollector())
+	prometheus.MustRegister(collectors.NewGoCollector(collectors.WithGoCollectorRuntimeMetrics(
+		collectors.MetricsGC, collectors.MetricsMemory, collectors.MetricsScheduler,
+	)))
+}
+
+// OpenConnections tracks client connections to the proxy by state (new, active, idle).
+var OpenConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "open_connections",
+	Help:      "Open client connections by state.",
+}, []string{"state"})
+
+var connStates sync.Map
+
+// ConnState updates OpenConnections; set it as an http.Server's ConnState hook.
+func ConnState(c net.Conn, state http.ConnState) {
+	if prev, ok := connStates.Load(c); ok {
+		OpenConnections.WithLabelValues(prev.(http.ConnState).String()).Dec()
+	}
+	if state == http.StateClosed || state == http.StateHijacked {
+		connStates.Delete(c)
+		return
+	}
+	connStates.Store(c, state)
+	OpenConnections.WithLabelValues(state.String()).Inc()
+}
+
+var publishExpvars sync.Once
+
+// ExpvarHandler serves expvar's JSON (memstats, cmdline and the goroutine count) for
+// tools that read /debug/vars rather than scraping Prometheus.
+func ExpvarHandler() http.Handler {
+	publishExpvars.Do(func() {
+		expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+	})
+	return expvar.Handler()
+}
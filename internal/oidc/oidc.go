@@ -0,0 +1,262 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/jwtauth"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/signedcookie"
+)
+
+// loginTimeout bounds how long a user has to complete the login at the provider.
+const loginTimeout = 10 * time.Minute
+
+// Config configures the authorization code flow against an OpenID provider such as
+// Red Hat SSO (Keycloak).
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the absolute URL of the callback, registered with the provider.
+	RedirectURL string
+	Scopes      []string
+	// CookieSecret signs the session cookie; replicas must share it.
+	CookieSecret string
+	CookieName   string
+	SessionTTL   time.Duration
+}
+
+// Provider gates asset requests behind a login with an OpenID provider: browsers are
+// sent through the authorization code flow (with PKCE) and get a signed session cookie
+// that lets subsequent requests through.
+type Provider struct {
+	cfg           Config
+	authEndpoint  string
+	tokenEndpoint string
+	validator     *jwtauth.Validator
+	client        *http.Client
+
+	// sessions and logins seal the two cookies with separate keys, so a login cookie
+	// handed to any visitor does not open as a session
+	sessions   signedcookie.Signer
+	logins     signedcookie.Signer
+	cookieName string
+	secure     bool
+	// CallbackPath is the path of RedirectURL, to be routed to Callback.
+	CallbackPath string
+}
+
+// New discovers the provider's endpoints from IssuerURL.
+func New(ctx context.Context, cfg Config) (*Provider, error) {
+	if len(cfg.CookieSecret) < 32 {
+		return nil, errors.New("cookie secret must be at least 32 bytes")
+	}
+	redirect, err := url.Parse(cfg.RedirectURL)
+	if err != nil || !redirect.IsAbs() {
+		return nil, fmt.Errorf("redirect URL %q must be absolute", cfg.RedirectURL)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	issuer := strings.TrimSuffix(cfg.IssuerURL, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery: %s", resp.Status)
+	}
+	var doc struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("discovery: incomplete provider metadata")
+	}
+	// OIDC Discovery requires the issuer to be the URL the metadata was fetched for, so a
+	// document served by anything in between cannot nominate another issuer and its keys
+	if doc.Issuer != cfg.IssuerURL && doc.Issuer != issuer {
+		return nil, fmt.Errorf("discovery: issuer %q does not match %q", doc.Issuer, cfg.IssuerURL)
+	}
+	if cfg.CookieName == "" {
+		cfg.CookieName = "asset_session"
+	}
+	signer := signedcookie.NewSigner([]byte(cfg.CookieSecret))
+	return &Provider{
+		cfg:           cfg,
+		authEndpoint:  doc.AuthorizationEndpoint,
+		tokenEndpoint: doc.TokenEndpoint,
+		validator:     jwtauth.NewValidator(jwtauth.NewKeySet(doc.JWKSURI, time.Hour), doc.Issuer, cfg.ClientID),
+		client:        client,
+		sessions:      signer.For("session"),
+		logins:        signer.For("login"),
+		cookieName:    cfg.CookieName,
+		secure:        redirect.Scheme == "https",
+		CallbackPath:  redirect.Path,
+	}, nil
+}
+
+// Protect requires a session for requests under prefixes, as matched by under. Browser
+// navigations without one are redirected to the provider's login; other requests get 401.
+func (p *Provider) Protect(prefixes []string, under jwtauth.PrefixMatcher) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(prefixes) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !under.Any(r, prefixes) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if s, ok := p.session(r); ok {
+				logger.AddFields(r, logger.Fields{"sub": s.Subject})
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.Method != http.MethodGet || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			p.startLogin(w, r)
+		})
+	}
+}
+
+// startLogin redirects to the provider's authorization endpoint, remembering the
+// requested path in a signed login cookie.
+func (p *Provider) startLogin(w http.ResponseWriter, r *http.Request) {
+	l := login{
+		State:    randomString(),
+		Nonce:    randomString(),
+		Verifier: randomString(),
+		Return:   r.URL.RequestURI(),
+		Expires:  time.Now().Add(loginTimeout).Unix(),
+	}
+	if err := p.setCookie(w, p.logins, p.cookieName+"_login", l, time.Unix(l.Expires, 0)); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	challenge := sha256.Sum256([]byte(l.Verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {l.State},
+		"nonce":                 {l.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.authEndpoint, "?") {
+		sep = "&"
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, p.authEndpoint+sep+q.Encode(), http.StatusFound)
+}
+
+// Callback completes the login: it exchanges the authorization code for an ID token,
+// validates it and sets the session cookie before returning to the requested path.
+func (p *Provider) Callback(w http.ResponseWriter, r *http.Request) {
+	c, err := r.Cookie(p.cookieName + "_login")
+	var l login
+	if err != nil || p.logins.Open(c.Value, &l) != nil || time.Now().Unix() >= l.Expires {
+		http.Error(w, "login expired, reload the page", http.StatusBadRequest)
+		return
+	}
+	p.clearCookie(w, p.cookieName+"_login")
+	q := r.URL.Query()
+	if q.Get("state") != l.State {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if e := q.Get("error"); e != "" {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	idToken, err := p.exchange(r.Context(), q.Get("code"), l.Verifier)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	claims, err := p.validator.Validate(r.Context(), idToken)
+	if err != nil || claims["nonce"] != l.Nonce {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	sub, _ := claims.GetSubject()
+	if sub == "" {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	expires := time.Now().Add(p.cfg.SessionTTL)
+	if err := p.setCookie(w, p.sessions, p.cookieName, session{Subject: sub, Expires: expires.Unix()}, expires); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	// Only ever return to a local path
+	ret := l.Return
+	if !strings.HasPrefix(ret, "/") || strings.HasPrefix(ret, "//") || strings.HasPrefix(ret, "/\\") {
+		ret = "/"
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, ret, http.StatusFound)
+}
+
+// exchange trades an authorization code for the ID token at the token endpoint.
+func (p *Provider) exchange(ctx context.Context, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint: %s", resp.Status)
+	}
+	var tok struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(nil, resp.Body, 1<<20)).Decode(&tok); err != nil {
+		return "", err
+	}
+	if tok.IDToken == "" {
+		return "", errors.New("token endpoint returned no id_token")
+	}
+	return tok.IDToken, nil
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,58 @@
+package oidc
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/signedcookie"
+)
+
+// session is the content of the session cookie set after a successful login.
+type session struct {
+	Subject string `json:"sub"`
+	Expires int64  `json:"exp"`
+}
+
+// login is the content of the short-lived cookie carrying a login attempt to the callback.
+type login struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	// Return is the local path the user asked for.
+	Return  string `json:"return"`
+	Expires int64  `json:"exp"`
+}
+
+func (p *Provider) setCookie(w http.ResponseWriter, signer signedcookie.Signer, name string, v any, expires time.Time) error {
+	value, err := signer.Seal(v)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   p.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func (p *Provider) clearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{Name: name, Value: "", Path: "/", MaxAge: -1, Secure: p.secure, HttpOnly: true})
+}
+
+// session returns the valid session of r, if any.
+func (p *Provider) session(r *http.Request) (session, bool) {
+	c, err := r.Cookie(p.cookieName)
+	if err != nil {
+		return session{}, false
+	}
+	var s session
+	if err := p.sessions.Open(c.Value, &s); err != nil || s.Subject == "" || time.Now().Unix() >= s.Expires {
+		return session{}, false
+	}
+	return s, true
+}
@@ -0,0 +1,74 @@
+package policy
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+)
+
+// ResponseHeaders returns a function applying rules to response headers before they are
+// written, or nil when there are no rules.
+func ResponseHeaders(rules []config.ResponseHeaderRule) (func(h http.Header), error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	for _, rule := range rules {
+		for _, name := range rule.Remove {
+			if strings.Contains(strings.TrimSuffix(name, "*"), "*") {
+				return nil, fmt.Errorf("responseHeaders: %q: only a trailing * is supported", name)
+			}
+		}
+		for name := range rule.Set {
+			if name == "" || strings.ContainsAny(name, " :\r\n") {
+				return nil, fmt.Errorf("responseHeaders: invalid header name %q", name)
+			}
+		}
+	}
+	return func(h http.Header) {
+		for _, rule := range rules {
+			if !matchesContentType(h.Get("Content-Type"), rule.ContentTypes) {
+				continue
+			}
+			for _, name := range rule.Remove {
+				removeHeader(h, name)
+			}
+			for name, value := range rule.Set {
+				h.Set(name, value)
+			}
+		}
+	}, nil
+}
+
+func matchesContentType(contentType string, types []string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		t = strings.ToLower(t)
+		if t == mediaType || strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeHeader deletes name, or every header starting with it when it ends in "*".
+func removeHeader(h http.Header, name string) {
+	prefix, ok := strings.CutSuffix(name, "*")
+	if !ok {
+		h.Del(name)
+		return
+	}
+	for key := range h {
+		if len(key) >= len(prefix) && strings.EqualFold(key[:len(prefix)], prefix) {
+			delete(h, key)
+		}
+	}
+}
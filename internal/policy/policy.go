@@ -0,0 +1,201 @@
+package policy
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"path"
+	"strings"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/clientip"
+)
+
+// SourceMaps only serves *.map files to requests carrying the configured token header or
+// coming from an allowed network; everyone else gets 404 as if the file did not exist.
+// With neither a token nor networks configured, source maps are served normally.
+func SourceMaps(header, token string, allowed []netip.Prefix, clients clientip.Resolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if token == "" && len(allowed) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, ".map") {
+				tokenOK := token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get(header)), []byte(token)) == 1
+				if !tokenOK && !clientip.Contains(allowed, clients.ClientIP(r)) {
+					http.NotFound(w, r)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Networks answers 403 to clients in deny or, when allow is set, outside allow. Client
+// addresses are resolved by clients, so X-Forwarded-For is only honored from trusted proxies.
+func Networks(allow, deny []netip.Prefix, clients clientip.Resolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(allow) == 0 && len(deny) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr := clients.ClientIP(r)
+			if clientip.Contains(deny, addr) || len(allow) > 0 && !clientip.Contains(allow, addr) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Denylist answers 404 for paths with a segment matching any pattern, before contacting S3.
+// A pattern ending in "/" matches a directory segment (".git/"); other patterns are
+// path.Match globs compared against the final segment (".env", "*.bak").
+func Denylist(patterns []string) func(http.Handler) http.Handler {
+	dirs, files := splitDenylist(patterns)
+	return func(next http.Handler) http.Handler {
+		if len(patterns) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if denied(r.URL.Path, dirs, files) {
+				http.NotFound(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Denied reports whether Denylist(patterns) answers 404 for p.
+func Denied(patterns []string, p string) bool {
+	dirs, files := splitDenylist(patterns)
+	return denied(p, dirs, files)
+}
+
+func splitDenylist(patterns []string) (dirs, files []string) {
+	for _, p := range patterns {
+		if strings.HasSuffix(p, "/") {
+			dirs = append(dirs, strings.TrimSuffix(p, "/"))
+		} else {
+			files = append(files, p)
+		}
+	}
+	return dirs, files
+}
+
+func denied(p string, dirs, files []string) bool {
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	for i, seg := range segments {
+		isLast := i == len(segments)-1
+		patterns := dirs
+		if isLast {
+			patterns = files
+		}
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, seg); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TrailingSlash redirects (301) extensionless paths to their canonical form before keys
+// are resolved, so caches and analytics see one URL per directory: mode "add" appends a
+// trailing slash, "remove" strips it. Paths with a file extension and the root are left
+// alone, as are methods other than GET and HEAD. It fails on other modes.
+func TrailingSlash(mode string) (func(http.Handler) http.Handler, error) {
+	switch mode {
+	case "", "add", "remove":
+	default:
+		return nil, fmt.Errorf("unsupported trailing slash mode %q", mode)
+	}
+	return func(next http.Handler) http.Handler {
+		if mode == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := TrailingSlashTarget(mode, r.Method, r.URL.Path)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.URL.RawQuery != "" {
+				p += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, p, http.StatusMovedPermanently)
+		})
+	}, nil
+}
+
+// TrailingSlashTarget returns the canonical form of p that TrailingSlash(mode) redirects
+// a method request for p to, if any.
+func TrailingSlashTarget(mode, method, p string) (string, bool) {
+	if p == "/" || path.Ext(p) != "" || method != http.MethodGet && method != http.MethodHead {
+		return "", false
+	}
+	hasSlash := strings.HasSuffix(p, "/")
+	switch {
+	case mode == "add" && !hasSlash:
+		return p + "/", true
+	case mode == "remove" && hasSlash:
+		return strings.TrimRight(p, "/"), true
+	}
+	return "", false
+}
+
+// CleanPath collapses duplicate slashes and resolves "." and ".." segments before routing,
+// so the S3 key is always built from the canonical path. Paths whose ".." segments would
+// climb above the root (including encoded forms such as "..%2f") are rejected with 400.
+// It must run before routing: the raw (still encoded) path is dropped so chi routes the
+// cleaned one.
+func CleanPath(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cleaned, ok := Clean(r.URL.Path)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		if cleaned != r.URL.Path || r.URL.RawPath != "" {
+			r.URL.Path, r.URL.RawPath = cleaned, ""
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Clean resolves p to a rooted path without empty, "." or ".." segments, keeping a
+// trailing slash. It reports false when a ".." segment would escape the root.
+func Clean(p string) (string, bool) {
+	var out []string
+	for _, seg := range strings.Split(p, "/") {
+		switch seg {
+		case "", ".":
+		case "..":
+			if len(out) == 0 {
+				return "", false
+			}
+			out = out[:len(out)-1]
+		default:
+			out = append(out, seg)
+		}
+	}
+	cleaned := "/" + strings.Join(out, "/")
+	if len(out) > 0 && (strings.HasSuffix(p, "/") || strings.HasSuffix(p, "/.") || strings.HasSuffix(p, "/..")) {
+		cleaned += "/"
+	}
+	return cleaned, true
+}
+
+// UnderPrefix reports whether reqPath is one of prefixes or below one.
+func UnderPrefix(reqPath string, prefixes []string) bool {
+	for _, p := range prefixes {
+		p = strings.TrimSuffix(p, "/")
+		if reqPath == p || strings.HasPrefix(reqPath, p+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package policy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+)
+
+type redirect struct {
+	rule    config.RedirectRule
+	pattern *regexp.Regexp
+}
+
+// Redirects answers requests matching a rule with a redirect to its target. Exact rules
+// are checked before patterns, and patterns in the order they are configured. It fails
+// on invalid patterns and on statuses other than 301, 302, 307 and 308.
+func Redirects(rules []config.RedirectRule) (func(http.Handler) http.Handler, error) {
+	exact, patterns, err := compileRedirects(rules)
+	if err != nil {
+		return nil, err
+	}
+	return func(next http.Handler) http.Handler {
+		if len(rules) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			target, status, ok := redirectTarget(r.URL.Path, exact, patterns)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.URL.RawQuery != "" && !strings.Contains(target, "?") {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, status)
+		})
+	}, nil
+}
+
+// RedirectTarget returns the target and status of the rule redirecting requests for p.
+func RedirectTarget(rules []config.RedirectRule, p string) (string, int, bool, error) {
+	exact, patterns, err := compileRedirects(rules)
+	if err != nil {
+		return "", 0, false, err
+	}
+	target, status, ok := redirectTarget(p, exact, patterns)
+	return target, status, ok, nil
+}
+
+func compileRedirects(rules []config.RedirectRule) (map[string]config.RedirectRule, []redirect, error) {
+	exact := map[string]config.RedirectRule{}
+	var patterns []redirect
+	for _, rule := range rules {
+		switch rule.Status {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return nil, nil, fmt.Errorf("redirect %q: unsupported status %d", rule.From, rule.Status)
+		}
+		if !rule.Pattern {
+			exact[rule.From] = rule
+			continue
+		}
+		re, err := regexp.Compile("^(?:" + rule.From + ")$")
+		if err != nil {
+			return nil, nil, fmt.Errorf("redirect %q: %w", rule.From, err)
+		}
+		patterns = append(patterns, redirect{rule: rule, pattern: re})
+	}
+	return exact, patterns, nil
+}
+
+func redirectTarget(p string, exact map[string]config.RedirectRule, patterns []redirect) (string, int, bool) {
+	if rule, ok := exact[p]; ok {
+		return rule.To, rule.Status, true
+	}
+	for _, rd := range patterns {
+		if m := rd.pattern.FindStringSubmatchIndex(p); m != nil {
+			return string(rd.pattern.ExpandString(nil, rd.rule.To, p, m)), rd.rule.Status, true
+		}
+	}
+	return "", 0, false
+}
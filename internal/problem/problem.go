@@ -0,0 +1,85 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/policy"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// ContentType is the media type of problem details.
+const ContentType = "application/problem+json"
+
+// Details is an RFC 7807 problem details object.
+type Details struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// RequestID lets callers quote the failed request in support cases.
+	RequestID string `json:"requestId,omitempty"`
+	// UpstreamCode is the object storage error code, e.g. "NoSuchKey", for debug requests.
+	UpstreamCode string `json:"upstreamCode,omitempty"`
+}
+
+type enabledKey struct{}
+
+// Prefixes answers errors of requests under prefixes with problem details instead of
+// plain text, for API-style routes whose callers parse error bodies.
+func Prefixes(prefixes []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(prefixes) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if policy.UnderPrefix(r.URL.Path, prefixes) {
+				r = r.WithContext(context.WithValue(r.Context(), enabledKey{}, true))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Enabled reports whether errors of r are answered with problem details.
+func Enabled(r *http.Request) bool {
+	enabled, _ := r.Context().Value(enabledKey{}).(bool)
+	return enabled
+}
+
+// New returns the problem details of answering r with status.
+func New(r *http.Request, status int, detail string) Details {
+	return Details{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+}
+
+// Write answers with d.
+func Write(w http.ResponseWriter, d Details) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", ContentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(d.Status)
+	_ = json.NewEncoder(w).Encode(d)
+}
+
+// Error answers r with status like http.Error, with detail or else the status text as
+// the body, or with problem details when they are enabled for r.
+func Error(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	if Enabled(r) {
+		Write(w, New(r, status, detail))
+		return
+	}
+	if detail == "" {
+		detail = http.StatusText(status)
+	}
+	http.Error(w, detail, status)
+}
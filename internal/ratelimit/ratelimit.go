@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/metrics"
+	"golang.org/x/time/rate"
+)
+
+// idleTTL is how long a key's bucket is kept after its last request. A bucket left idle
+// this long has refilled completely, so dropping it does not change the outcome.
+const idleTTL = 10 * time.Minute
+
+// Limiter applies an independent token bucket per key (e.g. client IP).
+type Limiter struct {
+	rate  rate.Limit
+	burst int
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// New returns a Limiter allowing rps requests per second per key with bursts of burst.
+func New(rps float64, burst int) *Limiter {
+	return &Limiter{rate: rate.Limit(rps), burst: burst, buckets: map[string]*bucket{}, swept: time.Now()}
+}
+
+// Reserve takes a token for key. It returns 0 when the request may proceed, otherwise
+// how long the caller should wait before retrying.
+func (l *Limiter) Reserve(key string) time.Duration {
+	now := time.Now()
+	l.mu.Lock()
+	if now.Sub(l.swept) > idleTTL {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > idleTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(l.rate, l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	l.mu.Unlock()
+
+	res := b.limiter.ReserveN(now, 1)
+	if !res.OK() {
+		return time.Second
+	}
+	delay := res.DelayFrom(now)
+	if delay > 0 {
+		// Rejected requests must not consume tokens, or a retrying client never recovers.
+		res.CancelAt(now)
+	}
+	return delay
+}
+
+// Middleware rejects requests over the limit with 429 and a Retry-After header. key extracts
+// the limiting key from a request and the key type ("ip", "org") used to label the
+// throttled-requests counter; requests with an empty key are not limited. Paths in exempt
+// (health checks) are never limited.
+func (l *Limiter) Middleware(key func(r *http.Request) (k, by string), exempt []string) func(http.Handler) http.Handler {
+	skip := make(map[string]bool, len(exempt))
+	for _, p := range exempt {
+		skip[p] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if skip[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			k, by := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			// Keys of different types share the bucket map, so namespace them.
+			if delay := l.Reserve(by + ":" + k); delay > 0 {
+				metrics.RateLimitedTotal.WithLabelValues(by).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
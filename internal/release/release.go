@@ -0,0 +1,260 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+)
+
+var (
+	// ErrUnknownApp and ErrUnknownRelease are returned by Switch for names not configured.
+	ErrUnknownApp     = errors.New("unknown app")
+	ErrUnknownRelease = errors.New("unknown release")
+)
+
+// Status describes an app's configured releases and which one is live.
+type Status struct {
+	Live     string            `json:"live"`
+	Previous string            `json:"previous,omitempty"`
+	Releases map[string]string `json:"releases"`
+}
+
+// Pointer is the persisted part of a Status: which release is live and which was.
+type Pointer struct {
+	Live     string `json:"live"`
+	Previous string `json:"previous,omitempty"`
+}
+
+// Store persists the live releases, so every replica serves the same release and a
+// switch survives restarts.
+type Store interface {
+	// Load returns the stored pointers by app, and a version identifying them for Save;
+	// apps without one keep their configured live release.
+	Load(ctx context.Context) (pointers map[string]Pointer, version string, err error)
+	// Save replaces the stored pointers if they are still at version (empty when none
+	// were stored), and returns ErrConflict otherwise.
+	Save(ctx context.Context, pointers map[string]Pointer, version string) error
+}
+
+// ErrConflict is returned by Store.Save when the pointers changed since they were loaded.
+var ErrConflict = errors.New("release state changed concurrently")
+
+// saveAttempts bounds how often Switch retries a Save that lost a concurrent update.
+const saveAttempts = 5
+
+// Registry tracks the live release of every route rule with named releases.
+// Switching is atomic per app; the previous release stays configured so a
+// rollback is just another switch.
+type Registry struct {
+	mu   sync.RWMutex
+	apps map[string]*Status
+	// switching serializes Switch, so switches on this replica don't race each other.
+	switching sync.Mutex
+	// store, when set, holds the live releases shared by all replicas.
+	store Store
+	// switched is called after an app's live release changed, here or on another replica.
+	switched func(app string, st Status)
+}
+
+// NewRegistry seeds the registry from rules that define a name and releases.
+// The initial live release is the rule's Live, or the first release name in sorted order.
+func NewRegistry(rules []config.RouteRule) *Registry {
+	reg := &Registry{apps: map[string]*Status{}}
+	for _, rule := range rules {
+		if rule.Name == "" || len(rule.Releases) == 0 || reg.apps[rule.Name] != nil {
+			continue
+		}
+		live := rule.Live
+		if _, ok := rule.Releases[live]; !ok {
+			names := make([]string, 0, len(rule.Releases))
+			for name := range rule.Releases {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			live = names[0]
+		}
+		reg.apps[rule.Name] = &Status{Live: live, Releases: rule.Releases}
+	}
+	return reg
+}
+
+// BucketPath returns the bucket path of app's live release.
+func (reg *Registry) BucketPath(app string) (string, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	st, ok := reg.apps[app]
+	if !ok {
+		return "", false
+	}
+	return st.Releases[st.Live], true
+}
+
+// Persist keeps the live releases in store. It must be called before the registry is used.
+func (reg *Registry) Persist(store Store) {
+	reg.store = store
+}
+
+// OnSwitch sets fn to be called after an app's live release changed, by Switch or by a
+// Refresh picking up another replica's switch. It must be called before the registry is used.
+func (reg *Registry) OnSwitch(fn func(app string, st Status)) {
+	reg.switched = fn
+}
+
+// Sync refreshes the live releases from the store every interval until the returned
+// func is called, reporting failures to onErr.
+func (reg *Registry) Sync(interval time.Duration, onErr func(error)) (stop func()) {
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			if err := reg.Refresh(ctx); err != nil {
+				onErr(err)
+			}
+			cancel()
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// Refresh loads the live releases from the store. Pointers naming unknown apps or
+// releases are ignored.
+func (reg *Registry) Refresh(ctx context.Context) error {
+	if reg.store == nil {
+		return nil
+	}
+	pointers, _, err := reg.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	reg.mu.Lock()
+	var changed []string
+	for app, ptr := range pointers {
+		st, ok := reg.apps[app]
+		if !ok || st.Live == ptr.Live {
+			continue
+		}
+		if _, ok := st.Releases[ptr.Live]; !ok {
+			continue
+		}
+		st.Live, st.Previous = ptr.Live, ptr.Previous
+		changed = append(changed, app)
+	}
+	statuses := reg.statuses(changed)
+	reg.mu.Unlock()
+	reg.notify(statuses)
+	return nil
+}
+
+// Switch makes release the live release of app and returns the new status. With a
+// store, the switch is saved there first, so it fails rather than apply to this
+// replica alone; the previous release is taken from the stored state, and a save racing
+// another replica's switch is retried on the fresh state.
+func (reg *Registry) Switch(ctx context.Context, app, release string) (Status, error) {
+	reg.switching.Lock()
+	defer reg.switching.Unlock()
+	reg.mu.RLock()
+	st, ok := reg.apps[app]
+	var current Status
+	if ok {
+		current = *st
+	}
+	reg.mu.RUnlock()
+	if !ok {
+		return Status{}, fmt.Errorf("%w %q", ErrUnknownApp, app)
+	}
+	if _, ok := current.Releases[release]; !ok {
+		return Status{}, fmt.Errorf("%w %q for app %q", ErrUnknownRelease, release, app)
+	}
+	if reg.store == nil && current.Live == release {
+		return current, nil
+	}
+	ptr := Pointer{Live: release, Previous: current.Live}
+	if reg.store != nil {
+		var err error
+		if ptr, err = reg.save(ctx, app, current, release); err != nil {
+			return Status{}, err
+		}
+	}
+	reg.mu.Lock()
+	changed := reg.apps[app].Live != ptr.Live
+	reg.apps[app].Live, reg.apps[app].Previous = ptr.Live, ptr.Previous
+	statuses := reg.statuses([]string{app})
+	reg.mu.Unlock()
+	if changed {
+		reg.notify(statuses)
+	}
+	return statuses[app], nil
+}
+
+// save stores release as app's live release, on top of the stored pointers, and returns
+// the stored pointer. current is the in-memory status, used while nothing is stored for app.
+func (reg *Registry) save(ctx context.Context, app string, current Status, release string) (Pointer, error) {
+	for range saveAttempts {
+		pointers, version, err := reg.store.Load(ctx)
+		if err != nil {
+			return Pointer{}, err
+		}
+		ptr, ok := pointers[app]
+		if _, known := current.Releases[ptr.Live]; !ok || !known {
+			ptr = Pointer{Live: current.Live, Previous: current.Previous}
+		}
+		if ptr.Live == release {
+			return ptr, nil
+		}
+		ptr = Pointer{Live: release, Previous: ptr.Live}
+		if pointers == nil {
+			pointers = map[string]Pointer{}
+		}
+		pointers[app] = ptr
+		err = reg.store.Save(ctx, pointers, version)
+		if !errors.Is(err, ErrConflict) {
+			return ptr, err
+		}
+	}
+	return Pointer{}, ErrConflict
+}
+
+// statuses copies the status of apps; reg.mu must be held.
+func (reg *Registry) statuses(apps []string) map[string]Status {
+	out := make(map[string]Status, len(apps))
+	for _, app := range apps {
+		out[app] = *reg.apps[app]
+	}
+	return out
+}
+
+func (reg *Registry) notify(statuses map[string]Status) {
+	if reg.switched == nil {
+		return
+	}
+	for app, st := range statuses {
+		reg.switched(app, st)
+	}
+}
+
+// Snapshot returns the status of every app.
+func (reg *Registry) Snapshot() map[string]Status {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	out := make(map[string]Status, len(reg.apps))
+	for name, st := range reg.apps {
+		out[name] = *st
+	}
+	return out
+}
@@ -0,0 +1,75 @@
+package rewrite
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"path"
+	"reflect"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// Env is what key expressions can refer to.
+type Env struct {
+	// Path is the request path relative to the rule, honoring stripPrefix.
+	Path string `expr:"path"`
+	// RequestPath is the full request path.
+	RequestPath string `expr:"requestPath"`
+	// Prefix is the rule's prefix.
+	Prefix string `expr:"prefix"`
+	// App is the first path segment after the rule's prefix.
+	App    string `expr:"app"`
+	Host   string `expr:"host"`
+	Method string `expr:"method"`
+	// Query holds the first value of each query parameter.
+	Query map[string]string `expr:"query"`
+	// Header returns the first value of a request header. Callers serving the result
+	// must add the headers it was called with to Vary.
+	Header func(name string) string `expr:"header"`
+}
+
+// Key computes object keys with an expr-lang expression, e.g.
+// `"data/" + app + "/" + hash(path)`.
+type Key struct {
+	program *vm.Program
+}
+
+// Compile compiles src, which must evaluate to a string.
+func Compile(src string) (*Key, error) {
+	program, err := expr.Compile(src,
+		expr.Env(Env{}),
+		expr.AsKind(reflect.String),
+		expr.Function("hash", func(params ...any) (any, error) {
+			sum := sha256.Sum256([]byte(params[0].(string)))
+			return hex.EncodeToString(sum[:]), nil
+		}, new(func(string) string)),
+		expr.Function("base", func(params ...any) (any, error) {
+			return path.Base(params[0].(string)), nil
+		}, new(func(string) string)),
+		expr.Function("dir", func(params ...any) (any, error) {
+			return path.Dir(params[0].(string)), nil
+		}, new(func(string) string)),
+		expr.Function("ext", func(params ...any) (any, error) {
+			return path.Ext(params[0].(string)), nil
+		}, new(func(string) string)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{program: program}, nil
+}
+
+// Eval returns the key for env.
+func (k *Key) Eval(env Env) (string, error) {
+	out, err := expr.Run(k.program, env)
+	if err != nil {
+		return "", err
+	}
+	key, ok := out.(string)
+	if !ok {
+		return "", errors.New("expression did not return a string")
+	}
+	return key, nil
+}
@@ -0,0 +1,230 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/metrics"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// warmupConcurrency bounds parallel GetObject calls while warming or prefetching into the cache.
+const warmupConcurrency = 8
+
+// cachedObject is a GetObject response held in memory; out has no Body.
+type cachedObject struct {
+	out  s3.GetObjectOutput
+	body []byte
+}
+
+// cacheKey identifies a cached object version.
+func cacheKey(in *s3.GetObjectInput) string {
+	return aws.ToString(in.Bucket) + "/" + aws.ToString(in.Key) + "?versionId=" + aws.ToString(in.VersionId)
+}
+
+// cacheable reports whether the response to in may be served from or stored in the
+// object cache: only unconditional, full-object GET and HEAD requests are cached.
+func (p *Proxy) cacheable(r *http.Request, in *s3.GetObjectInput) bool {
+	return p.cache != nil && (r.Method == http.MethodGet || r.Method == http.MethodHead) &&
+		in.Range == nil && in.IfMatch == nil && in.IfNoneMatch == nil &&
+		in.IfModifiedSince == nil && in.IfUnmodifiedSince == nil
+}
+
+// cachedGet returns a copy of the cached response to in with a fresh body, and when it
+// was stored.
+func (p *Proxy) cachedGet(in *s3.GetObjectInput) (*s3.GetObjectOutput, time.Time, bool) {
+	cached, stored, ok := p.cache.Get(cacheKey(in))
+	if !ok {
+		metrics.CacheRequestsTotal.WithLabelValues("miss").Inc()
+		return nil, time.Time{}, false
+	}
+	metrics.CacheRequestsTotal.WithLabelValues("hit").Inc()
+	out := cached.out
+	out.Body = io.NopCloser(bytes.NewReader(cached.body))
+	return &out, stored, true
+}
+
+// setAge sets Date and, for a response held in a cache since stored, Age, so downstream
+// caches and browsers don't keep it fresh for longer than its Cache-Control allows. A zero
+// stored marks a response fetched for this request.
+func setAge(h http.Header, stored time.Time) {
+	now := time.Now()
+	h.Set("Date", now.UTC().Format(http.TimeFormat))
+	if !stored.IsZero() {
+		h.Set("Age", strconv.FormatInt(int64(max(now.Sub(stored), 0)/time.Second), 10))
+	}
+}
+
+// storeObject buffers obj into the cache when it is small enough, replacing its body
+// with the buffered copy. Objects are not cached while the process is under memory pressure.
+func (p *Proxy) storeObject(in *s3.GetObjectInput, obj *s3.GetObjectOutput) error {
+	size := aws.ToInt64(obj.ContentLength)
+	if obj.ContentLength == nil || size > p.Config.CacheMaxObjectSize || (p.UnderPressure != nil && p.UnderPressure()) {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(obj.Body, size+1))
+	obj.Body.Close()
+	if err == nil && int64(len(body)) != size {
+		err = fmt.Errorf("read %d bytes, expected %d", len(body), size)
+	}
+	if err != nil {
+		return err
+	}
+	cached := &cachedObject{out: *obj, body: body}
+	cached.out.Body = nil
+	p.cache.Add(cacheKey(in), cached, size)
+	obj.Body = io.NopCloser(bytes.NewReader(body))
+	return nil
+}
+
+// Purge drops the cached objects of the request paths, in every version, and everything
+// cached under the apps' paths (see CACHE_TAG_PREFIXES). It returns the number of
+// objects dropped.
+func (p *Proxy) Purge(paths, apps []string) int {
+	if p.cache == nil {
+		return 0
+	}
+	var exact, prefixes []string
+	for _, reqPath := range paths {
+		if key, ok := p.purgeKey(reqPath); ok {
+			exact = append(exact, key+"?versionId=")
+		}
+	}
+	for _, app := range apps {
+		if app == "" || strings.Contains(app, "/") {
+			continue
+		}
+		for _, prefix := range p.Config.CacheTagPrefixes {
+			if key, ok := p.purgeKey(strings.TrimSuffix(prefix, "/") + "/" + app + "/"); ok {
+				prefixes = append(prefixes, key)
+			}
+		}
+	}
+	return p.cache.RemoveFunc(func(key string) bool {
+		for _, e := range exact {
+			if strings.HasPrefix(key, e) {
+				return true
+			}
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// purgeKey resolves a request path to the "bucket/key" its cache keys start with.
+func (p *Proxy) purgeKey(reqPath string) (string, bool) {
+	r, err := http.NewRequest(http.MethodGet, reqPath, nil)
+	if err != nil || p.Resolve == nil {
+		return "", false
+	}
+	full, ok := p.Resolve(r, reqPath)
+	if !ok {
+		return "", false
+	}
+	bucket, key, ok := splitBucketKey(full)
+	return bucket + "/" + key, ok
+}
+
+// WarmupPaths returns the request paths listed in the warmup manifest at the bucket path
+// manifest (a JSON array of paths) followed by the configured warmup paths.
+func (p *Proxy) WarmupPaths(ctx context.Context) ([]string, error) {
+	paths := p.Config.CacheWarmupPaths
+	if p.Config.CacheWarmupManifest == "" {
+		return paths, nil
+	}
+	bucket, key, ok := splitBucketKey(p.Config.CacheWarmupManifest)
+	if !ok {
+		return nil, errInvalidPath
+	}
+	out, err := p.Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	var listed []string
+	if err := json.NewDecoder(out.Body).Decode(&listed); err != nil {
+		return nil, fmt.Errorf("decode warmup manifest: %w", err)
+	}
+	return append(listed, paths...), nil
+}
+
+// Warmup loads the objects for the given request paths into the cache. resolve maps a
+// request path to its full bucket path. Failures are logged and skipped; Warmup returns
+// the number of objects cached.
+func (p *Proxy) Warmup(ctx context.Context, paths []string, resolve func(r *http.Request, reqPath string) (string, bool)) int {
+	return p.fillCache(ctx, "warmup", "", paths, resolve)
+}
+
+// WarmupApp loads the objects of the warmup list under app's paths (see CACHE_TAG_PREFIXES)
+// into the cache and returns the number of objects cached.
+func (p *Proxy) WarmupApp(ctx context.Context, app string) (int, error) {
+	paths, err := p.WarmupPaths(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var appPaths []string
+	for _, reqPath := range paths {
+		if pathApp(reqPath, p.Config.CacheTagPrefixes) == app {
+			appPaths = append(appPaths, reqPath)
+		}
+	}
+	return p.Warmup(ctx, appPaths, p.Resolve), nil
+}
+
+// fillCache fetches the objects for paths, as requested for host, into the cache and
+// returns how many were fetched. process labels log entries.
+func (p *Proxy) fillCache(ctx context.Context, process, host string, paths []string, resolve func(r *http.Request, reqPath string) (string, bool)) int {
+	if p.cache == nil {
+		return 0
+	}
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		warmed int
+	)
+	sem := make(chan struct{}, warmupConcurrency)
+	for _, reqPath := range paths {
+		r, err := http.NewRequestWithContext(ctx, http.MethodGet, reqPath, nil)
+		if err != nil {
+			continue
+		}
+		r.Host = host
+		full, ok := resolve(r, reqPath)
+		bucket, key, valid := splitBucketKey(full)
+		if !ok || !valid {
+			p.Log.WithFields(logger.Fields{"process": process, "path": reqPath}).Warnf("path does not resolve to an object")
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			obj, err := p.getObject(ctx, r, bucket, key, "")
+			if err != nil {
+				p.Log.WithFields(logger.Fields{"process": process, "path": reqPath}).Warnf("cache fill failed: %v", err)
+				return
+			}
+			obj.Body.Close()
+			mu.Lock()
+			warmed++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return warmed
+}
@@ -0,0 +1,31 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/metrics"
+)
+
+// errChecksumMismatch marks object bodies that did not match the checksum stored with
+// the object, e.g. after bit rot or a truncated upload.
+var errChecksumMismatch = errors.New("object failed checksum validation")
+
+// checksumBody fails reads of a body whose checksum the SDK found not to match. The
+// bytes returned with the failure are withheld, so the response comes up short of its
+// Content-Length and the client sees a failed transfer instead of a corrupt object.
+type checksumBody struct {
+	io.ReadCloser
+}
+
+func (b checksumBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	// The SDK's validation error is not exported; it is returned at the end of the body
+	if err != nil && err != io.EOF && strings.Contains(err.Error(), "checksum did not match") {
+		metrics.ChecksumMismatchesTotal.Inc()
+		return 0, fmt.Errorf("%w: %v", errChecksumMismatch, err)
+	}
+	return n, err
+}
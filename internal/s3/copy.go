@@ -0,0 +1,92 @@
+package s3
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// copyBufferSize matches the buffer io.Copy would otherwise allocate per call.
+const copyBufferSize = 32 << 10
+
+// copyBuffers recycles response copy buffers across requests to reduce allocations and GC pressure.
+var copyBuffers = sync.Pool{
+	New: func() any {
+		b := make([]byte, copyBufferSize)
+		return &b
+	},
+}
+
+// copyBody streams src to dst through a pooled buffer.
+func copyBody(dst io.Writer, src io.Reader) (int64, error) {
+	bufp := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(bufp)
+	// Hide io.ReaderFrom on dst (the response writer implements it), which would make
+	// io.CopyBuffer ignore the pooled buffer.
+	return io.CopyBuffer(struct{ io.Writer }{dst}, src, *bufp)
+}
+
+// flushWriter flushes the response at most interval after a write, or after every write
+// when interval is negative, so streamed bodies reach the client without waiting for the
+// server's write buffer to fill.
+type flushWriter struct {
+	w        io.Writer
+	rc       *http.ResponseController
+	interval time.Duration
+
+	mu      sync.Mutex // guards writes against the timer's flush
+	pending bool
+	timer   *time.Timer
+}
+
+// newFlushWriter wraps w with periodic flushing. It returns w itself when interval is zero.
+func newFlushWriter(w http.ResponseWriter, interval time.Duration) (io.Writer, func()) {
+	if interval == 0 {
+		return w, func() {}
+	}
+	fw := &flushWriter{w: w, rc: http.NewResponseController(w), interval: interval}
+	return fw, fw.stop
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	n, err := fw.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if fw.interval < 0 {
+		_ = fw.rc.Flush()
+		return n, nil
+	}
+	if !fw.pending {
+		fw.pending = true
+		if fw.timer == nil {
+			fw.timer = time.AfterFunc(fw.interval, fw.delayedFlush)
+		} else {
+			fw.timer.Reset(fw.interval)
+		}
+	}
+	return n, nil
+}
+
+func (fw *flushWriter) delayedFlush() {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if !fw.pending {
+		return
+	}
+	fw.pending = false
+	_ = fw.rc.Flush()
+}
+
+// stop cancels a pending flush; it must be called before the handler returns.
+func (fw *flushWriter) stop() {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.pending = false
+	if fw.timer != nil {
+		fw.timer.Stop()
+	}
+}
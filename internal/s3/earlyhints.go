@@ -0,0 +1,115 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// preloadManifests caches early hints preload lists loaded from JSON objects in the bucket.
+type preloadManifests struct {
+	mu      sync.Mutex
+	entries map[string]*preloadManifest
+}
+
+type preloadManifest struct {
+	paths   []string
+	expires time.Time
+}
+
+// sendEarlyHints writes a 103 Early Hints response preloading the rule's assets, so the
+// browser starts fetching them while the HTML is still being fetched from S3. The Link
+// headers stay on the final response as well.
+func (p *Proxy) sendEarlyHints(ctx context.Context, w http.ResponseWriter, r *http.Request, rule config.RouteRule) {
+	eh := rule.EarlyHints
+	if eh == nil || r.Method != http.MethodGet || !isNavigation(r) {
+		return
+	}
+	paths := eh.Preload
+	if eh.Manifest != "" {
+		ctx, cancel := context.WithTimeout(ctx, p.Config.ProxiedRequestTimeout)
+		defer cancel()
+		paths = append(p.preloadManifest(ctx, eh.Manifest), paths...)
+	}
+	if len(paths) == 0 {
+		return
+	}
+	for _, asset := range paths {
+		w.Header().Add("Link", preloadLink(asset))
+	}
+	w.WriteHeader(http.StatusEarlyHints)
+}
+
+// preloadLink returns the Link header value preloading asset, with the destination
+// inferred from its extension.
+func preloadLink(asset string) string {
+	link := "<" + asset + ">; rel=preload"
+	switch strings.ToLower(path.Ext(asset)) {
+	case ".js", ".mjs":
+		link += "; as=script"
+	case ".css":
+		link += "; as=style"
+	case ".woff", ".woff2", ".ttf", ".otf":
+		link += "; as=font; crossorigin"
+	case ".json":
+		link += "; as=fetch; crossorigin"
+	case ".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".avif", ".ico":
+		link += "; as=image"
+	}
+	return link
+}
+
+// preloadManifest returns the request paths listed in the manifest at manifestPath.
+// A stale list is kept if a refresh fails.
+func (p *Proxy) preloadManifest(ctx context.Context, manifestPath string) []string {
+	pm := &p.preloadManifests
+	pm.mu.Lock()
+	entry := pm.entries[manifestPath]
+	pm.mu.Unlock()
+	if entry != nil && time.Now().Before(entry.expires) {
+		return entry.paths
+	}
+
+	paths, err := p.loadPreloadManifest(ctx, manifestPath)
+	if err != nil {
+		p.Log.WithFields(logger.Fields{"process": "earlyhints", "path": manifestPath}).Errorf("failed to load preload manifest: %v", err)
+		if entry == nil {
+			return nil
+		}
+		paths = entry.paths
+	}
+
+	pm.mu.Lock()
+	if pm.entries == nil {
+		pm.entries = map[string]*preloadManifest{}
+	}
+	pm.entries[manifestPath] = &preloadManifest{paths: paths, expires: time.Now().Add(p.Config.EarlyHintsTTL)}
+	pm.mu.Unlock()
+	return paths
+}
+
+func (p *Proxy) loadPreloadManifest(ctx context.Context, manifestPath string) ([]string, error) {
+	bucket, key, ok := splitBucketKey(manifestPath)
+	if !ok {
+		return nil, errInvalidPath
+	}
+	obj, err := p.Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Body.Close()
+	var paths []string
+	if err := json.NewDecoder(obj.Body).Decode(&paths); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
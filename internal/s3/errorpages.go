@@ -0,0 +1,136 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/problem"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithy "github.com/aws/smithy-go"
+)
+
+// maxErrorPageSize caps the size of an error document held in memory.
+const maxErrorPageSize = 1 << 20
+
+// errorPages caches the error documents configured in ERROR_PAGES by bucket path.
+type errorPages struct {
+	mu      sync.Mutex
+	entries map[string]*errorPage
+}
+
+// errorPage is a cached error document; a nil body records that it could not be loaded.
+type errorPage struct {
+	body        []byte
+	contentType string
+	expires     time.Time
+}
+
+// Error answers r with status: with problem details under PROBLEM_JSON_PREFIXES, else
+// with the document ERROR_PAGES configures for the status (e.g. "404") or its class
+// ("5xx"), else with the bare status text.
+func (p *Proxy) Error(w http.ResponseWriter, r *http.Request, status int) {
+	p.writeError(w, r, status, nil)
+}
+
+// writeError answers r with status like Error. cause is the object storage error behind
+// status; when nil, the error of the request's last GetObject call is reported.
+func (p *Proxy) writeError(w http.ResponseWriter, r *http.Request, status int, cause error) {
+	if problem.Enabled(r) {
+		d := problem.New(r, status, "")
+		if logger.Debug(r.Context()) {
+			if stats := statsFrom(r.Context()); cause == nil && stats != nil {
+				cause = stats.Err
+			}
+			var apiErr smithy.APIError
+			if errors.As(cause, &apiErr) {
+				d.UpstreamCode = apiErr.ErrorCode()
+			}
+		}
+		problem.Write(w, d)
+		return
+	}
+	page := p.errorPage(r.Context(), status)
+	if page == nil {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", page.contentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(page.body)
+	}
+}
+
+// errorPage returns the error document for status, or nil when none is configured or it
+// cannot be loaded. Documents are reloaded every ERROR_PAGES_TTL; a stale document is
+// kept if a reload fails.
+func (p *Proxy) errorPage(ctx context.Context, status int) *errorPage {
+	pagePath, ok := p.Config.ErrorPages[strconv.Itoa(status)]
+	if !ok {
+		pagePath, ok = p.Config.ErrorPages[strconv.Itoa(status/100)+"xx"]
+	}
+	if !ok {
+		return nil
+	}
+	full := JoinPath(p.Config.BucketPathPrefix, pagePath)
+
+	ep := &p.errorPages
+	ep.mu.Lock()
+	entry := ep.entries[full]
+	ep.mu.Unlock()
+	if entry == nil || time.Now().After(entry.expires) {
+		// The request may have failed on its own deadline, so the load gets a fresh one
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), p.Config.ProxiedRequestTimeout)
+		loaded, err := p.loadErrorPage(ctx, full)
+		cancel()
+		if err != nil {
+			p.Log.WithFields(logger.Fields{"process": "errorpages", "path": full}).Warnf("failed to load error page: %v", err)
+			if entry != nil && entry.body != nil {
+				loaded.body, loaded.contentType = entry.body, entry.contentType
+			}
+		}
+		loaded.expires = time.Now().Add(p.Config.ErrorPagesTTL)
+		ep.mu.Lock()
+		if ep.entries == nil {
+			ep.entries = make(map[string]*errorPage)
+		}
+		ep.entries[full] = loaded
+		ep.mu.Unlock()
+		entry = loaded
+	}
+	if entry.body == nil {
+		return nil
+	}
+	return entry
+}
+
+func (p *Proxy) loadErrorPage(ctx context.Context, full string) (*errorPage, error) {
+	bucket, key, ok := splitBucketKey(full)
+	if !ok {
+		return &errorPage{}, errInvalidPath
+	}
+	obj, err := p.Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return &errorPage{}, err
+	}
+	defer obj.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(obj.Body, maxErrorPageSize))
+	if err != nil {
+		return &errorPage{}, err
+	}
+	contentType := aws.ToString(obj.ContentType)
+	if contentType == "" {
+		contentType = "text/html; charset=utf-8"
+	}
+	return &errorPage{body: body, contentType: contentType}, nil
+}
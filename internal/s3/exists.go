@@ -0,0 +1,77 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// existsConcurrency bounds parallel HeadObject calls per /exists request.
+const existsConcurrency = 16
+
+// ExistsResult reports whether an asset path resolves to an object.
+type ExistsResult struct {
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	ETag   string `json:"etag,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+}
+
+// ExistsHandler accepts {"paths": ["/apps/chrome/js/app.js", ...]} and answers with the
+// per-path status, ETag and size using parallel HeadObject calls. resolve maps a request
+// path to its full "/bucket/key" path the same way the asset routes do.
+func (p *Proxy) ExistsHandler(resolve func(r *http.Request, reqPath string) (string, bool)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Paths []string `json:"paths"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil || len(req.Paths) == 0 {
+			p.Error(w, r, http.StatusBadRequest)
+			return
+		}
+		if len(req.Paths) > p.Config.ExistsMaxPaths {
+			p.Error(w, r, http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), p.Config.ProxiedRequestTimeout)
+		defer cancel()
+
+		results := make([]ExistsResult, len(req.Paths))
+		sem := make(chan struct{}, existsConcurrency)
+		var wg sync.WaitGroup
+		for i, reqPath := range req.Paths {
+			results[i].Path = reqPath
+			full, ok := resolve(r, reqPath)
+			bucket, key, valid := splitBucketKey(full)
+			if !ok || !valid {
+				results[i].Status = http.StatusBadRequest
+				continue
+			}
+			wg.Add(1)
+			go func(res *ExistsResult) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				out, err := p.Client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+				if err != nil {
+					res.Status = s3ErrorToStatus(err)
+					return
+				}
+				res.Status = http.StatusOK
+				res.ETag = aws.ToString(out.ETag)
+				res.Size = aws.ToInt64(out.ContentLength)
+			}(&results[i])
+		}
+		wg.Wait()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(map[string][]ExistsResult{"results": results})
+	}
+}
@@ -0,0 +1,173 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// fedModulesConcurrency bounds parallel manifest fetches while aggregating.
+const fedModulesConcurrency = 8
+
+// fedModules caches the merged fed-modules.json document.
+type fedModules struct {
+	mu      sync.Mutex
+	body    []byte
+	built   time.Time
+	expires time.Time
+}
+
+// FedModulesHandler serves a fed-modules.json built by merging every app's module federation
+// manifest found under FedModulesAppsPath. The merged document is cached for FedModulesTTL.
+func (p *Proxy) FedModulesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fm := &p.fedModules
+		fm.mu.Lock()
+		if fm.body == nil || time.Now().After(fm.expires) {
+			ctx, cancel := context.WithTimeout(r.Context(), p.Config.ProxiedRequestTimeout)
+			body, err := p.aggregateFedModules(ctx)
+			cancel()
+			if err != nil {
+				p.Log.WithFields(logger.Fields{"process": "fedmodules"}).Errorf("failed to aggregate fed-modules: %v", err)
+				if fm.body == nil {
+					fm.mu.Unlock()
+					status := s3ErrorToStatus(err)
+					p.writeError(w, r, status, err)
+					return
+				}
+				// Keep serving the stale document rather than breaking chrome
+			} else {
+				fm.body, fm.built = body, time.Now()
+			}
+			fm.expires = time.Now().Add(p.Config.FedModulesTTL)
+		}
+		body, built := fm.body, fm.built
+		fm.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(p.Config.FedModulesTTL.Seconds())))
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		setAge(w.Header(), built)
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			_, _ = w.Write(body)
+		}
+	}
+}
+
+// RefreshFedModules rebuilds the merged fed-modules.json document now, e.g. after an app
+// deploy changed its manifest. The previous document is kept when it fails.
+func (p *Proxy) RefreshFedModules(ctx context.Context) error {
+	body, err := p.aggregateFedModules(ctx)
+	if err != nil {
+		return err
+	}
+	fm := &p.fedModules
+	fm.mu.Lock()
+	fm.body, fm.built = body, time.Now()
+	fm.expires = fm.built.Add(p.Config.FedModulesTTL)
+	fm.mu.Unlock()
+	return nil
+}
+
+// aggregateFedModules lists app prefixes and merges their manifests' top-level entries.
+// Apps without a manifest are skipped; any other failure to read one fails the whole build,
+// so a transient S3 error doesn't publish a document missing that app's modules. On
+// duplicate module names the later app (by name) wins.
+func (p *Proxy) aggregateFedModules(ctx context.Context) ([]byte, error) {
+	bucket, root, ok := splitBucketKey(strings.TrimSuffix(p.Config.FedModulesAppsPath, "/") + "/")
+	if !ok {
+		// A bare bucket is allowed as the apps root
+		bucket, root = strings.Trim(p.Config.FedModulesAppsPath, "/"), ""
+	}
+	if root != "" && !strings.HasSuffix(root, "/") {
+		root += "/"
+	}
+
+	var apps []string
+	pager := s3.NewListObjectsV2Paginator(p.Client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(bucket),
+		Prefix:    aws.String(root),
+		Delimiter: aws.String("/"),
+	})
+	for pager.HasMorePages() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, cp := range page.CommonPrefixes {
+			apps = append(apps, aws.ToString(cp.Prefix))
+		}
+	}
+	sort.Strings(apps)
+
+	manifests := make([]map[string]json.RawMessage, len(apps))
+	errs := make([]error, len(apps))
+	sem := make(chan struct{}, fedModulesConcurrency)
+	var wg sync.WaitGroup
+	for i, app := range apps {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			obj, err := p.Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+			if err != nil {
+				if !isNoSuchKey(err) {
+					errs[i] = fmt.Errorf("%s: %w", key, err)
+				}
+				return
+			}
+			defer obj.Body.Close()
+			var m map[string]json.RawMessage
+			if err := json.NewDecoder(obj.Body).Decode(&m); err != nil {
+				p.Log.WithFields(logger.Fields{"process": "fedmodules", "key": key}).Warnf("skipping malformed manifest: %v", err)
+				return
+			}
+			manifests[i] = m
+		}(i, app+p.Config.FedModulesFile)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	merged := map[string]json.RawMessage{}
+	for i, m := range manifests {
+		for name, entry := range m {
+			if _, dup := merged[name]; dup {
+				p.Log.WithFields(logger.Fields{"process": "fedmodules", "module": name, "app": apps[i]}).Warnf("duplicate federated module name")
+			}
+			merged[name] = entry
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(merged); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// isNoSuchKey reports whether err is S3's answer for a missing object, as opposed to a
+// missing bucket, denied access or a transport failure.
+func isNoSuchKey(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchKey"
+}
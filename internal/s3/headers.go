@@ -0,0 +1,157 @@
+package s3
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// metadataHeader prefixes user metadata headers; "X-Amz-Meta-*" passes all of them through.
+const metadataHeader = "X-Amz-Meta-"
+
+// upstreamHeaders are the object headers that can be passed through to responses, by
+// canonical name.
+var upstreamHeaders = map[string]func(obj *s3.GetObjectOutput) *string{
+	"Content-Type":        func(obj *s3.GetObjectOutput) *string { return obj.ContentType },
+	"Etag":                func(obj *s3.GetObjectOutput) *string { return obj.ETag },
+	"Cache-Control":       func(obj *s3.GetObjectOutput) *string { return obj.CacheControl },
+	"Content-Encoding":    func(obj *s3.GetObjectOutput) *string { return obj.ContentEncoding },
+	"Content-Disposition": func(obj *s3.GetObjectOutput) *string { return obj.ContentDisposition },
+	"Content-Language":    func(obj *s3.GetObjectOutput) *string { return obj.ContentLanguage },
+	"Expires":             func(obj *s3.GetObjectOutput) *string { return obj.ExpiresString },
+	"Accept-Ranges":       func(obj *s3.GetObjectOutput) *string { return obj.AcceptRanges },
+	"Content-Md5":         contentMD5,
+	"X-Amz-Version-Id":    func(obj *s3.GetObjectOutput) *string { return obj.VersionId },
+	"X-Amz-Storage-Class": func(obj *s3.GetObjectOutput) *string { return enumValue(obj.StorageClass) },
+	"X-Amz-Server-Side-Encryption": func(obj *s3.GetObjectOutput) *string {
+		return enumValue(obj.ServerSideEncryption)
+	},
+	"X-Amz-Checksum-Crc32":     func(obj *s3.GetObjectOutput) *string { return obj.ChecksumCRC32 },
+	"X-Amz-Checksum-Crc32c":    func(obj *s3.GetObjectOutput) *string { return obj.ChecksumCRC32C },
+	"X-Amz-Checksum-Crc64nvme": func(obj *s3.GetObjectOutput) *string { return obj.ChecksumCRC64NVME },
+	"X-Amz-Checksum-Sha1":      func(obj *s3.GetObjectOutput) *string { return obj.ChecksumSHA1 },
+	"X-Amz-Checksum-Sha256":    func(obj *s3.GetObjectOutput) *string { return obj.ChecksumSHA256 },
+}
+
+// contentHeaders describe the stored bytes, so they are dropped when the body is rewritten.
+var contentHeaders = []string{"Content-Md5", "X-Amz-Checksum-Crc32", "X-Amz-Checksum-Crc32c", "X-Amz-Checksum-Crc64nvme", "X-Amz-Checksum-Sha1", "X-Amz-Checksum-Sha256"}
+
+func enumValue[T ~string](v T) *string {
+	if v == "" {
+		return nil
+	}
+	return aws.String(string(v))
+}
+
+// contentMD5 returns the object's base64 MD5: its MD5 checksum when stored, otherwise its
+// ETag when that is a plain MD5, as for single-part uploads without SSE-KMS.
+func contentMD5(obj *s3.GetObjectOutput) *string {
+	if obj.ChecksumMD5 != nil {
+		return obj.ChecksumMD5
+	}
+	etag := strings.Trim(aws.ToString(obj.ETag), `"`)
+	sum, err := hex.DecodeString(etag)
+	if err != nil || len(sum) != 16 {
+		return nil
+	}
+	return aws.String(base64.StdEncoding.EncodeToString(sum))
+}
+
+// CheckUpstreamHeaders reports names that cannot be passed through from objects.
+func CheckUpstreamHeaders(names []string) error {
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(name)
+		if _, ok := upstreamHeaders[name]; !ok && !strings.HasPrefix(name, metadataHeader) {
+			return fmt.Errorf("unsupported upstream header %q", name)
+		}
+	}
+	return nil
+}
+
+// defaultUpstreamHeaders returns UPSTREAM_HEADERS, followed by the headers enabled with
+// EXPOSE_VERSION_ID and EXPOSE_METADATA.
+func defaultUpstreamHeaders(cfg config.FrontendAssetProxyConfig) []string {
+	names := slices.Clone(cfg.UpstreamHeaders)
+	if cfg.ExposeVersionID {
+		names = append(names, "X-Amz-Version-Id")
+	}
+	for _, name := range cfg.ExposeMetadata {
+		names = append(names, metadataHeader+name)
+	}
+	return names
+}
+
+// UpstreamHeadersFor returns the object headers passed through on responses of rule.
+func UpstreamHeadersFor(cfg config.FrontendAssetProxyConfig, rule config.RouteRule) []string {
+	names := defaultUpstreamHeaders(cfg)
+	if rule.UpstreamHeaders != nil {
+		names = rule.UpstreamHeaders
+	}
+	var out []string
+	for _, name := range names {
+		if name = http.CanonicalHeaderKey(name); !deniedUpstreamHeader(rule, name) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// deniedUpstreamHeader reports whether rule never passes name through.
+func deniedUpstreamHeader(rule config.RouteRule, name string) bool {
+	return slices.ContainsFunc(rule.UpstreamHeadersDeny, func(deny string) bool { return strings.EqualFold(deny, name) })
+}
+
+// copyUpstreamHeaders sets the object headers passed through for rule: its own list, or
+// the default one, without the rule's denied headers. etag replaces the object's ETag, and
+// rewritten drops the headers describing the stored bytes.
+func (p *Proxy) copyUpstreamHeaders(h http.Header, rule config.RouteRule, obj *s3.GetObjectOutput, etag *string, rewritten bool) {
+	names := p.upstreamHeaders
+	if rule.UpstreamHeaders != nil {
+		names = rule.UpstreamHeaders
+	}
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(name)
+		if deniedUpstreamHeader(rule, name) {
+			continue
+		}
+		if rewritten && slices.Contains(contentHeaders, name) {
+			continue
+		}
+		if meta, ok := strings.CutPrefix(name, metadataHeader); ok {
+			p.copyMetadata(h, obj, strings.ToLower(meta), rule)
+			continue
+		}
+		value := upstreamHeaders[name]
+		if value == nil {
+			continue
+		}
+		v := value(obj)
+		if name == "Etag" {
+			v = etag
+		}
+		if v != nil {
+			h.Set(name, *v)
+		}
+	}
+}
+
+// copyMetadata sets the user metadata key as an X-Amz-Meta- header, or all of them for "*".
+func (p *Proxy) copyMetadata(h http.Header, obj *s3.GetObjectOutput, key string, rule config.RouteRule) {
+	for k, v := range obj.Metadata {
+		if key != "*" && k != key {
+			continue
+		}
+		name := metadataHeader + k
+		if key == "*" && deniedUpstreamHeader(rule, name) {
+			continue
+		}
+		h.Set(name, v)
+	}
+}
@@ -0,0 +1,104 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/metrics"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type hedgeResult struct {
+	obj     *s3.GetObjectOutput
+	err     error
+	attempt int
+}
+
+// hedgedGetObject calls GetObject and, when it has not responded within HedgeDelay, sends
+// the same request again and uses whichever responds first. The slower attempt is
+// canceled and its body discarded; MinIO occasionally has multi-second stragglers that
+// otherwise dominate tail latency.
+func (p *Proxy) hedgedGetObject(ctx context.Context, in *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if p.Config.HedgeDelay <= 0 {
+		return p.Client.GetObject(ctx, in, optFns...)
+	}
+
+	results := make(chan hedgeResult, 2)
+	var cancels []context.CancelFunc
+	send := func() {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		attempt := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			obj, err := p.Client.GetObject(attemptCtx, in, optFns...)
+			results <- hedgeResult{obj: obj, err: err, attempt: attempt}
+		}()
+	}
+
+	send()
+	timer := time.NewTimer(p.Config.HedgeDelay)
+	defer timer.Stop()
+	var res hedgeResult
+	select {
+	case res = <-results:
+		// Answered (or failed) before the hedge was due
+		return finishHedge(res, cancels, results, 0)
+	case <-timer.C:
+		send()
+	}
+
+	// Take the first success; a failure only counts once both attempts have failed
+	pending := len(cancels)
+	for pending > 0 {
+		res = <-results
+		pending--
+		if res.err == nil {
+			break
+		}
+		cancels[res.attempt]()
+	}
+	winner := [...]string{"primary", "hedge"}[res.attempt]
+	if res.err != nil {
+		winner = "none"
+	}
+	metrics.HedgedRequestsTotal.WithLabelValues(winner).Inc()
+	return finishHedge(res, cancels, results, pending)
+}
+
+// finishHedge cancels the attempts other than res, discards the responses still pending
+// from them, and ties res's context to its body.
+func finishHedge(res hedgeResult, cancels []context.CancelFunc, results <-chan hedgeResult, pending int) (*s3.GetObjectOutput, error) {
+	for i, cancel := range cancels {
+		if i != res.attempt {
+			cancel()
+		}
+	}
+	if pending > 0 {
+		go func() {
+			for ; pending > 0; pending-- {
+				if late := <-results; late.obj != nil {
+					late.obj.Body.Close()
+				}
+			}
+		}()
+	}
+	if res.err != nil {
+		cancels[res.attempt]()
+		return nil, res.err
+	}
+	res.obj.Body = &cancelOnClose{ReadCloser: res.obj.Body, cancel: cancels[res.attempt]}
+	return res.obj, nil
+}
+
+// cancelOnClose releases a context once the body read under it is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
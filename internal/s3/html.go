@@ -0,0 +1,81 @@
+package s3
+
+import (
+	"mime"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// maxRewrittenHTMLSize caps how much of an HTML or JavaScript entrypoint is buffered for
+// rewriting; larger documents are streamed unmodified.
+const maxRewrittenHTMLSize = 5 << 20
+
+// baseHrefPattern matches the href attribute of a <base> element.
+var baseHrefPattern = regexp.MustCompile(`(?i)(<base\b[^>]*?\bhref\s*=\s*)("[^"]*"|'[^']*')`)
+
+// newHTMLVariables builds the replacer substituting %%NAME%% placeholders with configured values.
+func newHTMLVariables(vars map[string]string) *strings.Replacer {
+	if len(vars) == 0 {
+		return nil
+	}
+	pairs := make([]string, 0, len(vars)*2)
+	for name, value := range vars {
+		pairs = append(pairs, "%%"+name+"%%", value)
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// isHTMLObject reports whether obj is an HTML document.
+func isHTMLObject(obj *s3.GetObjectOutput) bool {
+	mt, _, err := mime.ParseMediaType(aws.ToString(obj.ContentType))
+	return err == nil && mt == "text/html"
+}
+
+// bodyRewriter returns the rewrite applied to obj's body for rule and key, or nil when
+// nothing applies. HTML gets placeholder substitution, <base href> rewriting and the
+// public path rewrite; JavaScript only gets the public path rewrite, and only for files
+// matching the rule's entrypoint patterns. Encoded or partial bodies are never rewritten.
+func (p *Proxy) bodyRewriter(rule config.RouteRule, key string, obj *s3.GetObjectOutput) func(string) string {
+	if obj.ContentEncoding != nil && *obj.ContentEncoding != "" && *obj.ContentEncoding != "identity" {
+		return nil
+	}
+	if obj.ContentRange != nil || aws.ToInt64(obj.ContentLength) > maxRewrittenHTMLSize {
+		return nil
+	}
+	mt, _, err := mime.ParseMediaType(aws.ToString(obj.ContentType))
+	if err != nil {
+		return nil
+	}
+	isHTML := mt == "text/html"
+	isJS := mt == "application/javascript" || mt == "text/javascript"
+
+	var steps []func(string) string
+	if isHTML && p.htmlVariables != nil {
+		steps = append(steps, p.htmlVariables.Replace)
+	}
+	if isHTML && rule.BaseHref != "" {
+		href := `"` + strings.ReplaceAll(rule.BaseHref, `"`, "&quot;") + `"`
+		steps = append(steps, func(s string) string {
+			return baseHrefPattern.ReplaceAllString(s, "${1}"+strings.ReplaceAll(href, "$", "$$"))
+		})
+	}
+	if pr := rule.PublicPath; pr != nil && pr.From != "" && (isHTML || isJS) && pr.Matches(path.Base(key), isHTML) {
+		steps = append(steps, func(s string) string {
+			return strings.ReplaceAll(s, pr.From, pr.To)
+		})
+	}
+	if len(steps) == 0 {
+		return nil
+	}
+	return func(s string) string {
+		for _, step := range steps {
+			s = step(s)
+		}
+		return s
+	}
+}
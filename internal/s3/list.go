@@ -0,0 +1,117 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ObjectInfo describes a listed object. Name is relative to the listed prefix.
+type ObjectInfo struct {
+	Name         string    `json:"name"`
+	ETag         string    `json:"etag"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// ListObjects lists every object under the full path prefix "/bucket/prefix/", following pagination.
+func (p *Proxy) ListObjects(ctx context.Context, full string) ([]ObjectInfo, error) {
+	bucket, prefix, ok := splitListPath(full)
+	if !ok {
+		return nil, errInvalidPath
+	}
+
+	var out []ObjectInfo
+	pager := s3.NewListObjectsV2Paginator(p.Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for pager.HasMorePages() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			out = append(out, ObjectInfo{
+				Name:         strings.TrimPrefix(aws.ToString(obj.Key), prefix),
+				ETag:         aws.ToString(obj.ETag),
+				Size:         aws.ToInt64(obj.Size),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+	return out, nil
+}
+
+// splitListPath splits the full path "/bucket/prefix" into its bucket and the key prefix
+// "prefix/" to list.
+func splitListPath(full string) (string, string, bool) {
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(full, "/"), "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return bucket, prefix, bucket != ""
+}
+
+// Listing is a page of the objects under a prefix. Next, when set, is the cursor of the
+// following page.
+type Listing struct {
+	Prefix  string       `json:"prefix"`
+	Objects []ObjectInfo `json:"objects"`
+	Next    string       `json:"next,omitempty"`
+}
+
+// serveListing answers GET <prefix>?list with a JSON page of the objects under full, at
+// most LISTING_MAX_KEYS at a time; ?list&cursor=<next> fetches the following page.
+func (p *Proxy) serveListing(w http.ResponseWriter, r *http.Request, full string) {
+	bucket, prefix, ok := splitListPath(full)
+	if !ok {
+		p.Error(w, r, http.StatusBadRequest)
+		return
+	}
+	in := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(int32(max(1, min(p.Config.ListingMaxKeys, 1000)))),
+	}
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		in.ContinuationToken = aws.String(cursor)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), p.Config.ProxiedRequestTimeout)
+	defer cancel()
+	page, err := p.Client.ListObjectsV2(ctx, in)
+	if err != nil {
+		status := s3ErrorToStatus(err)
+		if status >= http.StatusInternalServerError {
+			p.Log.WithFields(logger.Fields{"process": "listing", "bucket": bucket, "prefix": prefix}).Errorf("failed to list objects: %v", err)
+		}
+		p.writeError(w, r, status, err)
+		return
+	}
+
+	listing := Listing{Prefix: r.URL.Path, Objects: make([]ObjectInfo, 0, len(page.Contents))}
+	for _, obj := range page.Contents {
+		listing.Objects = append(listing.Objects, ObjectInfo{
+			Name:         strings.TrimPrefix(aws.ToString(obj.Key), prefix),
+			ETag:         aws.ToString(obj.ETag),
+			Size:         aws.ToInt64(obj.Size),
+			LastModified: aws.ToTime(obj.LastModified),
+		})
+	}
+	if aws.ToBool(page.IsTruncated) {
+		listing.Next = aws.ToString(page.NextContinuationToken)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_ = json.NewEncoder(w).Encode(listing)
+	}
+}
@@ -0,0 +1,45 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+)
+
+// ManifestIndexHandler lists the JSON manifests available under rule (e.g. GET /manifests)
+// with their ETags and timestamps, so tooling can see what is actually deployed.
+func (p *Proxy) ManifestIndexHandler(rule config.RouteRule) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		listPath := rule.Prefix + "/"
+		if rule.StripPrefix {
+			listPath = "/"
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), p.Config.ProxiedRequestTimeout)
+		defer cancel()
+		objects, err := p.ListObjects(ctx, JoinPath(rule.BucketPath, listPath))
+		if err != nil {
+			p.Log.WithFields(logger.Fields{"process": "manifests"}).Errorf("failed to list manifests: %v", err)
+			status := s3ErrorToStatus(err)
+			p.writeError(w, r, status, err)
+			return
+		}
+
+		manifests := make([]ObjectInfo, 0, len(objects))
+		for _, obj := range objects {
+			if strings.HasSuffix(obj.Name, ".json") {
+				manifests = append(manifests, obj)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			_ = json.NewEncoder(w).Encode(manifests)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package s3
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/metrics"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Mirror replays a sample of proxied requests against a secondary bucket and
+// logs any difference in status, ETag or Content-Length. It never touches the
+// client response; comparisons run in the background, at most cap(inFlight) at a
+// time, so a slow mirror bucket cannot pile up goroutines.
+type Mirror struct {
+	Client     *s3.Client
+	FromPrefix string
+	ToPrefix   string
+	SampleRate float64
+	Timeout    time.Duration
+	Log        logger.Logger
+
+	inFlight chan struct{}
+}
+
+// Observe records the primary outcome for full and, if the request is sampled,
+// asynchronously compares it with the same key in the mirror bucket. Samples are
+// dropped, and counted, while the comparison limit is reached.
+func (m *Mirror) Observe(r *http.Request, full string, status int, etag *string, length *int64) {
+	if m.SampleRate <= 0 || rand.Float64() >= m.SampleRate {
+		return
+	}
+	if !underPrefix(full, m.FromPrefix) {
+		return
+	}
+	bucket, key, ok := splitBucketKey(JoinPath(m.ToPrefix, strings.TrimPrefix(full, m.FromPrefix)))
+	if !ok {
+		return
+	}
+
+	in := &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	if v := r.Header.Get("Range"); v != "" {
+		in.Range = aws.String(v)
+	}
+	if v := r.Header.Get("If-None-Match"); v != "" {
+		in.IfNoneMatch = aws.String(strongETags(v))
+	}
+	if v := r.Header.Get("If-Match"); v != "" {
+		in.IfMatch = aws.String(v)
+	}
+	if v := r.Header.Get("If-Modified-Since"); v != "" {
+		if t, err := http.ParseTime(v); err == nil {
+			in.IfModifiedSince = aws.Time(t)
+		}
+	}
+	if v := r.Header.Get("If-Unmodified-Since"); v != "" {
+		if t, err := http.ParseTime(v); err == nil {
+			in.IfUnmodifiedSince = aws.Time(t)
+		}
+	}
+	reqID := middleware.GetReqID(r.Context())
+
+	select {
+	case m.inFlight <- struct{}{}:
+	default:
+		metrics.MirrorDroppedTotal.Inc()
+		return
+	}
+	go func() {
+		defer func() { <-m.inFlight }()
+		// Detached from the request context: the client response is already on its way.
+		ctx, cancel := context.WithTimeout(context.Background(), m.Timeout)
+		defer cancel()
+
+		mirrorStatus := http.StatusOK
+		var mirrorETag *string
+		var mirrorLength *int64
+		out, err := m.Client.HeadObject(ctx, in)
+		if err != nil {
+			mirrorStatus = s3ErrorToStatus(err)
+		} else {
+			mirrorETag, mirrorLength = out.ETag, out.ContentLength
+		}
+
+		if status == mirrorStatus && aws.ToString(etag) == aws.ToString(mirrorETag) && aws.ToInt64(length) == aws.ToInt64(mirrorLength) {
+			return
+		}
+		m.Log.WithFields(logger.Fields{
+			"process":               "mirror",
+			"request_id":            reqID,
+			"bucket":                bucket,
+			"key":                   key,
+			"status":                status,
+			"mirror_status":         mirrorStatus,
+			"etag":                  aws.ToString(etag),
+			"mirror_etag":           aws.ToString(mirrorETag),
+			"content_length":        aws.ToInt64(length),
+			"mirror_content_length": aws.ToInt64(mirrorLength),
+		}).Warnf("mirror mismatch")
+	}()
+}
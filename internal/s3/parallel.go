@@ -0,0 +1,123 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// useParallelFetch reports whether obj, fetched for r, should be streamed with parallel
+// ranged reads: full-object GETs larger than the configured threshold. Never with checksum
+// validation, which needs the whole body read through the original response to verify it.
+func (p *Proxy) useParallelFetch(r *http.Request, obj *s3.GetObjectOutput) bool {
+	threshold := p.Config.ParallelFetchThreshold
+	return threshold > 0 && !p.Config.S3ChecksumValidation && r.Method == http.MethodGet && obj.ContentRange == nil &&
+		aws.ToInt64(obj.ContentLength) > threshold && p.Config.ParallelFetchPartSize > 0
+}
+
+// parallelBody replaces obj.Body with a reader that serves the first part from the
+// original response and fetches the remaining parts with concurrent ranged GetObject
+// calls, returning them in order. Parts are pinned to the object's version or ETag so a
+// concurrent upload cannot mix two objects. At most ParallelFetchConcurrency parts are
+// buffered ahead of the reader.
+func (p *Proxy) parallelBody(ctx context.Context, bucket, key string, obj *s3.GetObjectOutput) io.ReadCloser {
+	size, partSize := aws.ToInt64(obj.ContentLength), p.Config.ParallelFetchPartSize
+	ctx, cancel := context.WithCancel(ctx)
+	pb := &parallelBody{
+		ctx:    ctx,
+		first:  obj.Body,
+		cur:    io.LimitReader(obj.Body, partSize),
+		cancel: cancel,
+		sem:    make(chan struct{}, max(p.Config.ParallelFetchConcurrency, 1)),
+	}
+	for off := partSize; off < size; off += partSize {
+		pb.parts = append(pb.parts, make(chan partResult, 1))
+	}
+
+	go func() {
+		for i, ch := range pb.parts {
+			select {
+			case pb.sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			start := int64(i+1) * partSize
+			end := min(start+partSize, size) - 1
+			go func() {
+				in := &s3.GetObjectInput{
+					Bucket:    aws.String(bucket),
+					Key:       aws.String(key),
+					Range:     aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+					VersionId: obj.VersionId,
+				}
+				if obj.VersionId == nil {
+					in.IfMatch = obj.ETag
+				}
+				out, err := p.Client.GetObject(ctx, in)
+				if err != nil {
+					ch <- partResult{err: err}
+					return
+				}
+				defer out.Body.Close()
+				buf := make([]byte, end-start+1)
+				_, err = io.ReadFull(out.Body, buf)
+				ch <- partResult{data: buf, err: err}
+			}()
+		}
+	}()
+	return pb
+}
+
+type partResult struct {
+	data []byte
+	err  error
+}
+
+type parallelBody struct {
+	ctx    context.Context
+	first  io.ReadCloser
+	cur    io.Reader
+	parts  []chan partResult
+	next   int
+	sem    chan struct{}
+	cancel context.CancelFunc
+}
+
+func (pb *parallelBody) Read(b []byte) (int, error) {
+	for {
+		n, err := pb.cur.Read(b)
+		if n > 0 || (err != nil && err != io.EOF) {
+			return n, err
+		}
+		if pb.next == len(pb.parts) {
+			return 0, io.EOF
+		}
+		if pb.next == 0 {
+			// The original response is only needed for the first part.
+			pb.first.Close()
+		} else {
+			<-pb.sem
+		}
+		var res partResult
+		select {
+		case res = <-pb.parts[pb.next]:
+		case <-pb.ctx.Done():
+			return 0, pb.ctx.Err()
+		}
+		pb.next++
+		if res.err != nil {
+			return 0, fmt.Errorf("fetch part %d: %w", pb.next, res.err)
+		}
+		pb.cur = bytes.NewReader(res.data)
+	}
+}
+
+func (pb *parallelBody) Close() error {
+	pb.cancel()
+	return pb.first.Close()
+}
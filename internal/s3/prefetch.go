@@ -0,0 +1,103 @@
+package s3
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// maxPrefetchedDocuments bounds how many HTML documents are remembered as already prefetched.
+const maxPrefetchedDocuments = 4096
+
+var (
+	// scriptSrcPattern matches the src attribute of a <script> element.
+	scriptSrcPattern = regexp.MustCompile(`(?i)<script\b[^>]*?\bsrc\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	// linkTagPattern matches a <link> element.
+	linkTagPattern = regexp.MustCompile(`(?i)<link\b[^>]*>`)
+	// linkRelPattern matches the rel attribute of a <link> element worth prefetching.
+	linkRelPattern = regexp.MustCompile(`(?i)\brel\s*=\s*["']?[^"'>]*\b(stylesheet|modulepreload|preload)\b`)
+	// hrefPattern matches an href attribute.
+	hrefPattern = regexp.MustCompile(`(?i)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+)
+
+// shouldPrefetch reports whether the body of obj, served for r, should be scanned for
+// referenced assets once streamed: uncompressed HTML documents fetched with GET.
+func (p *Proxy) shouldPrefetch(r *http.Request, obj *s3.GetObjectOutput) bool {
+	if !p.Config.CachePrefetchHTML || p.cache == nil || p.Resolve == nil || r.Method != http.MethodGet {
+		return false
+	}
+	if enc := aws.ToString(obj.ContentEncoding); enc != "" && enc != "identity" {
+		return false
+	}
+	return isHTMLObject(obj) && obj.ContentRange == nil && aws.ToInt64(obj.ContentLength) <= maxRewrittenHTMLSize
+}
+
+// prefetchReferenced loads the scripts and stylesheets referenced by doc, the HTML served
+// for r, into the cache in the background so the browser's follow-up requests are hits.
+// Each document version (key and ETag) is scanned once per cache TTL.
+func (p *Proxy) prefetchReferenced(r *http.Request, key string, etag *string, doc string) {
+	docKey := key + "@" + aws.ToString(etag)
+	if _, _, seen := p.prefetched.Get(docKey); seen {
+		return
+	}
+	p.prefetched.Add(docKey, struct{}{}, 1)
+
+	paths := assetPaths(r, doc)
+	if len(paths) == 0 {
+		return
+	}
+	host := r.Host
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), p.Config.ProxiedRequestTimeout)
+		defer cancel()
+		p.fillCache(ctx, "prefetch", host, paths, p.Resolve)
+	}()
+}
+
+// assetPaths returns the same-origin request paths of the scripts and stylesheets
+// referenced by doc, resolved the way the browser would: against the document's
+// <base href>, if any, and the request URL.
+func assetPaths(r *http.Request, doc string) []string {
+	base := &url.URL{Path: r.URL.Path}
+	if m := baseHrefPattern.FindStringSubmatch(doc); m != nil {
+		if u, err := url.Parse(strings.Trim(m[2], `"'`)); err == nil {
+			base = base.ResolveReference(u)
+		}
+	}
+
+	var refs []string
+	for _, m := range scriptSrcPattern.FindAllStringSubmatch(doc, -1) {
+		refs = append(refs, m[1]+m[2])
+	}
+	for _, tag := range linkTagPattern.FindAllString(doc, -1) {
+		if !linkRelPattern.MatchString(tag) {
+			continue
+		}
+		if m := hrefPattern.FindStringSubmatch(tag); m != nil {
+			refs = append(refs, m[1]+m[2])
+		}
+	}
+
+	seen := map[string]bool{}
+	var paths []string
+	for _, ref := range refs {
+		u, err := url.Parse(strings.TrimSpace(ref))
+		if err != nil || ref == "" {
+			continue
+		}
+		abs := base.ResolveReference(u)
+		if (abs.Scheme != "" && abs.Scheme != "http" && abs.Scheme != "https") || (abs.Host != "" && !strings.EqualFold(abs.Host, r.Host)) {
+			continue
+		}
+		if !seen[abs.Path] {
+			seen[abs.Path] = true
+			paths = append(paths, abs.Path)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,59 @@
+package s3
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/metrics"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/vary"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// defaultPresignExpiry is the lifetime of presigned URLs for rules that do not set one.
+const defaultPresignExpiry = 5 * time.Minute
+
+// presignRedirect redirects the client to a presigned GetObject URL for bucket/key when
+// the rule opts in and the object is at least the rule's MinSize, so large downloads
+// bypass the proxy. It reports false when the object should be streamed instead,
+// including when it is missing, so errors and the SPA fallback are handled as usual.
+func (p *Proxy) presignRedirect(ctx context.Context, w http.ResponseWriter, r *http.Request, rule config.RouteRule, bucket, key, versionID string) bool {
+	if rule.Presign == nil {
+		return false
+	}
+	vary.Add(w.Header(), "Accept")
+	if isNavigation(r) {
+		return false
+	}
+	head := &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	in := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	if versionID != "" {
+		head.VersionId = aws.String(versionID)
+		in.VersionId = aws.String(versionID)
+	}
+	out, err := p.Client.HeadObject(ctx, head)
+	if err != nil || aws.ToInt64(out.ContentLength) < rule.Presign.MinSize {
+		return false
+	}
+	expires := time.Duration(rule.Presign.Expires)
+	if expires <= 0 {
+		expires = defaultPresignExpiry
+	}
+	req, err := s3.NewPresignClient(p.Client).PresignGetObject(ctx, in, s3.WithPresignExpires(expires))
+	if err != nil {
+		p.Log.WithFields(logger.Fields{"process": "proxy", "bucket": bucket, "key": key}).Warnf("presign failed, streaming instead: %v", err)
+		return false
+	}
+	if stats := statsFrom(r.Context()); stats != nil {
+		stats.Bucket, stats.Key = bucket, key
+	}
+	logger.AddFields(r, logger.Fields{"presigned": true})
+	metrics.PresignedRedirectsTotal.Inc()
+	// The URL expires, so the redirect itself must not be cached
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, req.URL, http.StatusFound)
+	return true
+}
@@ -0,0 +1,73 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/release"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ReleaseStore keeps the live releases in a JSON object in the bucket, e.g.
+// {"chrome":{"live":"green","previous":"blue"}}, so every replica serves the same release.
+type ReleaseStore struct {
+	client      *s3.Client
+	bucket, key string
+}
+
+// ReleaseStore returns the store for the object at the bucket path statePath.
+func (p *Proxy) ReleaseStore(statePath string) (*ReleaseStore, error) {
+	bucket, key, ok := splitBucketKey(statePath)
+	if !ok {
+		return nil, errInvalidPath
+	}
+	return &ReleaseStore{client: p.Client, bucket: bucket, key: key}, nil
+}
+
+// Load reads the stored pointers and their ETag; a missing object means no release was
+// switched yet.
+func (s *ReleaseStore) Load(ctx context.Context) (map[string]release.Pointer, string, error) {
+	obj, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(s.key)})
+	if err != nil {
+		if s3ErrorToStatus(err) == http.StatusNotFound {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+	defer obj.Body.Close()
+	var pointers map[string]release.Pointer
+	if err := json.NewDecoder(obj.Body).Decode(&pointers); err != nil {
+		return nil, "", err
+	}
+	return pointers, aws.ToString(obj.ETag), nil
+}
+
+// Save replaces the stored pointers with a conditional PutObject: If-Match on the ETag
+// they were loaded with, or If-None-Match: * while no object exists, so a concurrent
+// switch from another replica is never overwritten.
+func (s *ReleaseStore) Save(ctx context.Context, pointers map[string]release.Pointer, version string) error {
+	body, err := json.Marshal(pointers)
+	if err != nil {
+		return err
+	}
+	in := &s3.PutObjectInput{
+		Bucket:       aws.String(s.bucket),
+		Key:          aws.String(s.key),
+		Body:         bytes.NewReader(body),
+		ContentType:  aws.String("application/json"),
+		CacheControl: aws.String("no-store"),
+	}
+	if version != "" {
+		in.IfMatch = aws.String(version)
+	} else {
+		in.IfNoneMatch = aws.String("*")
+	}
+	_, err = s.client.PutObject(ctx, in)
+	if status := s3ErrorToStatus(err); err != nil && (status == http.StatusPreconditionFailed || status == http.StatusConflict) {
+		return release.ErrConflict
+	}
+	return err
+}
@@ -0,0 +1,73 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/metrics"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+)
+
+// newRetryer builds the S3 client's retry strategy. With the SDK defaults a burst of
+// SlowDown responses from MinIO turns into synchronized retries from every replica, so
+// the mode, backoff cap and retryable codes are configurable and retries are counted.
+func newRetryer(cfg config.FrontendAssetProxyConfig) func() aws.Retryer {
+	standard := func(o *retry.StandardOptions) {
+		o.MaxAttempts = cfg.MaxRetryAttempts
+		if cfg.RetryMaxBackoff > 0 {
+			o.MaxBackoff = cfg.RetryMaxBackoff
+			o.Backoff = retry.NewExponentialJitterBackoff(cfg.RetryMaxBackoff)
+		}
+		if len(cfg.RetryableCodes) > 0 {
+			codes := make(map[string]struct{}, len(cfg.RetryableCodes))
+			for _, code := range cfg.RetryableCodes {
+				codes[code] = struct{}{}
+			}
+			o.Retryables = append(o.Retryables, retry.RetryableErrorCode{Codes: codes})
+		}
+	}
+	return func() aws.Retryer {
+		if cfg.RetryMode == "adaptive" {
+			return countingRetryer{retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+				o.StandardOptions = append(o.StandardOptions, standard)
+			})}
+		}
+		return countingRetryer{retry.NewStandard(standard)}
+	}
+}
+
+// countingRetryer records retry metrics around another retryer.
+type countingRetryer struct {
+	aws.RetryerV2
+}
+
+// GetRetryToken is called once a failed attempt is found retryable; an error means the
+// retry quota is exhausted and the request fails without retrying.
+func (r countingRetryer) GetRetryToken(ctx context.Context, opErr error) (func(error) error, error) {
+	release, err := r.RetryerV2.GetRetryToken(ctx, opErr)
+	if err != nil {
+		metrics.S3RetryQuotaExceededTotal.Inc()
+	}
+	return release, err
+}
+
+// RetryDelay is only called for attempts that will be retried.
+func (r countingRetryer) RetryDelay(attempt int, opErr error) (time.Duration, error) {
+	delay, err := r.RetryerV2.RetryDelay(attempt, opErr)
+	if err == nil {
+		metrics.S3RetriesTotal.WithLabelValues(retryCode(opErr)).Inc()
+	}
+	return delay, err
+}
+
+func retryCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return "transport"
+}
@@ -1,16 +1,26 @@
 package s3
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"path"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/cache"
 	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
 	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/manifest"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/metrics"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/tape"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/throttle"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/vary"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
@@ -18,130 +28,607 @@ import (
 	smithy "github.com/aws/smithy-go"
 	"github.com/aws/smithy-go/logging"
 	smithyhttp "github.com/aws/smithy-go/transport/http"
-	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 )
 
-func NewS3ClientFromConfig(cfg config.FrontendAssetProxyConfig, log *logrus.Logger) *s3.Client {
-	var loadOpts []func(*awsconfig.LoadOptions) error
-	loadOpts = append(loadOpts, awsconfig.WithRegion(cfg.Region))
-	loadOpts = append(loadOpts, awsconfig.WithLogger(logger.ContextAwareLogger{Base: log}))
-	loadOpts = append(loadOpts, awsconfig.WithClientLogMode(cfg.ClientLogMode))
-	loadOpts = append(loadOpts, awsconfig.WithRetryMaxAttempts(cfg.MaxRetryAttempts))
-
+// LoadAWSConfig resolves the region, SDK logging and credentials chain shared by the
+// proxy's AWS clients, followed by loadOpts.
+func LoadAWSConfig(cfg config.FrontendAssetProxyConfig, log logger.Logger, loadOpts ...func(*awsconfig.LoadOptions) error) (aws.Config, error) {
+	opts := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRegion(cfg.Region),
+		awsconfig.WithLogger(logger.ContextAwareLogger{Base: log}),
+		awsconfig.WithClientLogMode(cfg.ClientLogMode),
+	}
 	if cfg.AccessKeyID != "" && cfg.SecretAccessKey != "" {
-		loadOpts = append(loadOpts, awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, "")))
+		opts = append(opts, awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, "")))
 	} else if cfg.UpstreamURL != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(aws.AnonymousCredentials{}))
+	}
+	return awsconfig.LoadDefaultConfig(context.Background(), append(opts, loadOpts...)...)
+}
+
+func NewS3ClientFromConfig(cfg config.FrontendAssetProxyConfig, log logger.Logger) *s3.Client {
+	loadOpts := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRetryer(newRetryer(cfg)),
+		awsconfig.WithHTTPClient(newHTTPClient(cfg, log)),
+	}
+	if cfg.S3RecordMode == tape.Replay {
+		// Replayed requests are not sent anywhere, so resolving credentials would only
+		// reach for the network
 		loadOpts = append(loadOpts, awsconfig.WithCredentialsProvider(aws.AnonymousCredentials{}))
 	}
+	if cfg.S3DualStack {
+		loadOpts = append(loadOpts, awsconfig.WithUseDualStackEndpoint(aws.DualStackEndpointStateEnabled))
+	}
 
-	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), loadOpts...)
+	awsCfg, err := LoadAWSConfig(cfg, log, loadOpts...)
 	if err != nil {
 		panic(err)
 	}
 
 	return s3.NewFromConfig(awsCfg, func(o *s3.Options) {
-		if cfg.UpstreamURL != "" {
+		o.APIOptions = append(o.APIOptions, propagateTraceContext)
+		if cfg.S3RecordMode != "" {
+			// Wrapped here rather than when loading the config, which needs the buildable
+			// client to apply AWS_CA_BUNDLE
+			o.HTTPClient = &tape.Client{Mode: cfg.S3RecordMode, Dir: cfg.S3RecordDir, Next: o.HTTPClient}
+		}
+		// Full-object checksums are only requested and verified when enabled
+		o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+		if cfg.S3ChecksumValidation {
+			o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenSupported
+		}
+		if _, ok := unixSocket(cfg.UpstreamURL); ok {
+			// The host is only used for signing; the transport dials the socket.
+			o.BaseEndpoint = aws.String("http://localhost")
+			o.UsePathStyle = true
+		} else if cfg.UpstreamURL != "" {
 			if u, err := url.Parse(cfg.UpstreamURL); err == nil && u.Scheme != "" && u.Host != "" {
 				o.BaseEndpoint = aws.String(u.Scheme + "://" + u.Host)
 				o.UsePathStyle = true
 			}
+		} else {
+			// Transfer Acceleration needs AWS virtual-hosted-style endpoints
+			o.UseAccelerate = cfg.S3Accelerate
 		}
 	})
 }
 
-// ProxyS3 resolves bucket/key from full path "/bucket/..." and streams from S3/MinIO
-func ProxyS3(w http.ResponseWriter, r *http.Request, s3c *s3.Client, cfg config.FrontendAssetProxyConfig, full string, log *logrus.Logger) {
+// Proxy serves objects from S3/MinIO on behalf of the HTTP routes.
+type Proxy struct {
+	Client *s3.Client
+	Config config.FrontendAssetProxyConfig
+	Log    logger.Logger
+
+	// Mirror optionally shadows a sample of requests to a secondary bucket.
+	Mirror *Mirror
+	// ManifestValidator optionally validates served manifests against a JSON schema.
+	ManifestValidator *manifest.Validator
+	// UnderPressure, when set, reports memory pressure; objects are not cached meanwhile.
+	UnderPressure func() bool
+	// Resolve maps a request path to its full bucket path; used to prefetch assets referenced by HTML.
+	Resolve func(r *http.Request, reqPath string) (string, bool)
+
+	versionMaps      versionMaps
+	preloadManifests preloadManifests
+	fedModules       fedModules
+	errorPages       errorPages
+	htmlVariables    *strings.Replacer
+	// upstreamHeaders are the object headers passed through unless a rule sets its own.
+	upstreamHeaders []string
+	// egress caps the combined byte rate of all responses; nil when unlimited.
+	egress *rate.Limiter
+	// cache holds small objects in memory; nil when CACHE_MAX_BYTES is 0.
+	cache *cache.Cache[*cachedObject]
+	// prefetched remembers HTML documents whose referenced assets were already prefetched.
+	prefetched *cache.Cache[struct{}]
+	// slowLog writes slow request warnings even when Log is set to a higher level.
+	slowLog logger.Logger
+}
+
+var errInvalidPath = errors.New("path must be /bucket/key")
+
+// maxValidatedManifestSize caps how much of a manifest is buffered for schema validation.
+const maxValidatedManifestSize = 10 << 20
+
+// NewProxy builds a Proxy and, when configured, its shadow traffic mirror.
+func NewProxy(cfg config.FrontendAssetProxyConfig, log logger.Logger) *Proxy {
+	return NewProxyWithClient(cfg, NewS3ClientFromConfig(cfg, log), log)
+}
+
+// NewProxyWithClient is NewProxy with an existing S3 client, e.g. one shared with the
+// embedding program. The mirror shares it unless MIRROR_UPSTREAM_URL differs.
+func NewProxyWithClient(cfg config.FrontendAssetProxyConfig, client *s3.Client, log logger.Logger) *Proxy {
+	p := &Proxy{
+		Client: client,
+		Config: cfg,
+		Log:    log,
+
+		htmlVariables:   newHTMLVariables(cfg.HTMLVariables),
+		upstreamHeaders: defaultUpstreamHeaders(cfg),
+		egress:          throttle.NewLimiter(cfg.BandwidthGlobal),
+	}
+	if cfg.CacheMaxBytes > 0 {
+		p.cache = cache.New[*cachedObject](cfg.CacheMaxBytes, cfg.CacheTTL)
+		p.prefetched = cache.New[struct{}](maxPrefetchedDocuments, cfg.CacheTTL)
+	}
+	if cfg.SlowRequestThreshold > 0 {
+		p.slowLog = log
+		if root, ok := log.(*logger.Root); ok {
+			p.slowLog = root.AtLevel(slog.LevelWarn)
+		}
+	}
+	if cfg.S3ChecksumValidation && cfg.ParallelFetchThreshold > 0 {
+		log.Warnf("PARALLEL_FETCH_THRESHOLD is ignored with S3_CHECKSUM_VALIDATION: full-object checksums can't be verified over ranged reads")
+	}
+	if cfg.MirrorBucketPathPrefix != "" {
+		mirrorClient := p.Client
+		if cfg.MirrorUpstreamURL != cfg.UpstreamURL {
+			mirrorCfg := cfg
+			mirrorCfg.UpstreamURL = cfg.MirrorUpstreamURL
+			mirrorClient = NewS3ClientFromConfig(mirrorCfg, log)
+		}
+		p.Mirror = &Mirror{
+			Client:     mirrorClient,
+			FromPrefix: cfg.BucketPathPrefix,
+			ToPrefix:   cfg.MirrorBucketPathPrefix,
+			SampleRate: cfg.MirrorSampleRate,
+			Timeout:    cfg.MirrorTimeout,
+			Log:        log,
+			inFlight:   make(chan struct{}, max(cfg.MirrorMaxInFlight, 1)),
+		}
+	}
+	return p
+}
+
+// splitBucketKey splits a full path "/bucket/key..." into its bucket and key. Full paths
+// are built from the decoded, cleaned request path, so the key is not unescaped again:
+// "%252e%252e" must stay the literal key "%2e%2e" rather than become "..".
+func splitBucketKey(full string) (string, string, bool) {
 	path := strings.TrimPrefix(full, "/")
 	idx := strings.IndexByte(path, '/')
 	if idx <= 0 || idx >= len(path)-1 {
-		http.Error(w, "bad request", http.StatusBadRequest)
+		return "", "", false
+	}
+	return path[:idx], path[idx+1:], true
+}
+
+// Target is the object a route rule resolved a request to.
+type Target struct {
+	// Full is the full bucket path ("/bucket/key") of the object.
+	Full string
+	// BucketPath is the bucket path serving the request: the rule's, its live release's
+	// or its canary's. The SPA fallback is resolved against it.
+	BucketPath string
+	// Resolved, when set, maps the full bucket path of the SPA fallback before it is
+	// read, as it mapped Full.
+	Resolved func(full string) string
+}
+
+// ProxyS3 resolves bucket/key from t's full path "/bucket/..." and streams from S3/MinIO.
+// rule is the route rule that matched the request.
+func (p *Proxy) ProxyS3(w http.ResponseWriter, r *http.Request, rule config.RouteRule, t Target) {
+	if p.Config.ListingEnabled && r.URL.Query().Has("list") {
+		p.serveListing(w, r, t.Full)
 		return
 	}
-	bucket := path[:idx]
-	key := path[idx+1:]
-	if ukey, err := url.PathUnescape(key); err == nil {
-		key = ukey
+	p.sendEarlyHints(r.Context(), w, r, rule)
+	p.setCacheTags(w.Header(), rule, r.URL.Path)
+	p.serveObject(w, r, rule, t, t.Full, false)
+}
+
+// serveObject serves full for t; fallback is set when full is the SPA entrypoint standing in for a missing key.
+func (p *Proxy) serveObject(w http.ResponseWriter, r *http.Request, rule config.RouteRule, t Target, full string, fallback bool) {
+	s3c, cfg := p.Client, p.Config
+	// Directory requests are served their index document, like nginx's index directive
+	if cfg.DirectoryIndex != "" && strings.HasSuffix(full, "/") {
+		full += cfg.DirectoryIndex
+	}
+	bucket, key, ok := splitBucketKey(full)
+	if !ok {
+		p.Error(w, r, http.StatusBadRequest)
+		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), cfg.ProxiedRequestTimeout)
+	timeout := rule.RequestTimeout(cfg.ProxiedRequestTimeout)
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
 	defer cancel()
 
-	// Honor basic conditional and range headers
-	in := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
-	if v := r.Header.Get("Range"); v != "" {
-		in.Range = aws.String(v)
+	if cfg.PreviewBucketPathPrefix != "" && underPrefix(full, cfg.BucketPathPrefix) {
+		vary.Add(w.Header(), cfg.PreviewHeader)
+		if cfg.PreviewCookie != "" {
+			vary.Add(w.Header(), "Cookie")
+		}
 	}
-	if v := r.Header.Get("If-None-Match"); v != "" {
-		in.IfNoneMatch = aws.String(v)
+
+	// Preview requests try the parallel preview prefix first and fall back to stable when missing.
+	// VERSION_MAP pins, ?versionId and the mirror all describe the stable objects, so preview
+	// reads skip them: a version ID of the stable key means nothing for the preview key.
+	if previewFull, ok := PreviewPath(p.Config, r, full); ok {
+		if pbucket, pkey, ok := splitBucketKey(previewFull); ok {
+			obj, err := p.getObject(ctx, r, pbucket, pkey, "")
+			p.exposeUpstreamIDs(w, r, err)
+			if err == nil {
+				p.writeObject(w, r, rule, pkey, obj, fallback)
+				return
+			}
+			if status := s3ErrorToStatus(err); status != http.StatusNotFound && status != http.StatusForbidden {
+				p.Error(w, r, status)
+				return
+			}
+			if base := s3c.Options().Logger; base != nil {
+				logging.WithContext(ctx, base).Logf(logging.Debug, "s3 proxy preview object missing, falling back to stable bucket=%s key=%s", pbucket, pkey)
+			}
+		}
 	}
-	if v := r.Header.Get("If-Match"); v != "" {
-		in.IfMatch = aws.String(v)
+
+	var versionID string
+	if rule.VersionMap != "" {
+		versionID = p.versionFor(ctx, rule.VersionMap, key)
 	}
-	if v := r.Header.Get("If-Modified-Since"); v != "" {
-		if t, err := http.ParseTime(v); err == nil {
-			in.IfModifiedSince = aws.Time(t)
+	if !fallback {
+		requested, ok := p.requestedVersion(w, r)
+		if !ok {
+			return
 		}
-	}
-	if v := r.Header.Get("If-Unmodified-Since"); v != "" {
-		if t, err := http.ParseTime(v); err == nil {
-			in.IfUnmodifiedSince = aws.Time(t)
+		if requested != "" {
+			versionID = requested
 		}
 	}
+	if p.presignRedirect(ctx, w, r, rule, bucket, key, versionID) {
+		return
+	}
+	obj, err := p.getObject(ctx, r, bucket, key, versionID)
+	p.exposeUpstreamIDs(w, r, err)
 
-	obj, err := s3c.GetObject(ctx, in, func(o *s3.Options) {
-		o.Logger = logging.WithContext(r.Context(), logger.ContextAwareLogger{Base: log})
-		o.ClientLogMode = cfg.ClientLogMode
-	})
+	if p.Mirror != nil {
+		if err != nil {
+			p.Mirror.Observe(r, full, s3ErrorToStatus(err), nil, nil)
+		} else {
+			p.Mirror.Observe(r, full, http.StatusOK, obj.ETag, obj.ContentLength)
+		}
+	}
 
 	if err != nil {
 		if errors.Is(err, context.DeadlineExceeded) || ctx.Err() == context.DeadlineExceeded {
 			if base := s3c.Options().Logger; base != nil {
-				logging.WithContext(ctx, base).Logf(logging.Debug, "s3 proxy request timeout bucket=%s key=%s after %v", bucket, key, cfg.ProxiedRequestTimeout)
+				logging.WithContext(ctx, base).Logf(logging.Debug, "s3 proxy request timeout bucket=%s key=%s after %v", bucket, key, timeout)
 			}
 		}
 
+		if errors.Is(r.Context().Err(), context.Canceled) {
+			metrics.AbortedTransfersTotal.WithLabelValues("client_cancel").Inc()
+		}
+
 		// Map common S3 errors to HTTP status
 		status := s3ErrorToStatus(err)
-		// Optional SPA fallback: on 403/404, serve SPA entry if configured
-		// Ensure we only attempt the fallback once by checking current path against SPA path
+		if status >= http.StatusInternalServerError {
+			requestID, hostID := upstreamIDs(nil, err)
+			p.Log.WithFields(logger.Fields{"process": "proxy", "bucket": bucket, "key": key, "s3_request_id": requestID, "s3_host_id": hostID}).Errorf("s3 request failed: %v", err)
+		}
+		// Navigations get a directory index or the SPA entrypoint instead of the error
 		if status == http.StatusNotFound || status == http.StatusForbidden {
-			if spa := cfg.SPAEntrypointPath; spa != "" {
-				spaPath := JoinPath(cfg.BucketPathPrefix, spa)
+			vary.Add(w.Header(), "Accept")
+		}
+		// A navigation to an extensionless path such as an app root may name a directory
+		if (status == http.StatusNotFound || status == http.StatusForbidden) && isNavigation(r) && !fallback &&
+			cfg.DirectoryIndex != "" && path.Ext(key) == "" {
+			p.serveObject(w, r, rule, t, full+"/", false)
+			return
+		}
+		// Optional SPA fallback: on 403/404, serve SPA entry if configured and the request is a page navigation
+		// Ensure we only attempt the fallback once by checking current path against SPA path
+		if (status == http.StatusNotFound || status == http.StatusForbidden) && isNavigation(r) && !fallback {
+			if spaPath := SPAFallbackPath(cfg, t.BucketPath, r.URL.Path); spaPath != "" {
+				if t.Resolved != nil {
+					spaPath = t.Resolved(spaPath)
+				}
 				if full != spaPath { // guard against recursive fallback
 					if base := s3c.Options().Logger; base != nil {
 						logging.WithContext(ctx, base).Logf(logging.Debug, "s3 proxy request fallback to SPA entrypoint")
 					}
-					ProxyS3(w, r, s3c, cfg, spaPath, log)
+					p.serveObject(w, r, rule, t, spaPath, true)
 					return
 				}
 			}
 		}
-		http.Error(w, http.StatusText(status), status)
+		p.Error(w, r, status)
 		return
 	}
 
+	p.writeObject(w, r, rule, key, obj, fallback)
+}
+
+// strongETags strips the W/ prefix from the entity tags of an If-None-Match list. The
+// header uses weak comparison, so W/"x" matches the object's "x"; object storage
+// compares strongly and would never match the weak ETags served for rewritten bodies.
+func strongETags(v string) string {
+	if !strings.Contains(v, "W/") {
+		return v
+	}
+	tags := strings.Split(v, ",")
+	for i, tag := range tags {
+		tags[i] = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	}
+	return strings.Join(tags, ", ")
+}
+
+// getObject issues a GetObject for bucket/key (pinned to versionID when non-empty),
+// honoring the request's conditional and range headers.
+func (p *Proxy) getObject(ctx context.Context, r *http.Request, bucket, key, versionID string) (*s3.GetObjectOutput, error) {
+	// Honor basic conditional and range headers
+	in := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	if versionID != "" {
+		in.VersionId = aws.String(versionID)
+	}
+	if v := r.Header.Get("Range"); v != "" {
+		in.Range = aws.String(v)
+	}
+	if v := r.Header.Get("If-None-Match"); v != "" {
+		in.IfNoneMatch = aws.String(strongETags(v))
+	}
+	if v := r.Header.Get("If-Match"); v != "" {
+		in.IfMatch = aws.String(v)
+	}
+	if v := r.Header.Get("If-Modified-Since"); v != "" {
+		if t, err := http.ParseTime(v); err == nil {
+			in.IfModifiedSince = aws.Time(t)
+		}
+	}
+	if v := r.Header.Get("If-Unmodified-Since"); v != "" {
+		if t, err := http.ParseTime(v); err == nil {
+			in.IfUnmodifiedSince = aws.Time(t)
+		}
+	}
+
+	stats := statsFrom(r.Context())
+	if stats != nil {
+		stats.Bucket, stats.Key = bucket, key
+		stats.RequestID, stats.HostID = "", ""
+		stats.CacheStored = time.Time{}
+	}
+	// The access log tells cache hits apart from upstream fetches
+	cacheable := p.cacheable(r, in)
+	cacheStatus := "bypass"
+	if cacheable {
+		if obj, stored, ok := p.cachedGet(in); ok {
+			fromCache := int64(0)
+			if r.Method == http.MethodGet {
+				fromCache = objectSize(obj)
+			}
+			var upstream time.Duration
+			if stats != nil {
+				upstream = stats.Upstream
+				stats.CacheStored = stored
+			}
+			logger.AddFields(r, logger.Fields{"cache_status": "hit", "bytes_from_cache": fromCache, "upstream_ms": upstream.Milliseconds()})
+			return obj, nil
+		}
+		cacheStatus = "miss"
+	}
+
+	upstreamStart := time.Now()
+	obj, err := p.hedgedGetObject(ctx, in, func(o *s3.Options) {
+		o.Logger = logging.WithContext(r.Context(), logger.ContextAwareLogger{Base: logger.For(r.Context(), p.Log)})
+		o.ClientLogMode = p.Config.ClientLogMode
+		if logger.Debug(r.Context()) {
+			o.ClientLogMode |= aws.LogRequest | aws.LogResponse | aws.LogRetries
+		}
+	})
+	requestID, hostID := upstreamIDs(obj, err)
+	upstream := time.Since(upstreamStart)
+	if stats != nil {
+		stats.Upstream += upstream
+		stats.Err = err
+		stats.RequestID, stats.HostID = requestID, hostID
+		upstream = stats.Upstream
+	}
+	logger.AddFields(r, logger.Fields{"cache_status": cacheStatus, "bytes_from_cache": int64(0), "upstream_ms": upstream.Milliseconds()})
+	if requestID != "" {
+		logger.AddFields(r, logger.Fields{"s3_request_id": requestID})
+	}
+	if hostID != "" {
+		logger.AddFields(r, logger.Fields{"s3_host_id": hostID})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.Config.S3ChecksumValidation {
+		obj.Body = checksumBody{obj.Body}
+	}
+	if cacheable && r.Method == http.MethodGet {
+		if err := p.storeObject(in, obj); err != nil {
+			return nil, err
+		}
+	}
+	if p.useParallelFetch(r, obj) {
+		obj.Body = p.parallelBody(ctx, bucket, key, obj)
+	}
+	return obj, nil
+}
+
+// PreviewPath maps full onto the preview prefix when the request opted into preview
+// via the configured header or cookie. Paths outside BucketPathPrefix have no preview.
+func PreviewPath(cfg config.FrontendAssetProxyConfig, r *http.Request, full string) (string, bool) {
+	if cfg.PreviewBucketPathPrefix == "" || !underPrefix(full, cfg.BucketPathPrefix) {
+		return "", false
+	}
+	enabled := strings.EqualFold(r.Header.Get(cfg.PreviewHeader), "true")
+	if !enabled && cfg.PreviewCookie != "" {
+		if c, err := r.Cookie(cfg.PreviewCookie); err == nil {
+			enabled = strings.EqualFold(c.Value, "true")
+		}
+	}
+	if !enabled {
+		return "", false
+	}
+	return JoinPath(cfg.PreviewBucketPathPrefix, strings.TrimPrefix(full, cfg.BucketPathPrefix)), true
+}
+
+// underPrefix reports whether the bucket path full is prefix or below it, on a path
+// segment boundary: "/frontend-assets-other" is not under "/frontend-assets".
+func underPrefix(full, prefix string) bool {
+	return full == prefix || strings.HasPrefix(full, strings.TrimSuffix(prefix, "/")+"/")
+}
+
+// SPAFallbackPath returns the full bucket path of the SPA entrypoint for a request to
+// reqPath served from bucketPath, or "" when there is none. The entry of the longest
+// matching SPA_ENTRYPOINTS prefix is relative to bucketPath, so it follows the rule's
+// bucket, live release and canary. SPA_ENTRYPOINT_PATH is the shared shell under
+// BUCKET_PATH_PREFIX, except for bucket paths outside it, which have their own.
+func SPAFallbackPath(cfg config.FrontendAssetProxyConfig, bucketPath, reqPath string) string {
+	spa, best := "", -1
+	for prefix, entry := range cfg.SPAEntrypoints {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if (reqPath == prefix || strings.HasPrefix(reqPath, prefix+"/")) && len(prefix) > best {
+			spa, best = entry, len(prefix)
+		}
+	}
+	switch {
+	case best >= 0:
+		if spa == "" {
+			return ""
+		}
+		return JoinPath(bucketPath, spa)
+	case cfg.SPAEntrypointPath == "":
+		return ""
+	case underPrefix(bucketPath, cfg.BucketPathPrefix):
+		return JoinPath(cfg.BucketPathPrefix, cfg.SPAEntrypointPath)
+	}
+	return JoinPath(bucketPath, cfg.SPAEntrypointPath)
+}
+
+// isNavigation reports whether r looks like a browser page navigation rather than an asset fetch:
+// it must accept text/html and must not name a file with a non-HTML extension. Missing assets
+// such as chunk.js get a genuine 404 instead of index.html.
+func isNavigation(r *http.Request) bool {
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		return false
+	}
+	ext := path.Ext(r.URL.Path)
+	return ext == "" || ext == ".html" || ext == ".htm"
+}
+
+// writeObject copies object metadata to response headers and streams the body for GET requests.
+// SPA fallback responses get the configured fallback status and forced cache headers so they are
+// never cached under the missing asset's URL.
+func (p *Proxy) writeObject(w http.ResponseWriter, r *http.Request, rule config.RouteRule, key string, obj *s3.GetObjectOutput, fallback bool) {
 	defer obj.Body.Close()
 
-	w.Header().Set("Vary", "Accept-Encoding")
-	setHeaderFromStringPtr(w, "Content-Type", obj.ContentType)
-	setHeaderFromStringPtr(w, "ETag", obj.ETag)
-	setHeaderFromStringPtr(w, "Cache-Control", obj.CacheControl)
-	setHeaderFromStringPtr(w, "Content-Encoding", obj.ContentEncoding)
-	setHeaderFromStringPtr(w, "Content-Disposition", obj.ContentDisposition)
-	setHeaderFromStringPtr(w, "Content-Language", obj.ContentLanguage)
-	setHeaderFromStringPtr(w, "Expires", obj.ExpiresString)
-	setHeaderFromStringPtr(w, "Accept-Ranges", obj.AcceptRanges)
+	if limit := p.Config.MaxObjectSize; limit > 0 && objectSize(obj) > limit {
+		p.Log.WithFields(logger.Fields{"process": "proxy", "key": key, "size": objectSize(obj)}).Errorf("object exceeds maximum servable size of %d bytes", limit)
+		p.Error(w, r, http.StatusBadGateway)
+		return
+	}
+
+	var body io.Reader = obj.Body
+	if v := p.ManifestValidator; v != nil && r.Method != http.MethodHead && v.Matches(key) {
+		buf, err := io.ReadAll(io.LimitReader(obj.Body, maxValidatedManifestSize+1))
+		if err != nil {
+			// Nothing was written yet, so fail rather than serve a partial manifest
+			p.Log.WithFields(logger.Fields{"process": "manifest", "key": key}).Errorf("reading manifest: %v", err)
+			p.Error(w, r, http.StatusBadGateway)
+			return
+		}
+		if len(buf) > maxValidatedManifestSize {
+			err = errors.New("manifest too large to validate")
+		} else {
+			err = v.Validate(buf)
+		}
+		if err != nil {
+			p.Log.WithFields(logger.Fields{"process": "manifest", "key": key}).Errorf("invalid manifest: %v", err)
+			if v.Action == manifest.ActionReject {
+				p.Error(w, r, http.StatusBadGateway)
+				return
+			}
+			w.Header().Set("X-Manifest-Validation", "invalid")
+		}
+		// An oversized manifest was only partly buffered; the rest still streams from S3
+		body = io.MultiReader(bytes.NewReader(buf), obj.Body)
+	}
+
+	contentLength, etag := obj.ContentLength, obj.ETag
+	rewrite := p.bodyRewriter(rule, key, obj)
+	rewritten := rewrite != nil
+	if rewritten {
+		// The body differs from the stored object, so only a weak validator still holds
+		if etag != nil && !strings.HasPrefix(*etag, "W/") {
+			etag = aws.String("W/" + *etag)
+		}
+		if r.Method == http.MethodHead {
+			contentLength = nil
+		} else {
+			buf, err := io.ReadAll(body)
+			if err != nil {
+				p.Error(w, r, http.StatusBadGateway)
+				return
+			}
+			html := rewrite(string(buf))
+			body = strings.NewReader(html)
+			contentLength = aws.Int64(int64(len(html)))
+		}
+	}
+
+	if len(rule.Links) > 0 && isHTMLObject(obj) {
+		for _, l := range rule.Links {
+			w.Header().Add("Link", l.String())
+		}
+	}
+	p.copyUpstreamHeaders(w.Header(), rule, obj, etag, rewritten)
 
-	if obj.ContentLength != nil {
-		w.Header().Set("Content-Length", strconv.FormatInt(*obj.ContentLength, 10))
+	if contentLength != nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(*contentLength, 10))
 	}
 	if obj.LastModified != nil {
 		w.Header().Set("Last-Modified", obj.LastModified.UTC().Format(http.TimeFormat))
 	}
+	var stored time.Time
+	if stats := statsFrom(r.Context()); stats != nil {
+		stored = stats.CacheStored
+	}
+	setAge(w.Header(), stored)
+	status := http.StatusOK
+	switch {
+	case fallback:
+		w.Header().Set("Cache-Control", p.Config.SPAFallbackCacheControl)
+		w.Header().Del("Expires")
+		status = p.Config.SPAFallbackStatus
+	case rule.Immutable:
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	if !fallback {
+		p.setSurrogateControl(w.Header(), rule)
+	}
+
+	var doc *bytes.Buffer
+	if p.shouldPrefetch(r, obj) {
+		doc = &bytes.Buffer{}
+		body = io.TeeReader(body, doc)
+	}
 
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 	if r.Method != http.MethodHead {
-		_, _ = io.Copy(w, obj.Body)
+		flushed, stop := newFlushWriter(w, p.Config.FlushInterval)
+		defer stop()
+		dst := throttle.NewWriter(r.Context(), flushed, throttle.NewLimiter(p.Config.BandwidthPerResponse), p.egress)
+		// The S3 request context derives from the client's, so a disconnect cancels the
+		// body read and copyBody returns early instead of draining the object.
+		metrics.StreamingResponses.Inc()
+		n, err := copyBody(dst, body)
+		metrics.StreamingResponses.Dec()
+		if errors.Is(err, errChecksumMismatch) {
+			metrics.AbortedTransfersTotal.WithLabelValues("checksum").Inc()
+			p.Log.WithFields(logger.Fields{"process": "proxy", "key": key, "bytes": n, "reason": "checksum"}).Errorf("transfer aborted: %v", err)
+		} else if err != nil {
+			reason := "upstream"
+			if r.Context().Err() != nil {
+				reason = "client_disconnect"
+			}
+			metrics.AbortedTransfersTotal.WithLabelValues(reason).Inc()
+			p.Log.WithFields(logger.Fields{"process": "proxy", "key": key, "bytes": n, "reason": reason}).Debugf("transfer aborted: %v", err)
+		} else if doc != nil {
+			p.prefetchReferenced(r, key, obj.ETag, doc.String())
+		}
 	}
 }
 
@@ -152,7 +639,8 @@ func s3ErrorToStatus(err error) int {
 	}
 
 	var respErr *smithyhttp.ResponseError
-	if errors.As(err, &respErr) && respErr != nil && respErr.Response != nil {
+	// Transport failures (e.g. DNS) carry no response status and fall through to 502
+	if errors.As(err, &respErr) && respErr != nil && respErr.Response != nil && respErr.Response.Response != nil && respErr.Response.StatusCode >= 100 {
 		return respErr.Response.StatusCode
 	}
 
@@ -197,9 +685,16 @@ func JoinPath(a, b string) string {
 	return a + b
 }
 
-// setHeaderFromStringPtr sets a response header if the provided value is non-nil.
-func setHeaderFromStringPtr(w http.ResponseWriter, key string, val *string) {
-	if val != nil {
-		w.Header().Set(key, *val)
+// objectSize returns the full size of the stored object, which for range responses is the
+// total from Content-Range ("bytes 0-99/1234") rather than the partial Content-Length.
+func objectSize(obj *s3.GetObjectOutput) int64 {
+	if cr := aws.ToString(obj.ContentRange); cr != "" {
+		if _, total, ok := strings.Cut(cr, "/"); ok {
+			if n, err := strconv.ParseInt(total, 10, 64); err == nil {
+				return n
+			}
+		}
 	}
+	return aws.ToInt64(obj.ContentLength)
 }
+
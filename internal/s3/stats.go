@@ -0,0 +1,105 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type statsKey struct{}
+
+// Stats collects the upstream side of a proxied request for logging.
+type Stats struct {
+	// Bucket and Key identify the object last requested from the bucket.
+	Bucket string
+	Key    string
+	// Upstream is the time spent waiting for GetObject responses.
+	Upstream time.Duration
+	// Err is the error of the last GetObject call, if it failed.
+	Err error
+	// RequestID and HostID are the request ID and extended request ID (x-amz-id-2) object
+	// storage assigned to the last GetObject call, when it reached object storage.
+	RequestID string
+	HostID    string
+	// CacheStored is when the object last served from the object cache was stored there;
+	// it is zero when the object came from object storage.
+	CacheStored time.Time
+}
+
+// Response headers carrying the object storage request IDs.
+const (
+	UpstreamRequestIDHeader = "X-Upstream-Request-Id"
+	UpstreamHostIDHeader    = "X-Upstream-Extended-Request-Id"
+)
+
+// WithStats returns r with an empty Stats attached that ProxyS3 fills in.
+func WithStats(r *http.Request) (*http.Request, *Stats) {
+	stats := &Stats{}
+	return r.WithContext(context.WithValue(r.Context(), statsKey{}, stats)), stats
+}
+
+func statsFrom(ctx context.Context) *Stats {
+	stats, _ := ctx.Value(statsKey{}).(*Stats)
+	return stats
+}
+
+// upstreamIDs returns the request IDs of a GetObject call from its result or error.
+func upstreamIDs(obj *s3.GetObjectOutput, err error) (requestID, hostID string) {
+	if err != nil {
+		var reqErr interface{ ServiceRequestID() string }
+		if errors.As(err, &reqErr) {
+			requestID = reqErr.ServiceRequestID()
+		}
+		var hostErr interface{ ServiceHostID() string }
+		if errors.As(err, &hostErr) {
+			hostID = hostErr.ServiceHostID()
+		}
+		return requestID, hostID
+	}
+	requestID, _ = awsmiddleware.GetRequestIDMetadata(obj.ResultMetadata)
+	hostID, _ = s3.GetHostIDMetadata(obj.ResultMetadata)
+	return requestID, hostID
+}
+
+// exposeUpstreamIDs adds the request IDs of the last GetObject call, which returned err,
+// to the response of a request that asked for debug logging, or of a failed request when
+// EXPOSE_UPSTREAM_REQUEST_ID is set, so support can quote them to MinIO or AWS.
+func (p *Proxy) exposeUpstreamIDs(w http.ResponseWriter, r *http.Request, err error) {
+	stats := statsFrom(r.Context())
+	if stats == nil || !logger.Debug(r.Context()) && (err == nil || !p.Config.ExposeUpstreamRequestID) {
+		return
+	}
+	if stats.RequestID != "" {
+		w.Header().Set(UpstreamRequestIDHeader, stats.RequestID)
+	}
+	if stats.HostID != "" {
+		w.Header().Set(UpstreamHostIDHeader, stats.HostID)
+	}
+}
+
+// LogSlow logs a warning for a request that took longer than SLOW_REQUEST_THRESHOLD, so
+// pathological assets can be found without enabling debug logging.
+func (p *Proxy) LogSlow(r *http.Request, stats *Stats, status, bytes int, elapsed time.Duration) {
+	if p.slowLog == nil || elapsed < p.Config.SlowRequestThreshold {
+		return
+	}
+	p.slowLog.WithFields(logger.TraceFields(r.Context())).WithFields(logger.Fields{
+		"process":       "slowrequest",
+		"request_id":    middleware.GetReqID(r.Context()),
+		"method":        r.Method,
+		"path":          r.URL.Path,
+		"bucket":        stats.Bucket,
+		"key":           stats.Key,
+		"status":        status,
+		"bytes":         bytes,
+		"duration_ms":   elapsed.Milliseconds(),
+		"upstream_ms":   stats.Upstream.Milliseconds(),
+		"s3_request_id": stats.RequestID,
+	}).Warnf("slow request")
+}
@@ -0,0 +1,58 @@
+package s3
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+)
+
+// setCacheTags tags the response to a request for reqPath in each CACHE_TAG_HEADERS
+// header, so the CDN can purge everything of an app after its deploy: with the name of
+// the app (the path segment following one of CACHE_TAG_PREFIXES, e.g. "chrome" for
+// /apps/chrome/js/app.js) and the rule's own tags. Error responses are tagged too, so
+// a 404 cached before a deploy is purged with the rest of the app.
+func (p *Proxy) setCacheTags(h http.Header, rule config.RouteRule, reqPath string) {
+	if len(p.Config.CacheTagHeaders) == 0 {
+		return
+	}
+	tags := append([]string(nil), rule.CacheTags...)
+	if app := pathApp(reqPath, p.Config.CacheTagPrefixes); app != "" {
+		tags = append(tags, app)
+	}
+	if len(tags) == 0 {
+		return
+	}
+	for _, name := range p.Config.CacheTagHeaders {
+		// Fastly separates surrogate keys with spaces, Akamai and Cloudflare use commas
+		sep := ","
+		if strings.EqualFold(name, "Surrogate-Key") {
+			sep = " "
+		}
+		h.Set(name, strings.Join(tags, sep))
+	}
+}
+
+// pathApp returns the path segment of reqPath following one of prefixes, if any.
+func pathApp(reqPath string, prefixes []string) string {
+	for _, prefix := range prefixes {
+		if rest, ok := strings.CutPrefix(reqPath, strings.TrimSuffix(prefix, "/")+"/"); ok {
+			app, _, _ := strings.Cut(rest, "/")
+			return app
+		}
+	}
+	return ""
+}
+
+// setSurrogateControl sets the Surrogate-Control header of the rule or SURROGATE_CONTROL,
+// which CDNs honor instead of Cache-Control and strip before responding, so edge caching
+// can differ from browser caching.
+func (p *Proxy) setSurrogateControl(h http.Header, rule config.RouteRule) {
+	v := rule.SurrogateControl
+	if v == "" {
+		v = p.Config.SurrogateControl
+	}
+	if v != "" {
+		h.Set("Surrogate-Control", v)
+	}
+}
@@ -0,0 +1,154 @@
+package s3
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/dnscache"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/metrics"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/tracecontext"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// newHTTPClient builds the S3 client's HTTP client. The SDK defaults keep only a handful
+// of idle connections per host, far below what a busy replica needs, which shows up as
+// connection churn against MinIO.
+func newHTTPClient(cfg config.FrontendAssetProxyConfig, log logger.Logger) *awshttp.BuildableClient {
+	proxy := http.ProxyFromEnvironment
+	if cfg.OutboundProxyURL != "" {
+		if u, err := url.Parse(cfg.OutboundProxyURL); err == nil && u.Scheme != "" && u.Host != "" {
+			proxy = fixedProxy(u)
+		} else {
+			log.Errorf("ignoring invalid OUTBOUND_PROXY_URL %q", cfg.OutboundProxyURL)
+		}
+	}
+	var resolver *dnscache.Resolver
+	if cfg.S3DNSCacheTTL > 0 {
+		resolver = &dnscache.Resolver{
+			TTL:         cfg.S3DNSCacheTTL,
+			NegativeTTL: cfg.S3DNSNegativeTTL,
+			Dialer:      &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		}
+	}
+	return awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		tr.Proxy = proxy
+		if socket, ok := unixSocket(cfg.UpstreamURL); ok {
+			// Every request goes to the colocated sidecar regardless of the endpoint host
+			dialer := &net.Dialer{Timeout: 30 * time.Second}
+			tr.Proxy = nil
+			tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", socket)
+			}
+		} else if resolver != nil {
+			// Some clusters' DNS adds milliseconds per lookup and occasionally fails
+			tr.DialContext = resolver.DialContext
+		}
+		tr.DialContext = countConns(tr.DialContext)
+		tr.MaxIdleConns = cfg.S3MaxIdleConns
+		tr.MaxIdleConnsPerHost = cfg.S3MaxIdleConnsPerHost
+		tr.IdleConnTimeout = cfg.S3IdleConnTimeout
+		tr.TLSHandshakeTimeout = cfg.S3TLSHandshakeTimeout
+		tr.ExpectContinueTimeout = cfg.S3ExpectContinueTimeout
+	})
+}
+
+// countConns wraps dial to track the connections it opens in metrics.UpstreamConnections.
+func countConns(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		metrics.UpstreamConnections.Inc()
+		return &countedConn{Conn: c}, nil
+	}
+}
+
+type countedConn struct {
+	net.Conn
+	closed sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.closed.Do(metrics.UpstreamConnections.Dec)
+	return c.Conn.Close()
+}
+
+// fixedProxy routes every request through u except those to hosts listed in NO_PROXY,
+// so an explicit proxy keeps the same exclusions as one taken from the environment.
+func fixedProxy(u *url.URL) func(*http.Request) (*url.URL, error) {
+	noProxy := os.Getenv("NO_PROXY")
+	if noProxy == "" {
+		noProxy = os.Getenv("no_proxy")
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(req.URL.Hostname(), noProxy) {
+			return nil, nil
+		}
+		return u, nil
+	}
+}
+
+// bypassProxy reports whether host matches a NO_PROXY entry: "*", an exact host, or a
+// domain whose subdomains are also excluded.
+func bypassProxy(host, noProxy string) bool {
+	host = strings.ToLower(host)
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		if entry == "*" {
+			return true
+		}
+		entry = strings.TrimPrefix(entry, "*")
+		switch {
+		case entry == "":
+		case strings.HasPrefix(entry, "."):
+			if strings.HasSuffix(host, entry) || host == entry[1:] {
+				return true
+			}
+		case host == entry || strings.HasSuffix(host, "."+entry):
+			return true
+		}
+	}
+	return false
+}
+
+// unixSocket returns the socket path of a unix:///path/to/socket upstream.
+func unixSocket(upstream string) (string, bool) {
+	u, err := url.Parse(upstream)
+	if err != nil || u.Scheme != "unix" || u.Path == "" {
+		return "", false
+	}
+	return u.Path, true
+}
+
+// propagateTraceContext forwards the request's W3C trace context to object storage with
+// the proxy's span as parent, so MinIO traces join the caller's.
+func propagateTraceContext(stack *middleware.Stack) error {
+	return stack.Build.Add(middleware.BuildMiddlewareFunc("PropagateTraceContext", func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+		if tc, ok := tracecontext.FromContext(ctx); ok {
+			if req, ok := in.Request.(*smithyhttp.Request); ok {
+				req.Header.Set(tracecontext.ParentHeader, tc.Traceparent())
+				if tc.State != "" {
+					req.Header.Set(tracecontext.StateHeader, tc.State)
+				}
+			}
+		}
+		return next.HandleBuild(ctx, in)
+	}), middleware.After)
+}
@@ -0,0 +1,89 @@
+package s3
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// versionMaps caches release maps (S3 key -> VersionId) loaded from JSON objects in the bucket.
+// Rolling a release back means publishing a new map; bucket contents stay untouched.
+type versionMaps struct {
+	mu      sync.Mutex
+	entries map[string]*versionMap
+}
+
+type versionMap struct {
+	versions map[string]string
+	expires  time.Time
+}
+
+// requestedVersion returns the VersionId named by the request's versionId query parameter
+// when VERSION_QUERY_ENABLED is set, or "" to serve the current version. Without the
+// configured token it answers 403 and reports false.
+func (p *Proxy) requestedVersion(w http.ResponseWriter, r *http.Request) (string, bool) {
+	versionID := r.URL.Query().Get("versionId")
+	if versionID == "" || !p.Config.VersionQueryEnabled {
+		return "", true
+	}
+	if token := p.Config.VersionQueryToken; token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get(p.Config.VersionQueryHeader)), []byte(token)) != 1 {
+		p.Error(w, r, http.StatusForbidden)
+		return "", false
+	}
+	logger.AddFields(r, logger.Fields{"version_id": versionID})
+	return versionID, true
+}
+
+// versionFor returns the pinned VersionId for key according to the map stored at mapPath,
+// or "" when the key is not pinned. A stale map is kept if a refresh fails.
+func (p *Proxy) versionFor(ctx context.Context, mapPath, key string) string {
+	vm := &p.versionMaps
+	vm.mu.Lock()
+	entry := vm.entries[mapPath]
+	vm.mu.Unlock()
+	if entry != nil && time.Now().Before(entry.expires) {
+		return entry.versions[key]
+	}
+
+	// Load outside the lock so a slow bucket does not stall unrelated requests
+	versions, err := p.loadVersionMap(ctx, mapPath)
+	if err != nil {
+		p.Log.WithFields(logger.Fields{"process": "versionmap", "path": mapPath}).Errorf("failed to load version map: %v", err)
+		if entry == nil {
+			return ""
+		}
+		versions = entry.versions
+	}
+
+	vm.mu.Lock()
+	if vm.entries == nil {
+		vm.entries = map[string]*versionMap{}
+	}
+	vm.entries[mapPath] = &versionMap{versions: versions, expires: time.Now().Add(p.Config.VersionMapTTL)}
+	vm.mu.Unlock()
+	return versions[key]
+}
+
+func (p *Proxy) loadVersionMap(ctx context.Context, mapPath string) (map[string]string, error) {
+	bucket, key, ok := splitBucketKey(mapPath)
+	if !ok {
+		return nil, errInvalidPath
+	}
+	obj, err := p.Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Body.Close()
+	var versions map[string]string
+	if err := json.NewDecoder(obj.Body).Decode(&versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
@@ -0,0 +1,131 @@
+package shed
+
+import (
+	"net/http"
+	"os"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	pmetrics "github.com/RedHatInsights/frontend-asset-proxy/internal/metrics"
+)
+
+// cgroupLimitFiles hold the container memory limit for cgroup v2 and v1 respectively.
+var cgroupLimitFiles = []string{
+	"/sys/fs/cgroup/memory.max",
+	"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+}
+
+// Memory sheds requests while the Go runtime's memory use is above a fraction of the
+// memory limit, so large responses cannot push the pod into an OOM kill.
+type Memory struct {
+	limit     uint64
+	threshold float64
+	pressure  atomic.Bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewMemory samples memory use every interval and reports pressure once it exceeds
+// threshold (0-1) of limit bytes. A zero limit uses the container's cgroup limit, falling
+// back to GOMEMLIMIT; ok is false when no limit can be determined. Close stops sampling.
+func NewMemory(limit uint64, threshold float64, interval time.Duration) (m *Memory, ok bool) {
+	if limit == 0 {
+		limit = DetectMemoryLimit()
+	}
+	if limit == 0 {
+		return nil, false
+	}
+	m = &Memory{limit: limit, threshold: threshold, stop: make(chan struct{}), done: make(chan struct{})}
+	m.sample()
+	go m.run(interval)
+	return m, true
+}
+
+// Close stops sampling memory use; the last sample's pressure keeps being reported.
+func (m *Memory) Close() {
+	close(m.stop)
+	<-m.done
+}
+
+func (m *Memory) run(interval time.Duration) {
+	defer close(m.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.sample()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// Limit returns the memory limit in bytes pressure is measured against.
+func (m *Memory) Limit() uint64 {
+	return m.limit
+}
+
+// UnderPressure reports whether memory use was above the threshold at the last sample.
+// Callers can use it to skip optional memory use, such as caching a response.
+func (m *Memory) UnderPressure() bool {
+	return m.pressure.Load()
+}
+
+// Middleware sheds requests with 503 while under memory pressure.
+func (m *Memory) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.UnderPressure() {
+			reject(w, "memory")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (m *Memory) sample() {
+	used := memoryInUse()
+	under := float64(used) > m.threshold*float64(m.limit)
+	m.pressure.Store(under)
+	pmetrics.MemoryInUse.Set(float64(used))
+	if under {
+		pmetrics.MemoryPressure.Set(1)
+	} else {
+		pmetrics.MemoryPressure.Set(0)
+	}
+}
+
+// memoryInUse returns the memory mapped by the Go runtime that has not been returned to
+// the OS, which tracks the process RSS closely for this proxy.
+func memoryInUse() uint64 {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
+
+// DetectMemoryLimit returns the cgroup memory limit of the container, or GOMEMLIMIT when
+// the process is not limited by a cgroup. It returns 0 when neither is set.
+func DetectMemoryLimit() uint64 {
+	for _, f := range cgroupLimitFiles {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		// cgroup v2 reports "max" and v1 a huge page-aligned number when unlimited.
+		if v, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64); err == nil && v < 1<<62 {
+			return v
+		}
+	}
+	if v := debug.SetMemoryLimit(-1); v > 0 && v < 1<<62 {
+		return uint64(v)
+	}
+	return 0
+}
@@ -0,0 +1,77 @@
+package shed
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/metrics"
+)
+
+// retryAfter is the Retry-After hint sent with shed responses.
+const retryAfter = 1 * time.Second
+
+// Concurrency caps in-flight requests. Requests beyond the cap wait in a bounded queue
+// for up to a timeout; once the queue is full, or the wait times out, they are shed with 503.
+type Concurrency struct {
+	slots   chan struct{}
+	queue   chan struct{}
+	timeout time.Duration
+}
+
+// NewConcurrency allows max concurrent requests with up to queued waiting for timeout each.
+func NewConcurrency(max, queued int, timeout time.Duration) *Concurrency {
+	return &Concurrency{
+		slots:   make(chan struct{}, max),
+		queue:   make(chan struct{}, queued),
+		timeout: timeout,
+	}
+}
+
+// Middleware applies the concurrency cap to next.
+func (c *Concurrency) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.acquire(r) {
+			reject(w, "concurrency")
+			return
+		}
+		defer func() { <-c.slots }()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *Concurrency) acquire(r *http.Request) bool {
+	select {
+	case c.slots <- struct{}{}:
+		return true
+	default:
+	}
+	select {
+	case c.queue <- struct{}{}:
+	default:
+		return false
+	}
+	metrics.QueuedRequests.Inc()
+	defer func() {
+		<-c.queue
+		metrics.QueuedRequests.Dec()
+	}()
+
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	select {
+	case c.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// reject answers 503 with a Retry-After hint and counts the shed request by reason.
+func reject(w http.ResponseWriter, reason string) {
+	metrics.ShedTotal.WithLabelValues(reason).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
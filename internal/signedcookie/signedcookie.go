@@ -0,0 +1,114 @@
+package signedcookie
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/jwtauth"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/policy"
+)
+
+// Grant is the content of an access cookie: the prefix it opens and until when.
+type Grant struct {
+	Prefix  string `json:"prefix"`
+	Expires int64  `json:"exp"`
+}
+
+// Grants restricts prefixes to holders of signed access cookies, in the style of
+// CloudFront signed cookies: an operator issues a time-limited grant for a prefix and
+// shares its link, and redeeming the link stores the grant as a cookie for that prefix.
+// This lets embargoed builds be shared with testers without making them public.
+type Grants struct {
+	signer     Signer
+	cookieName string
+	prefixes   []string
+	// RedeemPath is the path of the links returned by Issue, to be routed to Redeem.
+	RedeemPath string
+}
+
+// New returns Grants restricting prefixes, signed with secret.
+func New(secret, cookieName, redeemPath string, prefixes []string) (*Grants, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("cookie secret must be at least 32 bytes")
+	}
+	if !strings.HasPrefix(redeemPath, "/") {
+		return nil, fmt.Errorf("redeem path %q must start with /", redeemPath)
+	}
+	return &Grants{signer: NewSigner([]byte(secret)), cookieName: cookieName, prefixes: prefixes, RedeemPath: redeemPath}, nil
+}
+
+// Issue returns a grant to prefix for ttl and its signed token. prefix must be one of the
+// restricted prefixes or below one.
+func (g *Grants) Issue(prefix string, ttl time.Duration) (Grant, string, error) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if !strings.HasPrefix(prefix, "/") || !policy.UnderPrefix(prefix, g.prefixes) {
+		return Grant{}, "", fmt.Errorf("prefix %q is not restricted", prefix)
+	}
+	if ttl <= 0 {
+		return Grant{}, "", errors.New("ttl must be positive")
+	}
+	grant := Grant{Prefix: prefix, Expires: time.Now().Add(ttl).Unix()}
+	token, err := g.signer.Seal(grant)
+	return grant, token, err
+}
+
+// Redeem stores the grant in the "token" query parameter as a cookie scoped to its
+// prefix and redirects to the prefix.
+func (g *Grants) Redeem(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	grant, ok := g.open(token)
+	if !ok {
+		http.Error(w, "link invalid or expired", http.StatusForbidden)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     g.cookieName,
+		Value:    token,
+		Path:     grant.Prefix,
+		Expires:  time.Unix(grant.Expires, 0),
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, grant.Prefix+"/", http.StatusFound)
+}
+
+// Protect answers 403 to requests under the restricted prefixes, as matched by under,
+// without a cookie granting access to the requested path.
+func (g *Grants) Protect(under jwtauth.PrefixMatcher) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(g.prefixes) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if under.Any(r, g.prefixes) && !g.granted(r, under) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// granted reports whether any of r's access cookies covers its path. Grants for
+// different prefixes are separate cookies of the same name.
+func (g *Grants) granted(r *http.Request, under jwtauth.PrefixMatcher) bool {
+	for _, c := range r.CookiesNamed(g.cookieName) {
+		if grant, ok := g.open(c.Value); ok && under(r, grant.Prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Grants) open(token string) (Grant, bool) {
+	var grant Grant
+	if token == "" || g.signer.Open(token, &grant) != nil || time.Now().Unix() >= grant.Expires {
+		return Grant{}, false
+	}
+	return grant, true
+}
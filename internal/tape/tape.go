@@ -0,0 +1,186 @@
+// Package tape records object storage responses to a directory and replays them, so the
+// proxy can run without network access to S3 or MinIO.
+package tape
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Modes of a Client.
+const (
+	Record = "record"
+	Replay = "replay"
+)
+
+// requestHeaders select a different response for the same URL, and are part of the key.
+var requestHeaders = []string{"Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"}
+
+// missing is answered in replay mode for requests that were never recorded, so the proxy
+// handles them like objects absent from the bucket.
+const missing = `<?xml version="1.0" encoding="UTF-8"?>
+<Error><Code>NoSuchKey</Code><Message>The request was not recorded.</Message></Error>`
+
+// Doer sends HTTP requests, like *http.Client and the AWS SDK's HTTP clients.
+type Doer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// Client records the responses of Next to Dir, or replays them from Dir without calling
+// Next. Each response is stored as <key>.json, with its status and headers, and
+// <key>.body.
+type Client struct {
+	Mode string
+	Dir  string
+	Next Doer
+}
+
+// recording is the metadata stored for a response.
+type recording struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+}
+
+// Check validates mode and creates dir for recording.
+func Check(mode, dir string) error {
+	switch mode {
+	case Record:
+		return os.MkdirAll(dir, 0o755)
+	case Replay:
+		if _, err := os.Stat(dir); err != nil {
+			return err
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown mode %q, expected %s or %s", mode, Record, Replay)
+	}
+}
+
+// Do replays or records the response to req.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	name := filepath.Join(c.Dir, Key(req))
+	if c.Mode == Replay {
+		return replay(req, name)
+	}
+	res, err := c.Next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	// Upstream failures are not worth replaying
+	if res.StatusCode >= http.StatusInternalServerError {
+		return res, nil
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	meta := recording{Method: req.Method, URL: req.URL.Path + "?" + req.URL.RawQuery, Status: res.StatusCode, Header: res.Header}
+	if err := save(name, meta, body); err != nil {
+		return nil, fmt.Errorf("record %s: %w", req.URL.Path, err)
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	return res, nil
+}
+
+// Key names the recording of req: a hash of its method, path, sorted query and the
+// request headers that change the response. Hosts are left out, so recordings made
+// against one endpoint replay for another.
+func Key(req *http.Request) string {
+	query := req.URL.Query()
+	// The SDK adds the operation name, which does not change the response
+	query.Del("x-id")
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s?%s\n", req.Method, req.URL.EscapedPath(), query.Encode())
+	names := append([]string(nil), requestHeaders...)
+	sort.Strings(names)
+	for _, name := range names {
+		if v := req.Header.Get(name); v != "" {
+			fmt.Fprintf(h, "%s: %s\n", strings.ToLower(name), v)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(req *http.Request, name string) (*http.Response, error) {
+	res := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Request:    req,
+	}
+	data, err := os.ReadFile(name + ".json")
+	if os.IsNotExist(err) {
+		res.StatusCode = http.StatusNotFound
+		res.Header = http.Header{"Content-Type": {"application/xml"}}
+		res.Body = io.NopCloser(strings.NewReader(missing))
+		res.ContentLength = int64(len(missing))
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var meta recording
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("replay %s: %w", name, err)
+	}
+	body, err := os.ReadFile(name + ".body")
+	if err != nil {
+		return nil, err
+	}
+	res.StatusCode = meta.Status
+	res.Status = fmt.Sprintf("%d %s", meta.Status, http.StatusText(meta.Status))
+	res.Header = meta.Header
+	if res.Header == nil {
+		res.Header = http.Header{}
+	}
+	res.ContentLength = int64(len(body))
+	if req.Method == http.MethodHead {
+		// HEAD responses keep the object's Content-Length without a body
+		res.ContentLength = -1
+		body = nil
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	return res, nil
+}
+
+// save writes the recording through temporary files, so concurrent requests for the same
+// key never leave a partial recording.
+func save(name string, meta recording, body []byte) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(name+".body", body); err != nil {
+		return err
+	}
+	return writeFile(name+".json", data)
+}
+
+func writeFile(name string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
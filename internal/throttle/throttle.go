@@ -0,0 +1,64 @@
+package throttle
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// NewLimiter returns a byte-rate limiter allowing bytesPerSec with one second's worth of
+// burst, or nil when bytesPerSec is not positive.
+func NewLimiter(bytesPerSec int) *rate.Limiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSec), bytesPerSec)
+}
+
+// Writer delays writes so they stay within every limiter, e.g. a per-response limit and a
+// global egress limit shared by all responses.
+type Writer struct {
+	w        io.Writer
+	ctx      context.Context
+	limiters []*rate.Limiter
+	chunk    int
+}
+
+// NewWriter wraps w with the non-nil limiters. It returns w itself when there are none.
+// Waiting stops with an error once ctx is done, e.g. when the client disconnects.
+func NewWriter(ctx context.Context, w io.Writer, limiters ...*rate.Limiter) io.Writer {
+	t := &Writer{w: w, ctx: ctx}
+	for _, l := range limiters {
+		if l == nil {
+			continue
+		}
+		t.limiters = append(t.limiters, l)
+		if t.chunk == 0 || l.Burst() < t.chunk {
+			t.chunk = l.Burst()
+		}
+	}
+	if len(t.limiters) == 0 {
+		return w
+	}
+	return t
+}
+
+func (t *Writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), t.chunk)
+		for _, l := range t.limiters {
+			if err := l.WaitN(t.ctx, n); err != nil {
+				return written, err
+			}
+		}
+		m, err := t.w.Write(p[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
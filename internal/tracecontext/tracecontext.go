@@ -0,0 +1,91 @@
+package tracecontext
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// W3C Trace Context headers (https://www.w3.org/TR/trace-context/).
+const (
+	ParentHeader = "traceparent"
+	StateHeader  = "tracestate"
+)
+
+// TraceContext identifies the proxy's span within a distributed trace.
+type TraceContext struct {
+	TraceID string
+	// SpanID is generated per request; ParentID is the caller's span.
+	SpanID   string
+	ParentID string
+	Flags    string
+	State    string
+}
+
+// Traceparent formats the header value that makes the proxy's span the parent of an
+// outgoing request.
+func (tc TraceContext) Traceparent() string {
+	return "00-" + tc.TraceID + "-" + tc.SpanID + "-" + tc.Flags
+}
+
+// Sampled reports whether the caller recorded the trace, so it can be looked up.
+func (tc TraceContext) Sampled() bool {
+	return len(tc.Flags) == 2 && strings.ContainsRune("13579bdf", rune(tc.Flags[1]))
+}
+
+// Parse parses a traceparent header value. Unknown future versions are accepted as long
+// as they start with the version 00 fields.
+func Parse(traceparent, tracestate string) (TraceContext, bool) {
+	v := strings.TrimSpace(traceparent)
+	if len(v) < 55 || (len(v) > 55 && (v[:2] == "00" || v[55] != '-')) {
+		return TraceContext{}, false
+	}
+	version, traceID, parentID, flags := v[0:2], v[3:35], v[36:52], v[53:55]
+	if v[2] != '-' || v[35] != '-' || v[52] != '-' || version == "ff" ||
+		!isHex(version) || !isHex(traceID) || !isHex(parentID) || !isHex(flags) ||
+		isZero(traceID) || isZero(parentID) {
+		return TraceContext{}, false
+	}
+	return TraceContext{TraceID: traceID, ParentID: parentID, Flags: flags, State: tracestate}, true
+}
+
+type contextKey struct{}
+
+// FromContext returns the trace context stored by Middleware.
+func FromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(contextKey{}).(TraceContext)
+	return tc, ok
+}
+
+// Middleware stores the trace context of requests carrying a valid traceparent header,
+// with a new span ID for the proxy, so logs and upstream calls can join the trace.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tc, ok := Parse(r.Header.Get(ParentHeader), r.Header.Get(StateHeader)); ok {
+			tc.SpanID = newSpanID()
+			r = r.WithContext(context.WithValue(r.Context(), contextKey{}, tc))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newSpanID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
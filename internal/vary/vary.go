@@ -0,0 +1,61 @@
+// Package vary computes the Vary header of a response from the request headers that
+// actually selected it, so shared caches such as the CDN only split their entries where
+// responses really differ.
+//
+// Code that picks a response based on a request header (content encoding negotiation,
+// Origin-dependent CORS headers, preview or canary opt-ins, navigation detection through
+// Accept) must call Add with that header before the response is written. Code without
+// access to the response, such as key hooks, calls AddContext instead.
+package vary
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+type ctxKey struct{}
+
+// WithResponse returns ctx carrying h, the headers of the response the request's handlers
+// are selecting, for AddContext.
+func WithResponse(ctx context.Context, h http.Header) context.Context {
+	return context.WithValue(ctx, ctxKey{}, h)
+}
+
+// AddContext adds names to the Vary header of the response carried by ctx, if any.
+func AddContext(ctx context.Context, names ...string) {
+	if h, ok := ctx.Value(ctxKey{}).(http.Header); ok {
+		Add(h, names...)
+	}
+}
+
+// Add adds names to the Vary header of h, once each. A Vary of "*" is left as it is.
+func Add(h http.Header, names ...string) {
+	var fields []string
+	seen := map[string]bool{}
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			if name == "*" {
+				return
+			}
+			if key := http.CanonicalHeaderKey(name); !seen[key] {
+				seen[key] = true
+				fields = append(fields, name)
+			}
+		}
+	}
+	added := false
+	for _, name := range names {
+		if key := http.CanonicalHeaderKey(name); name != "" && !seen[key] {
+			seen[key] = true
+			fields = append(fields, name)
+			added = true
+		}
+	}
+	if added {
+		h.Set("Vary", strings.Join(fields, ", "))
+	}
+}
@@ -0,0 +1,276 @@
+package proxy
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/admin"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/policy"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/release"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/s3"
+)
+
+// Explanation describes how the proxy serves a request, as worked out from its
+// configuration without contacting object storage.
+type Explanation struct {
+	// Path is the request path after cleaning, as routed.
+	Path string `json:"path"`
+	Host string `json:"host,omitempty"`
+	// Outcome summarizes what the request gets, e.g. "served from object storage".
+	Outcome string `json:"outcome"`
+	// Endpoint names the built-in endpoint serving the path instead of a route rule.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Location is the target of a redirect.
+	Location string `json:"location,omitempty"`
+	// Rule is the matched route rule.
+	Rule *RouteRule `json:"rule,omitempty"`
+	// Release is the rule's live release at startup, when it has releases.
+	Release string `json:"release,omitempty"`
+	// Object is the full bucket path ("/bucket/key") the request reads, split into Bucket
+	// and Key.
+	Object string `json:"object,omitempty"`
+	Bucket string `json:"bucket,omitempty"`
+	Key    string `json:"key,omitempty"`
+	// Canary is the full bucket path read by clients assigned to the rule's canary.
+	Canary string `json:"canary,omitempty"`
+	// Preview is the full bucket path read by requests opting into preview.
+	Preview string `json:"preview,omitempty"`
+	// CachePolicy lists how responses are cached by clients, CDNs and the proxy.
+	CachePolicy []string `json:"cachePolicy,omitempty"`
+	// SPAFallback is the full bucket path served to page navigations when Object is missing.
+	SPAFallback string `json:"spaFallback,omitempty"`
+	// Notes are other settings that affect the request.
+	Notes []string `json:"notes,omitempty"`
+}
+
+// Explain works out how the handler built from cfg serves r: the endpoint or route rule
+// it reaches, the object it reads, how the response is cached and where page navigations
+// fall back to. Hooks and filters, and releases switched at runtime, are not known to it.
+func Explain(cfg Config, r *http.Request) (Explanation, error) {
+	e := Explanation{Host: requestHost(r)}
+	p, ok := policy.Clean(r.URL.Path)
+	if !ok {
+		e.Path, e.Outcome = r.URL.Path, "400: the path climbs above the root"
+		return e, nil
+	}
+	e.Path = p
+	if endpoint := builtinEndpoint(cfg, r.Method, p); endpoint != "" {
+		e.Endpoint, e.Outcome = endpoint, "served by a built-in endpoint"
+		if p == cfg.FedModulesPath {
+			e.CachePolicy = []string{fmt.Sprintf("Cache-Control: public, max-age=%d", int(cfg.FedModulesTTL.Seconds()))}
+		}
+		return e, nil
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		e.Outcome = "405: only GET and HEAD are served"
+		return e, nil
+	}
+
+	if cfg.RedirectsErr != nil {
+		return e, fmt.Errorf("REDIRECT_RULES: %w", cfg.RedirectsErr)
+	}
+	target, status, ok, err := policy.RedirectTarget(cfg.Redirects, p)
+	if err != nil {
+		return e, fmt.Errorf("REDIRECT_RULES: %w", err)
+	}
+	if ok {
+		e.Location, e.Outcome = target, fmt.Sprintf("%d: redirected by REDIRECT_RULES", status)
+		return e, nil
+	}
+	if policy.Denied(cfg.DenylistPatterns, p) {
+		e.Outcome = "404: matches DENYLIST_PATTERNS"
+		return e, nil
+	}
+	if strings.HasSuffix(p, ".map") && (cfg.SourceMapToken != "" || len(cfg.SourceMapAllowedCIDRs) > 0) {
+		e.Notes = append(e.Notes, "source maps are only served with SOURCEMAP_HEADER or from SOURCEMAP_ALLOWED_CIDRS, others get 404")
+	}
+	if cfg.RoutesErr != nil {
+		return e, fmt.Errorf("ROUTE_RULES: %w", cfg.RoutesErr)
+	}
+	keys, err := compileKeys(cfg.Routes)
+	if err != nil {
+		return e, fmt.Errorf("ROUTE_RULES: %w", err)
+	}
+	releases := release.NewRegistry(cfg.Routes)
+	under := prefixMatcher(newResolver(cfg.Routes, releases, keys))
+	cleaned := r.Clone(r.Context())
+	cleaned.URL.Path = p
+	for _, protected := range []struct {
+		prefixes []string
+		note     string
+	}{
+		{cfg.JWTProtectedPrefixes, "requires a bearer token (JWT_PROTECTED_PREFIXES)"},
+		{cfg.OIDCProtectedPrefixes, "requires an OIDC login (OIDC_PROTECTED_PREFIXES)"},
+		{cfg.SignedCookiePrefixes, "requires a signed access cookie (SIGNED_COOKIE_PREFIXES)"},
+	} {
+		if under.Any(cleaned, protected.prefixes) {
+			e.Notes = append(e.Notes, protected.note)
+		}
+	}
+
+	rules := config.RoutesForHost(cfg.Routes, e.Host)
+	if cfg.ManifestIndexEnabled && p == "/manifests" {
+		if i := slices.IndexFunc(rules, func(rule RouteRule) bool { return rule.Prefix == "/manifests" }); i >= 0 {
+			e.Rule = &rules[i]
+			e.Endpoint, e.Outcome = "manifest index", "served by a built-in endpoint"
+			e.CachePolicy = []string{"Cache-Control: no-cache"}
+			return e, nil
+		}
+	}
+	rule, ok := config.MatchRoute(rules, p)
+	if !ok {
+		e.Outcome = "404: no route rule matches"
+		return e, nil
+	}
+	e.Rule = &rule
+	if location, ok := policy.TrailingSlashTarget(rule.TrailingSlash, r.Method, p); ok {
+		e.Location, e.Outcome = location, "301: redirected to the rule's trailing slash form"
+		return e, nil
+	}
+	if rule.IdentityRequired(cfg.RequireIdentity) {
+		e.Notes = append(e.Notes, "requires an x-rh-identity header, others get 401")
+	}
+	if len(rule.AllowCIDRs) > 0 || len(rule.DenyCIDRs) > 0 {
+		e.Notes = append(e.Notes, "restricted to clients from the rule's allowCIDRs and outside its denyCIDRs, others get 403")
+	}
+	if !rule.AllowsExtension(p) {
+		e.Outcome = "404: the extension is not in the rule's extensions"
+		return e, nil
+	}
+	if rule.Immutable && !isCommitSHA(strings.TrimPrefix(p, rule.Prefix)) {
+		e.Outcome = "404: immutable rules need a commit SHA after the prefix"
+		return e, nil
+	}
+	objectPath, err := keys.objectPath(rule, r, p)
+	if err != nil {
+		e.Outcome = fmt.Sprintf("404: the key expression failed: %v", err)
+		return e, nil
+	}
+
+	if st, ok := releases.Snapshot()[rule.Name]; ok {
+		e.Release = st.Live
+	}
+	e.Object = s3.JoinPath(liveBucketPath(rule, releases), objectPath)
+	if cfg.ListingEnabled && r.URL.Query().Has("list") {
+		e.Outcome = "lists the objects under " + e.Object
+		return e, nil
+	}
+	if cfg.DirectoryIndex != "" && strings.HasSuffix(e.Object, "/") {
+		e.Object += cfg.DirectoryIndex
+	}
+	e.Bucket, e.Key, _ = strings.Cut(strings.TrimPrefix(e.Object, "/"), "/")
+	e.Outcome = "served from object storage"
+	if rule.Canary != nil {
+		e.Canary = s3.JoinPath(rule.Canary.BucketPath, objectPath)
+		if cfg.DirectoryIndex != "" && strings.HasSuffix(e.Canary, "/") {
+			e.Canary += cfg.DirectoryIndex
+		}
+		e.Notes = append(e.Notes, fmt.Sprintf("%g%% of clients are assigned to the canary", rule.Canary.Percent))
+	}
+	if cfg.PreviewBucketPathPrefix != "" {
+		preview := r.Clone(r.Context())
+		preview.Header.Set(cfg.PreviewHeader, "true")
+		if full, ok := s3.PreviewPath(cfg, preview, e.Object); ok {
+			e.Preview = full
+		}
+	}
+	if rule.VersionMap != "" {
+		e.Notes = append(e.Notes, "object versions are pinned by "+rule.VersionMap)
+	}
+	if rule.Presign != nil {
+		e.Notes = append(e.Notes, "answered with redirects to presigned URLs, except for HTML navigations and objects below minSize")
+	}
+	if len(cfg.FilterModules) > 0 {
+		e.Notes = append(e.Notes, "FILTER_MODULES may change the object and headers")
+	}
+	e.CachePolicy = cachePolicy(cfg, rule)
+
+	// Only navigations fall back, and a missing chunk.js is never one
+	if ext := path.Ext(p); ext != "" && ext != ".html" && ext != ".htm" {
+		return e, nil
+	}
+	if cfg.DirectoryIndex != "" && path.Ext(e.Key) == "" {
+		e.Notes = append(e.Notes, fmt.Sprintf("page navigations for a missing object first try %s/%s", e.Object, cfg.DirectoryIndex))
+	}
+	if full := s3.SPAFallbackPath(cfg, liveBucketPath(rule, releases), p); full != "" {
+		if full != e.Object {
+			e.SPAFallback = full
+			e.Notes = append(e.Notes, fmt.Sprintf("page navigations (Accept: text/html) for a missing object get the SPA fallback with status %d and Cache-Control: %s", cfg.SPAFallbackStatus, cfg.SPAFallbackCacheControl))
+		}
+	}
+	return e, nil
+}
+
+// builtinEndpoint names the endpoint registered for method and p ahead of the route
+// rules, if any.
+func builtinEndpoint(cfg Config, method, p string) string {
+	adminUser, adminPassword, _ := strings.Cut(cfg.AdminBasicAuth, ":")
+	get := method == http.MethodGet || method == http.MethodHead
+	switch {
+	case p == "/healthz" && get, p == "/readyz" && get:
+		return p
+	case p == "/metrics" && cfg.MetricsPort == "", p == "/debug/vars" && cfg.MetricsPort == "" && cfg.ExpvarEnabled:
+		return p
+	case p == cfg.FedModulesPath && cfg.FedModulesPath != "" && get:
+		return "merged fed-modules.json (FED_MODULES_PATH)"
+	case p == "/exists" && method == http.MethodPost && cfg.ExistsAPIEnabled:
+		return "existence checks (EXISTS_API_ENABLED)"
+	case p == "/admin/deploy-hook" && cfg.DeployHookSecret != "":
+		return "deploy hook (DEPLOY_HOOK_SECRET)"
+	case policy.UnderPrefix(p, []string{"/admin"}) && (admin.Auth{Token: cfg.AdminToken, Username: adminUser, Password: adminPassword}).Enabled():
+		return "admin API"
+	case p == cfg.SignedCookieRedeemPath && len(cfg.SignedCookiePrefixes) > 0 && get:
+		return "signed cookie redemption (SIGNED_COOKIE_REDEEM_PATH)"
+	case len(cfg.OIDCProtectedPrefixes) > 0 && get:
+		if u, err := url.Parse(cfg.OIDCRedirectURL); err == nil && u.Path == p {
+			return "OIDC login callback (OIDC_REDIRECT_URL)"
+		}
+	}
+	return ""
+}
+
+// cachePolicy describes the caching headers of rule's responses and the object cache.
+func cachePolicy(cfg Config, rule RouteRule) []string {
+	var policy []string
+	switch {
+	case rule.Immutable:
+		policy = append(policy, "Cache-Control: public, max-age=31536000, immutable (immutable rule)")
+	case slices.Contains(s3.UpstreamHeadersFor(cfg, rule), "Cache-Control"):
+		policy = append(policy, "Cache-Control: the object's Cache-Control metadata, if any")
+	default:
+		policy = append(policy, "Cache-Control: none, it is not among the rule's upstream headers")
+	}
+	for _, h := range rule.ResponseHeaders {
+		when := ""
+		if len(h.ContentTypes) > 0 {
+			when = " for " + strings.Join(h.ContentTypes, ", ")
+		}
+		for _, name := range slices.Sorted(maps.Keys(h.Set)) {
+			if strings.EqualFold(name, "Cache-Control") || strings.EqualFold(name, "Expires") {
+				policy = append(policy, fmt.Sprintf("%s: %s%s (responseHeaders)", http.CanonicalHeaderKey(name), h.Set[name], when))
+			}
+		}
+		for _, name := range h.Remove {
+			if prefix, ok := strings.CutSuffix(name, "*"); ok && strings.HasPrefix("cache-control", strings.ToLower(prefix)) || strings.EqualFold(name, "Cache-Control") {
+				policy = append(policy, "Cache-Control: removed"+when+" (responseHeaders)")
+			}
+		}
+	}
+	surrogate := rule.SurrogateControl
+	if surrogate == "" {
+		surrogate = cfg.SurrogateControl
+	}
+	if surrogate != "" {
+		policy = append(policy, "Surrogate-Control: "+surrogate)
+	}
+	if cfg.CacheMaxBytes > 0 {
+		policy = append(policy, fmt.Sprintf("object cache: objects up to %d bytes are kept in memory for %s", cfg.CacheMaxObjectSize, cfg.CacheTTL))
+	}
+	return policy
+}
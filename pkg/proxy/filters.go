@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/filter"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/metrics"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/vary"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// loadFilters compiles the FILTER_MODULES of cfg.
+func loadFilters(cfg Config) ([]*filter.Module, error) {
+	var modules []*filter.Module
+	for _, path := range cfg.FilterModules {
+		m, err := filter.Load(context.Background(), path, cfg.FilterTimeout, cfg.FilterMemoryLimitMB)
+		if err != nil {
+			for _, loaded := range modules {
+				loaded.Close(context.Background())
+			}
+			return nil, err
+		}
+		modules = append(modules, m)
+	}
+	return modules, nil
+}
+
+// filterHooks runs modules in order as hooks. A failing filter is logged and skipped, so
+// the request continues as if it was not configured.
+func filterHooks(modules []*filter.Module, log logger.Logger) Hooks {
+	failed := func(r *http.Request, m *filter.Module, fn string, err error) {
+		metrics.FilterErrorsTotal.WithLabelValues(m.Name, fn).Inc()
+		log.WithFields(logger.Fields{"process": "filter", "module": m.Name, "path": r.URL.Path, "request_id": middleware.GetReqID(r.Context())}).Errorf("filter failed: %v", err)
+	}
+	return Hooks{
+		OnKeyResolved: func(r *http.Request, rule RouteRule, full string) string {
+			for _, m := range modules {
+				if !m.HasKey() {
+					continue
+				}
+				res, err := m.Key(r.Context(), filter.KeyCall{Request: filterRequest(r), Rule: rule.Prefix, Key: full})
+				if err != nil {
+					failed(r, m, "filter_key", err)
+					continue
+				}
+				vary.AddContext(r.Context(), res.Vary...)
+				if res.Key != "" {
+					full = res.Key
+				}
+			}
+			return full
+		},
+		OnResponseHeaders: func(r *http.Request, status int, h http.Header) {
+			for _, m := range modules {
+				if !m.HasResponseHeaders() {
+					continue
+				}
+				res, err := m.ResponseHeaders(r.Context(), filter.HeadersCall{Request: filterRequest(r), Status: status, Headers: h})
+				if err != nil {
+					failed(r, m, "filter_response_headers", err)
+					continue
+				}
+				for _, name := range res.Remove {
+					h.Del(name)
+				}
+				for name, value := range res.Set {
+					h.Set(name, value)
+				}
+			}
+		},
+	}
+}
+
+// filterRequest describes r for filters, with the first value of each request header.
+func filterRequest(r *http.Request) filter.Request {
+	headers := make(map[string]string, len(r.Header))
+	for name, values := range r.Header {
+		if len(values) > 0 {
+			headers[name] = values[0]
+		}
+	}
+	return filter.Request{Method: r.Method, Host: r.Host, Path: r.URL.Path, Headers: headers}
+}
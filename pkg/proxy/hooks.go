@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"net/http"
+)
+
+// Hooks lets programs embedding the proxy observe and adjust requests served by route
+// rules without patching the S3 code. Every field is optional; hooks of several Hooks
+// passed to NewHandler run in order.
+type Hooks struct {
+	// OnRequest runs when a request matches rule, before anything is served. Returning
+	// false ends the request; the hook must then have written a response.
+	OnRequest func(w http.ResponseWriter, r *http.Request, rule RouteRule) bool
+	// OnKeyResolved runs once the full bucket path ("/bucket/key") for the request is
+	// known, and returns the path to serve instead, usually full itself.
+	OnKeyResolved func(r *http.Request, rule RouteRule, full string) string
+	// OnResponseHeaders runs right before the response status and headers are written,
+	// and may change the headers.
+	OnResponseHeaders func(r *http.Request, status int, h http.Header)
+	// OnError runs after an error response (4xx or 5xx) was sent, with the upstream
+	// error that caused it, if any.
+	OnError func(r *http.Request, status int, err error)
+}
+
+// hookChain runs the hooks of several Hooks in order.
+type hookChain []Hooks
+
+func (c hookChain) onRequest(w http.ResponseWriter, r *http.Request, rule RouteRule) bool {
+	for _, h := range c {
+		if h.OnRequest != nil && !h.OnRequest(w, r, rule) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c hookChain) onKeyResolved(r *http.Request, rule RouteRule, full string) string {
+	for _, h := range c {
+		if h.OnKeyResolved != nil {
+			full = h.OnKeyResolved(r, rule, full)
+		}
+	}
+	return full
+}
+
+func (c hookChain) onError(r *http.Request, status int, err error) {
+	for _, h := range c {
+		if h.OnError != nil {
+			h.OnError(r, status, err)
+		}
+	}
+}
+
+// responseHeaders wraps w to run the OnResponseHeaders hooks before the headers are
+// written, or returns w when there are none.
+func (c hookChain) responseHeaders(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	for _, h := range c {
+		if h.OnResponseHeaders != nil {
+			return &headerHookWriter{ResponseWriter: w, r: r, hooks: c}
+		}
+	}
+	return w
+}
+
+type headerHookWriter struct {
+	http.ResponseWriter
+	r       *http.Request
+	hooks   hookChain
+	written bool
+}
+
+func (w *headerHookWriter) WriteHeader(status int) {
+	// Informational responses such as 103 Early Hints are not the final headers
+	if !w.written && status >= http.StatusOK {
+		w.written = true
+		for _, h := range w.hooks {
+			if h.OnResponseHeaders != nil {
+				h.OnResponseHeaders(w.r, status, w.Header())
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *headerHookWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *headerHookWriter) Flush() {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *headerHookWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,459 @@
+// Package proxy builds the frontend asset proxy's HTTP handler, so programs such as the
+// frontend-operator or test harnesses can serve assets in-process instead of running the
+// proxy binary.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/admin"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/cdn"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/clientip"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/errreport"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/events"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/fault"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/hotkeys"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/identity"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/jwtauth"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/manifest"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/metrics"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/oidc"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/policy"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/problem"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/ratelimit"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/release"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/s3"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/shed"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/signedcookie"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/tape"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/tracecontext"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Config is the proxy configuration, as documented in the README.
+type Config = config.FrontendAssetProxyConfig
+
+// RouteRule maps a path prefix to a bucket path.
+type RouteRule = config.RouteRule
+
+// Logger writes the proxy's application and access logs.
+type Logger = logger.Root
+
+// ConfigFromEnv reads the configuration from environment variables like the proxy binary.
+func ConfigFromEnv() Config {
+	return config.FromEnv()
+}
+
+// NewLogger returns a logger for the "logrus" or "slog" backend in "text" or "json" format.
+func NewLogger(backend, format, level string) (*Logger, error) {
+	return logger.New(backend, format, level)
+}
+
+// Handler serves everything the proxy binary serves on its main port. Close releases its
+// background resources once the server is shut down.
+type Handler struct {
+	http.Handler
+	closers []func()
+}
+
+// Close stops the handler's background work, flushing pending events, CDN invalidations
+// and error reports.
+func (h *Handler) Close() {
+	for i := len(h.closers) - 1; i >= 0; i-- {
+		h.closers[i]()
+	}
+	h.closers = nil
+}
+
+// NewHandler builds the proxy's routes and middleware for cfg. backend is the S3 client
+// to read assets with; when nil, one is built from cfg like the proxy binary does. hooks
+// run for every request served by a route rule.
+func NewHandler(cfg Config, backend *awss3.Client, log *Logger, hooks ...Hooks) (*Handler, error) {
+	h := &Handler{}
+	handler, err := h.build(cfg, backend, log, hooks)
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+	h.Handler = handler
+	return h, nil
+}
+
+func (h *Handler) build(cfg Config, backend *awss3.Client, log *Logger, hooks hookChain) (http.Handler, error) {
+	structuredLogger := logger.NewLogger(log)
+	accessLog, err := logger.ParseAccessLogFormat(cfg.AccessLogFormat)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ACCESS_LOG_FORMAT: %w", err)
+	}
+	structuredLogger.AccessLog = accessLog
+	sampling, err := logger.NewSampling(logger.SamplingRules{Rates: cfg.AccessLogSampleRates, Exclude: cfg.AccessLogExcludePaths})
+	if err != nil {
+		return nil, fmt.Errorf("invalid ACCESS_LOG_SAMPLE_RATES: %w", err)
+	}
+	structuredLogger.Sampling = sampling
+	structuredLogger.CaptureHeaders = cfg.LogRequestHeaders
+
+	r := chi.NewRouter()
+	r.Use(logger.RequestID(cfg.RequestIDHeader))
+	r.Use(tracecontext.Middleware)
+	r.Use(logger.DebugRequests(cfg.DebugHeader, cfg.DebugToken))
+	r.Use(middleware.RequestLogger(structuredLogger))
+	r.Use(middleware.Recoverer)
+	if cfg.SentryDSN != "" {
+		if err := errreport.Init(cfg.SentryDSN, cfg.SentryEnvironment); err != nil {
+			return nil, fmt.Errorf("sentry: %w", err)
+		}
+		h.closers = append(h.closers, func() { errreport.Flush(2 * time.Second) })
+		r.Use(errreport.Middleware)
+	}
+	r.Use(policy.CleanPath)
+	r.Use(middleware.URLFormat)
+	r.Use(problem.Prefixes(cfg.ProblemJSONPrefixes))
+
+	trusted, err := clientip.ParseCIDRs(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	clients := clientip.Resolver{Trusted: trusted}
+	r.Use(identity.TrustedOnly(clients.TrustedPeer))
+	if cfg.RateLimitRPS > 0 {
+		limiter := ratelimit.New(cfg.RateLimitRPS, cfg.RateLimitBurst)
+		r.Use(limiter.Middleware(rateLimitKey(cfg.RateLimitKey, clients), cfg.RateLimitExempt))
+	}
+
+	if backend == nil {
+		if cfg.S3RecordMode != "" {
+			if err := tape.Check(cfg.S3RecordMode, cfg.S3RecordDir); err != nil {
+				return nil, fmt.Errorf("S3_RECORD_MODE: %w", err)
+			}
+			log.Warnf("S3 %s mode, recordings in %s", cfg.S3RecordMode, cfg.S3RecordDir)
+		}
+		backend = s3.NewS3ClientFromConfig(cfg, log)
+	}
+	proxy := s3.NewProxyWithClient(cfg, backend, log)
+	if cfg.ManifestSchemaFile != "" {
+		validator, err := manifest.NewValidator(cfg.ManifestSchemaFile, cfg.ManifestSchemaMatch, cfg.ManifestInvalidAction)
+		if err != nil {
+			return nil, fmt.Errorf("manifest validation: %w", err)
+		}
+		proxy.ManifestValidator = validator
+	}
+
+	if len(cfg.FilterModules) > 0 {
+		modules, err := loadFilters(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("FILTER_MODULES: %w", err)
+		}
+		h.closers = append(h.closers, func() {
+			for _, m := range modules {
+				m.Close(context.Background())
+			}
+		})
+		hooks = append(hooks, filterHooks(modules, log))
+	}
+
+	if err := s3.CheckUpstreamHeaders(cfg.UpstreamHeaders); err != nil {
+		return nil, fmt.Errorf("UPSTREAM_HEADERS: %w", err)
+	}
+	if cfg.RoutesErr != nil {
+		return nil, fmt.Errorf("ROUTE_RULES: %w", cfg.RoutesErr)
+	}
+	keys, err := compileKeys(cfg.Routes)
+	if err != nil {
+		return nil, fmt.Errorf("ROUTE_RULES: %w", err)
+	}
+	releases := release.NewRegistry(cfg.Routes)
+	proxy.Resolve = newResolver(cfg.Routes, releases, keys)
+	// A switch keeps the previous release warm in the cache, so a rollback doesn't serve
+	// a burst of cold requests.
+	releases.OnSwitch(func(app string, st release.Status) {
+		log.WithFields(logger.Fields{"app": app, "live": st.Live, "previous": st.Previous}).Infof("live release switched")
+		previous, ok := st.Releases[st.Previous]
+		if cfg.CacheMaxBytes <= 0 || !ok {
+			return
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.ProxiedRequestTimeout)
+			defer cancel()
+			paths, err := proxy.WarmupPaths(ctx)
+			if err != nil {
+				log.Errorf("release warmup: %v", err)
+				return
+			}
+			paths, resolve := releasePaths(cfg.Routes, keys, app, previous, paths)
+			log.WithFields(logger.Fields{"app": app, "release": st.Previous}).Infof("release warmup loaded %d objects", proxy.Warmup(ctx, paths, resolve))
+		}()
+	})
+	if cfg.ReleaseStatePath != "" {
+		store, err := proxy.ReleaseStore(cfg.ReleaseStatePath)
+		if err != nil {
+			return nil, fmt.Errorf("RELEASE_STATE_PATH: %w", err)
+		}
+		releases.Persist(store)
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ProxiedRequestTimeout)
+		if err := releases.Refresh(ctx); err != nil {
+			log.Warnf("release state: %v", err)
+		}
+		cancel()
+		h.closers = append(h.closers, releases.Sync(cfg.ReleaseStateTTL, func(err error) {
+			log.Warnf("release state: %v", err)
+		}))
+	}
+
+	if cfg.MetricsPort == "" {
+		r.Handle("/metrics", metrics.Handler())
+		if cfg.ExpvarEnabled {
+			r.Handle("/debug/vars", metrics.ExpvarHandler())
+		}
+	}
+
+	if cfg.FedModulesPath != "" {
+		r.Get(routePattern(cfg.FedModulesPath), exactPath(cfg.FedModulesPath, proxy.FedModulesHandler()))
+		r.Head(routePattern(cfg.FedModulesPath), exactPath(cfg.FedModulesPath, proxy.FedModulesHandler()))
+	}
+
+	if cfg.ExistsAPIEnabled {
+		r.Post("/exists", proxy.ExistsHandler(newResolver(cfg.Routes, releases, keys)))
+	}
+
+	// Cache warmup loads hot assets before the pod reports ready, so replicas added during
+	// scale-up don't serve a burst of cold requests.
+	var warmup func(ctx context.Context) (int, error)
+	if cfg.CacheMaxBytes > 0 {
+		warmup = func(ctx context.Context) (int, error) {
+			paths, err := proxy.WarmupPaths(ctx)
+			if err != nil {
+				return 0, err
+			}
+			return proxy.Warmup(ctx, paths, proxy.Resolve), nil
+		}
+	}
+	var ready atomic.Bool
+	if warmup != nil && (cfg.CacheWarmupManifest != "" || len(cfg.CacheWarmupPaths) > 0) {
+		go func() {
+			defer ready.Store(true)
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.ProxiedRequestTimeout)
+			defer cancel()
+			warmed, err := warmup(ctx)
+			if err != nil {
+				log.Errorf("cache warmup: %v", err)
+				return
+			}
+			log.Infof("cache warmup loaded %d objects", warmed)
+		}()
+	} else {
+		ready.Store(true)
+	}
+
+	var hot *hotkeys.Tracker
+	if cfg.HotKeysCapacity > 0 {
+		hot = hotkeys.New(cfg.HotKeysCapacity)
+	}
+
+	adminCIDRs, err := clientip.ParseCIDRs(cfg.AdminAllowedCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("ADMIN_ALLOWED_CIDRS: %w", err)
+	}
+	adminUser, adminPassword, _ := strings.Cut(cfg.AdminBasicAuth, ":")
+	adminAuth := admin.Auth{Token: cfg.AdminToken, Username: adminUser, Password: adminPassword, AllowedCIDRs: adminCIDRs, Clients: clients}
+	var grants *signedcookie.Grants
+	if len(cfg.SignedCookiePrefixes) > 0 {
+		if grants, err = signedcookie.New(cfg.SignedCookieSecret, cfg.SignedCookieName, cfg.SignedCookieRedeemPath, cfg.SignedCookiePrefixes); err != nil {
+			return nil, fmt.Errorf("signed cookies: %w", err)
+		}
+		r.Get(grants.RedeemPath, grants.Redeem)
+	}
+	var purgers []cdn.Purger
+	if cfg.AkamaiHost != "" {
+		akamai, err := cdn.NewAkamai(cdn.AkamaiConfig{
+			Host:         cfg.AkamaiHost,
+			ClientToken:  cfg.AkamaiClientToken,
+			ClientSecret: cfg.AkamaiClientSecret,
+			AccessToken:  cfg.AkamaiAccessToken,
+			Network:      cfg.AkamaiNetwork,
+			BaseURL:      cfg.AkamaiBaseURL,
+		})
+		if err != nil {
+			return nil, err
+		}
+		purgers = append(purgers, akamai)
+	}
+	if cfg.CloudFrontDistributionID != "" {
+		awsCfg, err := s3.LoadAWSConfig(cfg, log)
+		if err != nil {
+			return nil, fmt.Errorf("cloudfront: %w", err)
+		}
+		cloudFront := cdn.NewCloudFront(awsCfg, cdn.CloudFrontConfig{
+			DistributionID: cfg.CloudFrontDistributionID,
+			AppPrefixes:    cfg.CacheTagPrefixes,
+			Interval:       cfg.CloudFrontInvalidationInterval,
+			MaxPaths:       cfg.CloudFrontInvalidationMaxPaths,
+		}, log)
+		h.closers = append(h.closers, cloudFront.Close)
+		purgers = append(purgers, cloudFront)
+	}
+	// A purge clears the object cache and, when configured, the CDN edge in one call
+	var purge func(ctx context.Context, paths, apps []string) (int, error)
+	if cfg.CacheMaxBytes > 0 || len(purgers) > 0 {
+		purge = func(ctx context.Context, paths, apps []string) (int, error) {
+			purged := proxy.Purge(paths, apps)
+			var errs []error
+			for _, p := range purgers {
+				errs = append(errs, p.Purge(ctx, paths, apps))
+			}
+			return purged, errors.Join(errs...)
+		}
+	}
+	// The deploy hook runs everything a push pipeline needs after uploading an app's build
+	if cfg.DeployHookSecret != "" {
+		if len(cfg.DeployHookSecret) < 32 {
+			return nil, errors.New("DEPLOY_HOOK_SECRET must be at least 32 bytes")
+		}
+		deploy := func(ctx context.Context, d admin.Deploy) (admin.DeployResult, error) {
+			res := admin.DeployResult{App: d.App, Release: d.Release}
+			var errs []error
+			if purge != nil {
+				purged, err := purge(ctx, nil, []string{d.App})
+				res.Purged = purged
+				errs = append(errs, err)
+			}
+			if cfg.FedModulesPath != "" {
+				errs = append(errs, proxy.RefreshFedModules(ctx))
+			}
+			if d.Warmup && warmup != nil {
+				warmed, err := proxy.WarmupApp(ctx, d.App)
+				res.Warmed = warmed
+				errs = append(errs, err)
+			}
+			return res, errors.Join(errs...)
+		}
+		r.Post("/admin/deploy-hook", admin.DeployHook(adminAuth, cfg.DeployHookSecret, deploy, log))
+	}
+	if adminAuth.Enabled() {
+		r.Mount("/admin", admin.NewRouter(adminAuth, releases, warmup, purge, sampling, hot, grants, log))
+	}
+
+	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("OK"))
+	})
+
+	// Readiness is reported once the startup cache warmup has finished
+	r.Get("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !ready.Load() {
+			http.Error(w, "warming up", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("OK"))
+	})
+
+	// Each route rule maps a path prefix to a bucket path, e.g. by default
+	// /manifests/* -> {prefix}/manifests/*, /apps/* -> {prefix}/data/*, /* -> {prefix}/data/*
+	// Rules with a host only apply to requests for that Host header.
+	var publisher *events.Publisher
+	if cfg.KafkaTopic != "" {
+		if publisher, err = events.NewPublisher(cfg.KafkaBrokers, cfg.KafkaTopic, cfg.ClowderConfig, log); err != nil {
+			return nil, fmt.Errorf("kafka: %w", err)
+		}
+		h.closers = append(h.closers, func() { publisher.Close() })
+	}
+	apps := metrics.NewAppLabels(cfg.MetricsAppPrefixes, cfg.MetricsAppLimit)
+	fallback, err := newAssetRouter(config.RoutesForHost(cfg.Routes, ""), proxy, releases, keys, publisher, apps, hot, clients, hooks)
+	if err != nil {
+		return nil, fmt.Errorf("ROUTE_RULES: %w", err)
+	}
+	hosts := hostRouter{hosts: map[string]chi.Router{}, fallback: fallback}
+	for _, rule := range cfg.Routes {
+		if rule.Host != "" && hosts.hosts[rule.Host] == nil {
+			if hosts.hosts[rule.Host], err = newAssetRouter(config.RoutesForHost(cfg.Routes, rule.Host), proxy, releases, keys, publisher, apps, hot, clients, hooks); err != nil {
+				return nil, fmt.Errorf("ROUTE_RULES: %w", err)
+			}
+		}
+	}
+	sourceMapCIDRs, err := clientip.ParseCIDRs(cfg.SourceMapAllowedCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("SOURCEMAP_ALLOWED_CIDRS: %w", err)
+	}
+	if cfg.RedirectsErr != nil {
+		return nil, fmt.Errorf("REDIRECT_RULES: %w", cfg.RedirectsErr)
+	}
+	redirects, err := policy.Redirects(cfg.Redirects)
+	if err != nil {
+		return nil, fmt.Errorf("REDIRECT_RULES: %w", err)
+	}
+	assets := r.With(
+		redirects,
+		policy.Denylist(cfg.DenylistPatterns),
+		policy.SourceMaps(cfg.SourceMapHeader, cfg.SourceMapToken, sourceMapCIDRs, clients),
+	)
+	under := prefixMatcher(proxy.Resolve)
+	if len(cfg.JWTProtectedPrefixes) > 0 {
+		if cfg.JWKSURL == "" {
+			return nil, errors.New("JWT_PROTECTED_PREFIXES requires JWKS_URL")
+		}
+		validator := jwtauth.NewValidator(jwtauth.NewKeySet(cfg.JWKSURL, cfg.JWKSRefreshInterval), cfg.JWTIssuer, cfg.JWTAudience)
+		assets = assets.With(validator.Protect(cfg.JWTProtectedPrefixes, under))
+	}
+	if len(cfg.OIDCProtectedPrefixes) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		provider, err := oidc.New(ctx, oidc.Config{
+			IssuerURL:    cfg.OIDCIssuerURL,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       cfg.OIDCScopes,
+			CookieSecret: cfg.OIDCCookieSecret,
+			CookieName:   cfg.OIDCCookieName,
+			SessionTTL:   cfg.OIDCSessionTTL,
+		})
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("oidc: %w", err)
+		}
+		r.Get(provider.CallbackPath, provider.Callback)
+		assets = assets.With(provider.Protect(cfg.OIDCProtectedPrefixes, under))
+	}
+	if grants != nil {
+		assets = assets.With(grants.Protect(under))
+	}
+	if cfg.MemoryShedThreshold > 0 {
+		memory, ok := shed.NewMemory(cfg.MemoryLimit, cfg.MemoryShedThreshold, time.Second)
+		if !ok {
+			return nil, errors.New("MEMORY_SHED_THRESHOLD: no memory limit detected, set MEMORY_LIMIT_BYTES")
+		}
+		log.Infof("memory shedding above %.0f%% of %d bytes", cfg.MemoryShedThreshold*100, memory.Limit())
+		h.closers = append(h.closers, memory.Close)
+		proxy.UnderPressure = memory.UnderPressure
+		assets = assets.With(memory.Middleware)
+	}
+	if cfg.MaxConcurrentRequests > 0 {
+		assets = assets.With(shed.NewConcurrency(cfg.MaxConcurrentRequests, cfg.MaxQueuedRequests, cfg.QueueTimeout).Middleware)
+	}
+	if cfg.FaultInjection {
+		log.Warnf("fault injection is enabled")
+		assets = assets.With(fault.Middleware(fault.Config{
+			Latency:       cfg.FaultLatency,
+			LatencyRate:   cfg.FaultLatencyRate,
+			Status:        cfg.FaultStatus,
+			ErrorRate:     cfg.FaultErrorRate,
+			TruncateBytes: cfg.FaultTruncateBytes,
+			TruncateRate:  cfg.FaultTruncateRate,
+			Header:        cfg.FaultHeader,
+		}))
+	}
+	assets.Mount("/", hosts)
+
+	r.MethodNotAllowed(methodNotAllowed)
+	return r, nil
+}
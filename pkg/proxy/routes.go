@@ -0,0 +1,379 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/canary"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/clientip"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/config"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/errreport"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/events"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/hotkeys"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/identity"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/jwtauth"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/logger"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/metrics"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/policy"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/release"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/rewrite"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/s3"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/tracecontext"
+	"github.com/RedHatInsights/frontend-asset-proxy/internal/vary"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// rulePath returns the path of r relative to rule, honoring StripPrefix.
+func rulePath(rule config.RouteRule, reqPath string) string {
+	if rule.StripPrefix {
+		return strings.TrimPrefix(reqPath, rule.Prefix)
+	}
+	return reqPath
+}
+
+// routeKeys holds the compiled key expressions of the route rules that have one.
+type routeKeys map[string]*rewrite.Key
+
+// compileKeys compiles the key expressions of rules.
+func compileKeys(rules []config.RouteRule) (routeKeys, error) {
+	keys := routeKeys{}
+	for _, rule := range rules {
+		if rule.Key == "" {
+			continue
+		}
+		key, err := rewrite.Compile(rule.Key)
+		if err != nil {
+			return nil, fmt.Errorf("route %s key: %w", rule.Prefix, err)
+		}
+		keys[rule.Host+" "+rule.Prefix] = key
+	}
+	return keys, nil
+}
+
+// objectPath returns the path of the object for reqPath under the rule's bucket path: the
+// result of the rule's key expression, or the request path honoring StripPrefix. Request
+// headers the expression reads are added to the Vary header of the response r carries.
+func (k routeKeys) objectPath(rule config.RouteRule, r *http.Request, reqPath string) (string, error) {
+	key, ok := k[rule.Host+" "+rule.Prefix]
+	if !ok {
+		return rulePath(rule, reqPath), nil
+	}
+	app, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(reqPath, strings.TrimSuffix(rule.Prefix, "/")), "/"), "/")
+	query := map[string]string{}
+	for name, values := range r.URL.Query() {
+		query[name] = values[0]
+	}
+	return key.Eval(rewrite.Env{
+		Path:        rulePath(rule, reqPath),
+		RequestPath: reqPath,
+		Prefix:      rule.Prefix,
+		App:         app,
+		Host:        requestHost(r),
+		Method:      r.Method,
+		Query:       query,
+		Header: func(name string) string {
+			vary.AddContext(r.Context(), name)
+			return r.Header.Get(name)
+		},
+	})
+}
+
+// liveBucketPath returns the rule's bucket path, or its live release when it has releases.
+func liveBucketPath(rule config.RouteRule, releases *release.Registry) string {
+	if live, ok := releases.BucketPath(rule.Name); ok {
+		return live
+	}
+	return rule.BucketPath
+}
+
+// routeHandler serves requests matched by rule from the rule's bucket path (or its live
+// release), or from its canary bucket path for clients assigned to the canary.
+func routeHandler(rule config.RouteRule, proxy *s3.Proxy, releases *release.Registry, keys routeKeys, publisher *events.Publisher, apps *metrics.AppLabels, hot *hotkeys.Tracker, hooks hookChain) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		w = hooks.responseHeaders(w, r)
+		// Key expressions and filters choosing the object by request header add it to Vary
+		r = r.WithContext(vary.WithResponse(r.Context(), w.Header()))
+		if !hooks.onRequest(w, r, rule) {
+			return
+		}
+		id, err := identity.FromRequest(r)
+		if err == nil {
+			logger.AddFields(r, logger.Fields{"org_id": id.Org(), "account": id.AccountNumber})
+		}
+		if rule.IdentityRequired(proxy.Config.RequireIdentity) && (err != nil || id.Org() == "") {
+			proxy.Error(w, r, http.StatusUnauthorized)
+			hooks.onError(r, http.StatusUnauthorized, nil)
+			return
+		}
+		if !rule.AllowsExtension(r.URL.Path) || rule.Immutable && !isCommitSHA(strings.TrimPrefix(r.URL.Path, rule.Prefix)) {
+			proxy.Error(w, r, http.StatusNotFound)
+			hooks.onError(r, http.StatusNotFound, nil)
+			return
+		}
+		path, err := keys.objectPath(rule, r, r.URL.Path)
+		if err != nil {
+			proxy.Log.WithFields(logger.Fields{"process": "rewrite", "route": rule.Prefix, "path": r.URL.Path}).Warnf("key expression failed: %v", err)
+			proxy.Error(w, r, http.StatusNotFound)
+			hooks.onError(r, http.StatusNotFound, err)
+			return
+		}
+		bucketPath, variant := liveBucketPath(rule, releases), canary.Stable
+		if rule.Canary != nil {
+			if variant = canary.Choose(w, r, rule.Prefix, rule.Canary); variant == canary.Canary {
+				bucketPath = rule.Canary.BucketPath
+			}
+		}
+
+		if rule.WriteTimeout > 0 {
+			// Replaces the server-wide deadline set when the request headers were read
+			_ = http.NewResponseController(w).SetWriteDeadline(start.Add(time.Duration(rule.WriteTimeout)))
+		}
+
+		metrics.InFlightRequests.Inc()
+		defer metrics.InFlightRequests.Dec()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		r, stats := s3.WithStats(r)
+		proxy.ProxyS3(ww, r, rule, s3.Target{
+			Full:       hooks.onKeyResolved(r, rule, s3.JoinPath(bucketPath, path)),
+			BucketPath: bucketPath,
+			Resolved:   func(full string) string { return hooks.onKeyResolved(r, rule, full) },
+		})
+
+		elapsed := time.Since(start)
+		app := apps.Label(r.URL.Path, ww.Status())
+		metrics.RequestsTotal.WithLabelValues(rule.Prefix, variant, app, strconv.Itoa(ww.Status())).Inc()
+		var traceID string
+		if tc, ok := tracecontext.FromContext(r.Context()); ok && tc.Sampled() {
+			traceID = tc.TraceID
+		}
+		metrics.ObserveWithTrace(metrics.RequestDuration.WithLabelValues(rule.Prefix, variant, app), elapsed.Seconds(), traceID)
+		proxy.LogSlow(r, stats, ww.Status(), ww.BytesWritten(), elapsed)
+		if stats.Key != "" {
+			hot.Record(stats.Bucket+"/"+stats.Key, int64(ww.BytesWritten()))
+		}
+		if ww.Status() >= http.StatusInternalServerError {
+			errreport.Report(r, ww.Status(), stats.Err, map[string]string{"bucket": stats.Bucket, "key": stats.Key, "route": rule.Prefix, "s3_request_id": stats.RequestID})
+		}
+		if ww.Status() >= http.StatusBadRequest {
+			hooks.onError(r, ww.Status(), stats.Err)
+		}
+		if publisher != nil {
+			e := events.AccessEvent{
+				Time:       start,
+				RequestID:  middleware.GetReqID(r.Context()),
+				Method:     r.Method,
+				Host:       r.Host,
+				Path:       r.URL.Path,
+				Route:      rule.Prefix,
+				Variant:    variant,
+				Bucket:     stats.Bucket,
+				Key:        stats.Key,
+				Status:     ww.Status(),
+				Bytes:      ww.BytesWritten(),
+				DurationMS: elapsed.Milliseconds(),
+				UserAgent:  r.UserAgent(),
+				Referer:    r.Referer(),
+			}
+			if id != nil {
+				e.OrgID = id.Org()
+			}
+			publisher.Publish(e)
+		}
+	}
+}
+
+// newResolver maps a request path to its stable full bucket path using the rules for the request's host.
+func newResolver(rules []config.RouteRule, releases *release.Registry, keys routeKeys) func(r *http.Request, reqPath string) (string, bool) {
+	return func(r *http.Request, reqPath string) (string, bool) {
+		reqPath, ok := policy.Clean(reqPath)
+		if !ok {
+			return "", false
+		}
+		rule, ok := config.MatchRoute(config.RoutesForHost(rules, requestHost(r)), reqPath)
+		if !ok || !rule.AllowsExtension(reqPath) {
+			return "", false
+		}
+		path, err := keys.objectPath(rule, r, reqPath)
+		if err != nil {
+			return "", false
+		}
+		return s3.JoinPath(liveBucketPath(rule, releases), path), true
+	}
+}
+
+// releasePaths returns the paths served by app's rules and a resolver mapping them into
+// the release at bucketPath, so a release can be warmed before it serves any request.
+func releasePaths(rules []config.RouteRule, keys routeKeys, app, bucketPath string, paths []string) ([]string, func(r *http.Request, reqPath string) (string, bool)) {
+	var appPaths []string
+	for _, reqPath := range paths {
+		if rule, ok := config.MatchRoute(config.RoutesForHost(rules, ""), reqPath); ok && rule.Name == app {
+			appPaths = append(appPaths, reqPath)
+		}
+	}
+	return appPaths, func(r *http.Request, reqPath string) (string, bool) {
+		reqPath, ok := policy.Clean(reqPath)
+		if !ok {
+			return "", false
+		}
+		rule, ok := config.MatchRoute(config.RoutesForHost(rules, ""), reqPath)
+		if !ok || rule.Name != app || !rule.AllowsExtension(reqPath) {
+			return "", false
+		}
+		path, err := keys.objectPath(rule, r, reqPath)
+		if err != nil {
+			return "", false
+		}
+		return s3.JoinPath(bucketPath, path), true
+	}
+}
+
+// prefixMatcher matches requests under a protected prefix by their path, and by the
+// bucket path they resolve to: route rules can serve the same objects under several
+// paths, e.g. the default rules read data/chrome/x for both /apps/chrome/x and /chrome/x.
+func prefixMatcher(resolve func(r *http.Request, reqPath string) (string, bool)) jwtauth.PrefixMatcher {
+	return func(r *http.Request, prefix string) bool {
+		if jwtauth.RequestUnder(r, prefix) {
+			return true
+		}
+		full, ok := resolve(r, r.URL.Path)
+		if !ok {
+			return false
+		}
+		protected, ok := resolve(r, strings.TrimSuffix(prefix, "/")+"/")
+		return ok && policy.UnderPrefix(full, []string{protected})
+	}
+}
+
+// isCommitSHA reports whether the first segment of path is an abbreviated or full git commit SHA.
+func isCommitSHA(path string) bool {
+	seg, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if len(seg) < 7 || len(seg) > 40 {
+		return false
+	}
+	for _, c := range seg {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// rateLimitKey returns the rate limiting key function for mode. In "identity" mode requests
+// are limited per org from x-rh-identity, since many users share egress NAT addresses;
+// requests without a usable identity fall back to the client IP.
+func rateLimitKey(mode string, clients clientip.Resolver) func(r *http.Request) (string, string) {
+	return func(r *http.Request) (string, string) {
+		if mode == "identity" || mode == "account" {
+			if id, err := identity.FromRequest(r); err == nil {
+				if mode == "account" && id.AccountNumber != "" {
+					return id.AccountNumber, "account"
+				}
+				if id.Org() != "" {
+					return id.Org(), "org"
+				}
+			}
+		}
+		return clients.ClientIP(r).String(), "ip"
+	}
+}
+
+// routePattern returns the chi pattern for a fixed path. middleware.URLFormat strips the
+// extension from the routing path, so "/fed-modules.json" is routed as "/fed-modules".
+func routePattern(p string) string {
+	return strings.TrimSuffix(p, path.Ext(p))
+}
+
+// exactPath only serves requests for exactly p, e.g. not "/fed-modules.xml" for "/fed-modules.json".
+func exactPath(p string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != p {
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// methodNotAllowed returns 405 for unsupported methods on matched routes
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", "GET, HEAD")
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+// newAssetRouter registers GET and HEAD routes per rule so both methods resolve keys identically.
+// Rules with network restrictions only serve clients from the allowed networks, rules
+// with a trailing slash policy redirect to its canonical form, and rules with response
+// headers apply them to every response.
+func newAssetRouter(rules []config.RouteRule, proxy *s3.Proxy, releases *release.Registry, keys routeKeys, publisher *events.Publisher, apps *metrics.AppLabels, hot *hotkeys.Tracker, clients clientip.Resolver, hooks hookChain) (chi.Router, error) {
+	r := chi.NewRouter()
+	for _, rule := range rules {
+		allow, err := clientip.ParseCIDRs(rule.AllowCIDRs)
+		if err != nil {
+			return nil, fmt.Errorf("route %s allowCIDRs: %w", rule.Prefix, err)
+		}
+		deny, err := clientip.ParseCIDRs(rule.DenyCIDRs)
+		if err != nil {
+			return nil, fmt.Errorf("route %s denyCIDRs: %w", rule.Prefix, err)
+		}
+		networks := policy.Networks(allow, deny, clients)
+		trailingSlash, err := policy.TrailingSlash(rule.TrailingSlash)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", rule.Prefix, err)
+		}
+		if err := s3.CheckUpstreamHeaders(rule.UpstreamHeaders); err != nil {
+			return nil, fmt.Errorf("route %s upstreamHeaders: %w", rule.Prefix, err)
+		}
+		responseHeaders, err := policy.ResponseHeaders(rule.ResponseHeaders)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", rule.Prefix, err)
+		}
+		ruleHooks := hooks
+		if responseHeaders != nil {
+			// The rule's headers are applied first, so hooks and filters see them
+			ruleHooks = append(hookChain{{OnResponseHeaders: func(r *http.Request, status int, h http.Header) {
+				responseHeaders(h)
+			}}}, hooks...)
+		}
+		pattern := strings.TrimSuffix(rule.Prefix, "/") + "/*"
+		handler := networks(trailingSlash(routeHandler(rule, proxy, releases, keys, publisher, apps, hot, ruleHooks)))
+		r.Get(pattern, handler.ServeHTTP)
+		r.Head(pattern, handler.ServeHTTP)
+		if rule.Prefix == "/manifests" && proxy.Config.ManifestIndexEnabled {
+			r.Get(rule.Prefix, networks(proxy.ManifestIndexHandler(rule)).ServeHTTP)
+		}
+	}
+
+	r.MethodNotAllowed(methodNotAllowed)
+	return r, nil
+}
+
+// hostRouter dispatches to the asset router configured for the request's Host,
+// falling back to the host-agnostic routes.
+type hostRouter struct {
+	hosts    map[string]chi.Router
+	fallback chi.Router
+}
+
+// requestHost returns the lower-cased Host header without port.
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if hn, _, err := net.SplitHostPort(host); err == nil {
+		host = hn
+	}
+	return strings.ToLower(host)
+}
+
+func (h hostRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if router, ok := h.hosts[requestHost(r)]; ok {
+		router.ServeHTTP(w, r)
+		return
+	}
+	h.fallback.ServeHTTP(w, r)
+}
@@ -91,6 +91,54 @@ run_test() {
     return $([ "$success" = true ] && echo 0 || echo 1)
 }
 
+# $1: Test Name
+# $2: URL to test with a HEAD request
+# $3: Expected HTTP Status Code
+# $4: (Optional) Expected Content-Type (substring match)
+run_head_test() {
+    local test_name="$1"
+    local url="$2"
+    local expected_status="$3"
+    local expected_content_type="$4"
+    local success=true
+
+    echo "----------------------------------------"
+    echo "Running Test: $test_name"
+    echo "   URL: HEAD $url"
+
+    response_headers_file=$(mktemp)
+    http_status=$(curl -s -I -w "%{http_code}" -o /dev/null -D "$response_headers_file" "$url")
+    content_type=$(grep -i "^Content-Type:" "$response_headers_file" | awk '{$1=$1};1' | cut -d' ' -f2- | sed 's/;.*//')
+    rm -f "$response_headers_file"
+
+    echo "   Received Status: $http_status"
+    if [ "$http_status" -ne "$expected_status" ]; then
+        echo "   FAILED: Expected status $expected_status, got $http_status"
+        success=false
+    else
+        echo "   PASSED: HTTP Status $http_status"
+    fi
+
+    if [ -n "$expected_content_type" ]; then
+        echo "   Received Content-Type: $content_type"
+        if [[ "$content_type" != *"$expected_content_type"* ]]; then
+            echo "   FAILED: Expected Content-Type to contain '$expected_content_type', got '$content_type'"
+            success=false
+        else
+            echo "   PASSED: Content-Type matches"
+        fi
+    fi
+
+    if [ "$success" = true ]; then
+        echo "   Test Result: SUCCESS"
+    else
+        echo "   Test Result: FAILURE"
+    fi
+    echo "----------------------------------------"
+    echo ""
+    return $([ "$success" = true ] && echo 0 || echo 1)
+}
+
 # --- Main Test Execution ---
 echo "Starting Proxy Server Tests for /apps and /manifest routes..."
 echo "   Targeting: $PROXY_BASE_URL"
@@ -119,6 +167,14 @@ if [ $? -ne 0 ]; then all_tests_passed=false; fi
 run_test "Manifest Route - JSON File" "${PROXY_BASE_URL}${MANIFEST_TEST_PATH}" 200 "$MANIFEST_EXPECTED_CONTENT_TYPE" "$MANIFEST_EXPECTED_CONTENT_SNIPPET"
 if [ $? -ne 0 ]; then all_tests_passed=false; fi
 
+# Test 5: HEAD on /apps route
+# HEAD must resolve keys exactly like GET for every route
+run_head_test "Apps Route - HEAD" "${PROXY_BASE_URL}${APPS_TEST_PATH}" 200 "$APPS_EXPECTED_CONTENT_TYPE"
+if [ $? -ne 0 ]; then all_tests_passed=false; fi
+
+# Test 6: HEAD on /manifests route
+run_head_test "Manifest Route - HEAD" "${PROXY_BASE_URL}${MANIFEST_TEST_PATH}" 200 "$MANIFEST_EXPECTED_CONTENT_TYPE"
+if [ $? -ne 0 ]; then all_tests_passed=false; fi
 
 # --- Summary ---
 echo "All Tests Completed."